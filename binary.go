@@ -0,0 +1,205 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNotInline is the error returned by Property.Data when the property
+// refers to external data (such as an HTTP URI) rather than containing the
+// data itself.
+var ErrNotInline = errors.New("vcard: property data is not inline")
+
+// DataEncoding is a way of representing binary data (such as the contents of
+// PHOTO, LOGO, SOUND or KEY) in a property value.
+type DataEncoding int
+
+const (
+	// EncodingDataURI represents data as a "data:" URI, as used by vCard
+	// 4.0. The media type is included in the URI.
+	EncodingDataURI DataEncoding = iota
+	// EncodingB represents data using base64 and the parameter
+	// ENCODING=b, as used by vCard 3.0. The media type is given by the TYPE
+	// parameter.
+	EncodingB
+	// EncodingBase64 represents data using base64 and the parameter
+	// ENCODING=BASE64, as used by vCard 2.1. The media type is given by the
+	// TYPE parameter.
+	EncodingBase64
+)
+
+// mediaTypes maps the names used in the TYPE parameter of vCard 2.1 and 3.0 to
+// the corresponding media types. Where several names correspond to the same
+// media type, the first one is used when converting media types to names.
+var mediaTypes = []struct {
+	name      string
+	mediaType string
+}{
+	{"GIF", "image/gif"},
+	{"JPEG", "image/jpeg"},
+	{"JPG", "image/jpeg"},
+	{"PNG", "image/png"},
+	{"BMP", "image/bmp"},
+	{"TIFF", "image/tiff"},
+	{"WAVE", "audio/wav"},
+	{"WAV", "audio/wav"},
+	{"MP3", "audio/mpeg"},
+	{"OGG", "audio/ogg"},
+	{"PGP", "application/pgp-keys"},
+	{"X509", "application/pkix-cert"},
+}
+
+// mediaTypeOf returns the media type corresponding to a TYPE parameter
+// value, or the empty string if it is not known.
+func mediaTypeOf(name string) string {
+	if strings.Contains(name, "/") {
+		return strings.ToLower(name)
+	}
+	name = strings.ToUpper(name)
+	for _, t := range mediaTypes {
+		if t.name == name {
+			return t.mediaType
+		}
+	}
+	return ""
+}
+
+// mediaTypeName returns the TYPE parameter value corresponding to a media
+// type.
+func mediaTypeName(mediaType string) string {
+	mediaType = strings.ToLower(mediaType)
+	for _, t := range mediaTypes {
+		if t.mediaType == mediaType {
+			return t.name
+		}
+	}
+	if i := strings.IndexByte(mediaType, '/'); i != -1 {
+		return strings.ToUpper(mediaType[i+1:])
+	}
+	return strings.ToUpper(mediaType)
+}
+
+// Data returns the binary data stored in the property, along with its media
+// type (such as "image/jpeg"), if known. The data may be stored either in
+// base64 (with the ENCODING parameter set to "b" or "BASE64") or as a "data:"
+// URI. If the property does not contain inline data (for example, if its
+// value is an HTTP URI), the error is ErrNotInline.
+func (p *Property) Data() (data []byte, mediaType string, err error) {
+	if values := p.Param("MEDIATYPE"); len(values) > 0 {
+		mediaType = values[0]
+	}
+	value := p.joined()
+
+	encoding := strings.ToUpper(strings.Join(p.Param("ENCODING"), ","))
+	if encoding == "B" || encoding == "BASE64" {
+		if mediaType == "" {
+			for _, t := range p.Param("TYPE") {
+				if mediaType = mediaTypeOf(t); mediaType != "" {
+					break
+				}
+			}
+		}
+		// Older encoders sometimes leave whitespace in the data.
+		value = strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, value)
+		data, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, "", fmt.Errorf("vcard: invalid base64 data: %v", err)
+		}
+		return data, mediaType, nil
+	}
+
+	if len(value) < 5 || !strings.EqualFold(value[:5], "data:") {
+		return nil, "", ErrNotInline
+	}
+	data, uriMediaType, err := parseDataURI(value)
+	if err != nil {
+		return nil, "", err
+	}
+	if uriMediaType != "" {
+		mediaType = uriMediaType
+	} else if mediaType == "" {
+		// This is the default specified by RFC 2397.
+		mediaType = "text/plain;charset=US-ASCII"
+	}
+	return data, mediaType, nil
+}
+
+// SetData sets the value of the property to the given binary data, which has
+// the given media type (which may be empty if unknown), using the given
+// encoding. Any existing ENCODING, VALUE and MEDIATYPE parameters are
+// removed, as are any values of the TYPE parameter which describe a media
+// type.
+func (p *Property) SetData(data []byte, mediaType string, enc DataEncoding) {
+	p.removeParam("ENCODING")
+	p.removeParam("VALUE")
+	p.removeParam("MEDIATYPE")
+	var types []string
+	for _, t := range p.Param("TYPE") {
+		if mediaTypeOf(t) == "" {
+			types = append(types, t)
+		}
+	}
+	if len(types) > 0 {
+		p.SetParam("TYPE", types...)
+	} else {
+		p.removeParam("TYPE")
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	switch enc {
+	case EncodingDataURI:
+		p.setJoined("data:" + mediaType + ";base64," + encoded)
+	case EncodingB, EncodingBase64:
+		if enc == EncodingB {
+			p.SetParam("ENCODING", "b")
+		} else {
+			p.SetParam("ENCODING", "BASE64")
+		}
+		if mediaType != "" {
+			p.addParam("TYPE", mediaTypeName(mediaType))
+		}
+		p.SetValues(encoded)
+	}
+}
+
+// parseDataURI parses a "data:" URI, as described in RFC 2397. The returned
+// media type is empty if the URI does not specify one.
+func parseDataURI(uri string) (data []byte, mediaType string, err error) {
+	comma := strings.IndexByte(uri, ',')
+	if comma == -1 {
+		return nil, "", errors.New("vcard: invalid data URI: missing ','")
+	}
+	mediaType, encoded := uri[len("data:"):comma], uri[comma+1:]
+	isBase64 := false
+	if i := len(mediaType) - len(";base64"); i >= 0 && strings.EqualFold(mediaType[i:], ";base64") {
+		mediaType = mediaType[:i]
+		isBase64 = true
+	}
+
+	if isBase64 {
+		data, err = base64.StdEncoding.DecodeString(encoded)
+	} else {
+		var s string
+		s, err = url.PathUnescape(encoded)
+		data = []byte(s)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("vcard: invalid data URI: %v", err)
+	}
+	return data, mediaType, nil
+}
@@ -0,0 +1,99 @@
+package vcard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestData(t *testing.T) {
+	tests := []struct {
+		in        string
+		data      string
+		mediaType string
+		err       error
+	}{
+		{"PHOTO;ENCODING=b;TYPE=JPEG:aGVsbG8=", "hello", "image/jpeg", nil},
+		{"PHOTO;ENCODING=BASE64;TYPE=GIF:aGVs\n  bG8=", "hello", "image/gif", nil},
+		{"KEY;ENCODING=b;TYPE=X509:aGVsbG8=", "hello", "application/pkix-cert", nil},
+		{"LOGO;ENCODING=b;TYPE=work:aGVsbG8=", "hello", "", nil},
+		{"PHOTO:data:image/png;base64,aGVsbG8=", "hello", "image/png", nil},
+		{"SOUND:data:audio/ogg;codecs=vorbis;base64,aGVsbG8=", "hello", "audio/ogg;codecs=vorbis", nil},
+		{"PHOTO:data:,hello%2C%20world", "hello, world", "text/plain;charset=US-ASCII", nil},
+		{"PHOTO;MEDIATYPE=image/jpeg:data:;base64,aGVsbG8=", "hello", "image/jpeg", nil},
+		{"PHOTO;VALUE=URI;TYPE=GIF:http://www.example.com/dir_photos/my_photo.gif", "", "", ErrNotInline},
+	}
+
+	for _, test := range tests {
+		cards, err := ParseAll(strings.NewReader("BEGIN:VCARD\n" + test.in + "\nEND:VCARD\n"))
+		if err != nil {
+			t.Errorf("parsing %q: unexpected error: %v", test.in, err)
+			continue
+		}
+		for _, props := range cards[0].m {
+			data, mediaType, err := props[0].Data()
+			if err != test.err {
+				t.Errorf("Data() for %q: got error %v, want %v", test.in, err, test.err)
+			} else if string(data) != test.data || mediaType != test.mediaType {
+				t.Errorf("Data() for %q = %q, %q, want %q, %q", test.in, data, mediaType, test.data, test.mediaType)
+			}
+		}
+	}
+}
+
+func TestSetData(t *testing.T) {
+	tests := []struct {
+		enc DataEncoding
+		out string
+	}{
+		{EncodingDataURI, "PHOTO;TYPE=work:data:image/jpeg;base64,aGVsbG8="},
+		{EncodingB, "PHOTO;TYPE=work,JPEG;ENCODING=b:aGVsbG8="},
+		{EncodingBase64, "PHOTO;TYPE=work,JPEG;ENCODING=BASE64:aGVsbG8="},
+	}
+
+	for _, test := range tests {
+		var prop Property
+		prop.SetParam("TYPE", "work", "GIF")
+		prop.SetParam("VALUE", "uri")
+		prop.SetData([]byte("hello"), "image/jpeg", test.enc)
+		sb := new(strings.Builder)
+		writeProperty(sb, "PHOTO", prop)
+		if sb.String() != test.out {
+			t.Errorf("SetData with encoding %v: got %q, want %q", test.enc, sb.String(), test.out)
+		}
+		data, mediaType, err := prop.Data()
+		if err != nil {
+			t.Errorf("SetData with encoding %v: unexpected error: %v", test.enc, err)
+		} else if string(data) != "hello" || mediaType != "image/jpeg" {
+			t.Errorf("SetData with encoding %v: Data() = %q, %q", test.enc, data, mediaType)
+		}
+	}
+}
+
+func TestDataRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 0xfe, 0xff}, 200)
+	for _, enc := range []DataEncoding{EncodingDataURI, EncodingB, EncodingBase64} {
+		var prop Property
+		prop.SetData(data, "image/png", enc)
+		card := new(Card)
+		card.Add("PHOTO", prop)
+		out := card.String()
+		for _, line := range strings.SplitAfter(out, "\r\n") {
+			if len(line) > 77 {
+				t.Errorf("encoding %v: line %q is too long", enc, line)
+			}
+		}
+
+		cards, err := ParseAll(strings.NewReader(out))
+		if err != nil {
+			t.Errorf("encoding %v: unexpected error: %v", enc, err)
+			continue
+		}
+		parsed, mediaType, err := cards[0].Get("PHOTO")[0].Data()
+		if err != nil {
+			t.Errorf("encoding %v: unexpected error: %v", enc, err)
+		} else if !bytes.Equal(parsed, data) || mediaType != "image/png" {
+			t.Errorf("encoding %v: Data() = %q, %q, want %q, %q", enc, parsed, mediaType, data, "image/png")
+		}
+	}
+}
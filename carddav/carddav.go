@@ -0,0 +1,131 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+// Package carddav implements CardDAV (RFC 6352), the protocol used to
+// synchronize address books over HTTP.
+//
+// Handler serves a single address book, whose contents are kept in a Store.
+// Each card in the address book is a resource whose name ends in ".vcf".
+// Client accesses the address books of a server, including (but not limited
+// to) those served by Handler.
+package carddav
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ianprime0509/vcard"
+)
+
+const (
+	nsDAV     = "DAV:"
+	nsCardDAV = "urn:ietf:params:xml:ns:carddav"
+)
+
+var (
+	// ErrNotFound is returned by a Store when an object does not exist.
+	ErrNotFound = errors.New("carddav: object not found")
+	// ErrPreconditionFailed is returned by a Store when the Precondition of
+	// a change is not satisfied.
+	ErrPreconditionFailed = errors.New("carddav: precondition failed")
+	// ErrInvalidSyncToken is returned by a Store when asked for the changes
+	// since a sync token which it did not issue (or has forgotten).
+	ErrInvalidSyncToken = errors.New("carddav: invalid sync token")
+)
+
+// UIDConflictError is returned by a Store when putting a card whose UID is
+// already that of the card of another object.
+type UIDConflictError struct {
+	Name string // the name of the other object
+}
+
+func (e *UIDConflictError) Error() string {
+	return fmt.Sprintf("carddav: UID already used by %v", e.Name)
+}
+
+// Object is a card stored in an address book.
+type Object struct {
+	Name    string // the name of the resource, such as "john.vcf"
+	ETag    string // the entity tag of the object, without quotes
+	ModTime time.Time
+	Card    *vcard.Card
+}
+
+// Precondition is a condition which must hold for a change to an object to
+// be made, corresponding to the If-Match and If-None-Match headers.
+type Precondition struct {
+	// IfMatch, if not empty, contains the entity tags of which the object
+	// must currently have one. The tag "*" matches any existing object.
+	IfMatch []string
+	// IfNoneMatch requires that the object does not currently exist.
+	IfNoneMatch bool
+}
+
+// Check returns ErrPreconditionFailed if the precondition does not hold for
+// the current state of an object, which is nil if the object does not
+// exist.
+func (p Precondition) Check(current *Object) error {
+	if p.IfNoneMatch && current != nil {
+		return ErrPreconditionFailed
+	}
+	if len(p.IfMatch) == 0 {
+		return nil
+	}
+	if current != nil {
+		for _, etag := range p.IfMatch {
+			if etag == "*" || etag == current.ETag {
+				return nil
+			}
+		}
+	}
+	return ErrPreconditionFailed
+}
+
+// Store is the storage of the objects of an address book. All its methods
+// must be safe to call concurrently.
+type Store interface {
+	// List returns all the objects in the address book.
+	List() ([]Object, error)
+	// Get returns the object with the given name, or ErrNotFound.
+	Get(name string) (*Object, error)
+	// Put creates or replaces the object with the given name, if the
+	// precondition holds, returning the new object and whether it was
+	// created. If the card has a UID which is that of the card of another
+	// object, the error is a *UIDConflictError; the check must be atomic
+	// with respect to other calls to Put.
+	Put(name string, card *vcard.Card, cond Precondition) (obj *Object, created bool, err error)
+	// Delete deletes the object with the given name, if the precondition
+	// holds. If the object does not exist, the error is ErrNotFound.
+	Delete(name string, cond Precondition) error
+	// Changes returns the objects which have been created or modified and
+	// the names of those which have been deleted since the given sync
+	// token was issued, along with a new sync token. If the given token is
+	// empty, all the objects are returned.
+	Changes(token string) (changed []Object, deleted []string, newToken string, err error)
+}
+
+// ETag returns an entity tag for the given contents of an object.
+func ETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// readCard reads an object, which must contain exactly one card.
+func readCard(r io.Reader) (*vcard.Card, error) {
+	cards, err := vcard.ParseAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(cards) != 1 {
+		return nil, fmt.Errorf("got %v cards, want 1", len(cards))
+	}
+	return cards[0], nil
+}
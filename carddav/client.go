@@ -0,0 +1,412 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ianprime0509/vcard"
+)
+
+// Client is a client of a CardDAV server.
+type Client struct {
+	http     *http.Client
+	endpoint *url.URL
+	username string
+	password string
+}
+
+// AddressBook is an address book found on a server.
+type AddressBook struct {
+	Href        string // the URL path of the address book
+	Name        string // the display name, which may be empty
+	Description string
+}
+
+// RemoteObject is a card stored on a server.
+type RemoteObject struct {
+	Href string // the URL path of the object
+	ETag string // the entity tag of the object, without quotes
+	Card *vcard.Card
+}
+
+// StatusError is the error returned when a server responds with an
+// unexpected status code.
+type StatusError struct {
+	Method string
+	Href   string
+	Status string // the status line of the response, such as "500 Internal Server Error"
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("carddav: %v %v: %v", e.Method, e.Href, e.Status)
+}
+
+// NewClient returns a new client for the server at the given URL, which is
+// used as the starting point of discovery and to resolve relative paths.
+func NewClient(endpoint string) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{http: http.DefaultClient, endpoint: u}, nil
+}
+
+// SetHTTPClient sets the HTTP client used to make requests, which is
+// http.DefaultClient by default.
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.http = client
+}
+
+// SetBasicAuth sets the username and password used to authenticate each
+// request with HTTP basic authentication.
+func (c *Client) SetBasicAuth(username, password string) {
+	c.username, c.password = username, password
+}
+
+// request makes a request to the resource at the given path (or URL), which
+// is resolved relative to the endpoint. The remaining arguments are pairs of
+// header names and values; headers with empty values are omitted.
+func (c *Client) request(method, href, body string, header ...string) (*http.Response, error) {
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, c.endpoint.ResolveReference(ref).String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i+1] != "" {
+			req.Header.Set(header[i], header[i+1])
+		}
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.http.Do(req)
+}
+
+// statusError returns the error for an unexpected response, consuming and
+// closing its body. Responses with the status codes 404 and 412 result in
+// ErrNotFound and ErrPreconditionFailed, and a 403 response because of an
+// invalid sync token results in ErrInvalidSyncToken.
+func statusError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	case resp.StatusCode == http.StatusForbidden && bytes.Contains(body, []byte("valid-sync-token")):
+		return ErrInvalidSyncToken
+	}
+	return &StatusError{resp.Request.Method, resp.Request.URL.Path, resp.Status}
+}
+
+// multistatus makes a request expecting a 207 (Multi-Status) response.
+func (c *Client) multistatus(method, href, depth, body string) (*multistatus, error) {
+	resp, err := c.request(method, href, body, "Depth", depth)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError(resp)
+	}
+	defer resp.Body.Close()
+	ms := new(multistatus)
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, fmt.Errorf("carddav: invalid response to %v %v: %w", method, href, err)
+	}
+	for i := range ms.Responses {
+		// Servers may give hrefs as full URLs, but only the paths are
+		// used by this package.
+		if u, err := url.Parse(ms.Responses[i].Href); err == nil && u.Path != "" {
+			ms.Responses[i].Href = u.Path
+		}
+	}
+	return ms, nil
+}
+
+// prop returns the value of a property of a response with the status 200, or
+// nil if there is none.
+func (r *response) prop(space, local string) *node {
+	for i := range r.Propstats {
+		if !strings.Contains(r.Propstats[i].Status, " 200 ") {
+			continue
+		}
+		values := r.Propstats[i].Prop.Values
+		for j := range values {
+			if values[j].is(space, local) {
+				return &values[j]
+			}
+		}
+	}
+	return nil
+}
+
+// propfind returns the body of a PROPFIND request for the given properties,
+// each of which is a prefixed name using "D" for DAV: and "C" for CardDAV.
+func propfind(props ...string) string {
+	return `<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><D:prop><` +
+		strings.Join(props, "/><") + `/></D:prop></D:propfind>`
+}
+
+// findHref returns the href in the given property of the resource at the
+// given path, or the empty string if it does not have the property.
+func (c *Client) findHref(href, space, local string) (string, error) {
+	prefix := map[string]string{nsDAV: "D:", nsCardDAV: "C:"}[space]
+	ms, err := c.multistatus("PROPFIND", href, "0", propfind(prefix+local))
+	if err != nil {
+		return "", err
+	}
+	for i := range ms.Responses {
+		if prop := ms.Responses[i].prop(space, local); prop != nil {
+			if h := prop.child(nsDAV, "href"); h != nil {
+				u, err := url.Parse(h.content())
+				if err != nil {
+					return "", err
+				}
+				return u.Path, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// FindPrincipal returns the URL path of the principal of the current user,
+// starting from the endpoint. If the server does not report one, the path of
+// the endpoint is returned.
+func (c *Client) FindPrincipal() (string, error) {
+	href, err := c.findHref(c.endpoint.Path, nsDAV, "current-user-principal")
+	if href == "" && err == nil {
+		href = c.endpoint.Path
+	}
+	return href, err
+}
+
+// FindAddressBookHomeSet returns the URL path of the collection containing
+// the address books of the given principal. If the server does not report
+// one, the path of the principal is returned.
+func (c *Client) FindAddressBookHomeSet(principal string) (string, error) {
+	href, err := c.findHref(principal, nsCardDAV, "addressbook-home-set")
+	if href == "" && err == nil {
+		href = principal
+	}
+	return href, err
+}
+
+// FindAddressBooks returns the address books in the given collection (the
+// collection itself is included if it is an address book).
+func (c *Client) FindAddressBooks(home string) ([]AddressBook, error) {
+	ms, err := c.multistatus("PROPFIND", home, "1", propfind("D:resourcetype", "D:displayname", "C:addressbook-description"))
+	if err != nil {
+		return nil, err
+	}
+	var books []AddressBook
+	for i := range ms.Responses {
+		r := &ms.Responses[i]
+		if rt := r.prop(nsDAV, "resourcetype"); rt == nil || rt.child(nsCardDAV, "addressbook") == nil {
+			continue
+		}
+		book := AddressBook{Href: r.Href}
+		if name := r.prop(nsDAV, "displayname"); name != nil {
+			book.Name = name.content()
+		}
+		if desc := r.prop(nsCardDAV, "addressbook-description"); desc != nil {
+			book.Description = desc.content()
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+// Discover returns the address books of the current user, by finding the
+// principal, its address book home set and the address books within it.
+func (c *Client) Discover() ([]AddressBook, error) {
+	principal, err := c.FindPrincipal()
+	if err != nil {
+		return nil, err
+	}
+	home, err := c.FindAddressBookHomeSet(principal)
+	if err != nil {
+		return nil, err
+	}
+	return c.FindAddressBooks(home)
+}
+
+// List returns the objects of an address book, without their cards.
+func (c *Client) List(book string) ([]RemoteObject, error) {
+	ms, err := c.multistatus("PROPFIND", book, "1", propfind("D:resourcetype", "D:getetag"))
+	if err != nil {
+		return nil, err
+	}
+	var objects []RemoteObject
+	for i := range ms.Responses {
+		r := &ms.Responses[i]
+		if rt := r.prop(nsDAV, "resourcetype"); rt != nil && rt.child(nsDAV, "collection") != nil {
+			continue
+		}
+		obj := RemoteObject{Href: r.Href}
+		if etag := r.prop(nsDAV, "getetag"); etag != nil {
+			obj.ETag = unquote(etag.content())
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// Multiget returns the objects of an address book with the given URL paths,
+// using an addressbook-multiget report. Objects which do not exist are
+// omitted from the result.
+func (c *Client) Multiget(book string, hrefs []string) ([]RemoteObject, error) {
+	if len(hrefs) == 0 {
+		return nil, nil
+	}
+	var body strings.Builder
+	body.WriteString(`<C:addressbook-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">`)
+	body.WriteString(`<D:prop><D:getetag/><C:address-data/></D:prop>`)
+	for _, href := range hrefs {
+		body.WriteString("<D:href>")
+		xml.EscapeText(&body, []byte(href))
+		body.WriteString("</D:href>")
+	}
+	body.WriteString(`</C:addressbook-multiget>`)
+	// RFC 6352, section 8.7 says that clients should not send a Depth
+	// header with this report.
+	ms, err := c.multistatus("REPORT", book, "", body.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []RemoteObject
+	for i := range ms.Responses {
+		r := &ms.Responses[i]
+		data := r.prop(nsCardDAV, "address-data")
+		if data == nil {
+			continue
+		}
+		obj := RemoteObject{Href: r.Href}
+		if etag := r.prop(nsDAV, "getetag"); etag != nil {
+			obj.ETag = unquote(etag.content())
+		}
+		if obj.Card, err = readCard(strings.NewReader(data.Text)); err != nil {
+			return nil, fmt.Errorf("carddav: %v: %w", r.Href, err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// Sync returns the objects of an address book which have been created or
+// modified and the URL paths of those which have been deleted since the
+// given sync token was returned, along with a new sync token, using a
+// sync-collection report (RFC 6578). If the token is empty, all the objects
+// are returned. If the server no longer accepts the token, the error is
+// ErrInvalidSyncToken, and the client should start again with an empty
+// token.
+func (c *Client) Sync(book, token string) (changed []RemoteObject, deleted []string, newToken string, err error) {
+	var body strings.Builder
+	body.WriteString(`<D:sync-collection xmlns:D="DAV:"><D:sync-token>`)
+	xml.EscapeText(&body, []byte(token))
+	body.WriteString(`</D:sync-token><D:sync-level>1</D:sync-level><D:prop><D:getetag/></D:prop></D:sync-collection>`)
+	// RFC 6578, section 3.2 requires a Depth of 0.
+	ms, err := c.multistatus("REPORT", book, "0", body.String())
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// The cards are fetched separately, since not all servers support
+	// returning them in the sync-collection report.
+	var hrefs []string
+	for i := range ms.Responses {
+		r := &ms.Responses[i]
+		if strings.Contains(r.Status, " 404 ") {
+			deleted = append(deleted, r.Href)
+		} else if r.Href != book {
+			hrefs = append(hrefs, r.Href)
+		}
+	}
+	if changed, err = c.Multiget(book, hrefs); err != nil {
+		return nil, nil, "", err
+	}
+	return changed, deleted, ms.SyncToken, nil
+}
+
+// Get returns the object at the given URL path.
+func (c *Client) Get(href string) (*RemoteObject, error) {
+	resp, err := c.request("GET", href, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	defer resp.Body.Close()
+	card, err := readCard(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("carddav: %v: %w", href, err)
+	}
+	return &RemoteObject{Href: href, ETag: unquote(resp.Header.Get("ETag")), Card: card}, nil
+}
+
+// Put stores a card at the given URL path, returning its new entity tag (or
+// the empty string if the server does not report one). If etag is empty, the
+// object must not already exist; otherwise, it must exist with the given
+// entity tag. If this condition does not hold, because the object has been
+// changed by someone else, the error is ErrPreconditionFailed.
+func (c *Client) Put(href string, card *vcard.Card, etag string) (string, error) {
+	header := []string{"Content-Type", "text/vcard; charset=utf-8", "If-None-Match", "*"}
+	if etag != "" {
+		header = []string{header[0], header[1], "If-Match", `"` + etag + `"`}
+	}
+	resp, err := c.request("PUT", href, card.String(), header...)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+	resp.Body.Close()
+	return unquote(resp.Header.Get("ETag")), nil
+}
+
+// Delete deletes the object at the given URL path. If etag is not empty, the
+// object must have the given entity tag, or the error is
+// ErrPreconditionFailed.
+func (c *Client) Delete(href, etag string) error {
+	var header []string
+	if etag != "" {
+		header = []string{"If-Match", `"` + etag + `"`}
+	}
+	resp, err := c.request("DELETE", href, "", header...)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// unquote returns an entity tag without quotes (or the "W/" prefix of weak
+// tags).
+func unquote(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
@@ -0,0 +1,224 @@
+package carddav
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestClient returns a client of a test server, with its endpoint at the
+// root of the server rather than the address book.
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	srv := newTestServer(t)
+	c, err := NewClient(srv.URL + "/contacts/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientDiscover(t *testing.T) {
+	c := newTestClient(t)
+	books, err := c.Discover()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []AddressBook{{Href: "/contacts/", Name: "Contacts"}}
+	if !reflect.DeepEqual(books, want) {
+		t.Errorf("got %+v, want %+v", books, want)
+	}
+}
+
+func TestClientListAndMultiget(t *testing.T) {
+	c := newTestClient(t)
+	objects, err := c.List("/contacts/")
+	if err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	var hrefs []string
+	for _, obj := range objects {
+		if obj.ETag == "" || obj.Card != nil {
+			t.Errorf("List: got object %+v", obj)
+		}
+		hrefs = append(hrefs, obj.Href)
+	}
+	if want := []string{"/contacts/jane.vcf", "/contacts/john.vcf"}; !reflect.DeepEqual(hrefs, want) {
+		t.Fatalf("List: got %q, want %q", hrefs, want)
+	}
+
+	fetched, err := c.Multiget("/contacts/", append(hrefs, "/contacts/missing.vcf"))
+	if err != nil {
+		t.Fatalf("Multiget: unexpected error: %v", err)
+	}
+	if len(fetched) != 2 {
+		t.Fatalf("Multiget: got %v objects, want 2", len(fetched))
+	}
+	for i, obj := range fetched {
+		if obj.Href != objects[i].Href || obj.ETag != objects[i].ETag || obj.Card == nil {
+			t.Errorf("Multiget: got %+v, want %+v", obj, objects[i])
+		}
+	}
+	if fn := fetched[1].Card.FormattedName(); fn != "John Doe" {
+		t.Errorf("Multiget: got FN %q", fn)
+	}
+}
+
+func TestClientPutDelete(t *testing.T) {
+	c := newTestClient(t)
+	john, err := c.Get("/contacts/john.vcf")
+	if err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if _, err := c.Get("/contacts/missing.vcf"); err != ErrNotFound {
+		t.Errorf("Get missing: got error %v", err)
+	}
+
+	john.Card.SetFormattedName("Johnny Doe")
+	// The server stores cards re-serialized, so it does not report the
+	// new entity tag.
+	if etag, err := c.Put(john.Href, john.Card, john.ETag); err != nil || etag != "" {
+		t.Fatalf("Put: got ETag %q, error %v", etag, err)
+	}
+	updated, err := c.Get(john.Href)
+	if err != nil || updated.ETag == john.ETag || updated.Card.FormattedName() != "Johnny Doe" {
+		t.Fatalf("Get after Put: got %+v, error %v", updated, err)
+	}
+	etag := updated.ETag
+	// Using the old ETag is a conflict, since the card has changed.
+	if _, err := c.Put(john.Href, john.Card, john.ETag); err != ErrPreconditionFailed {
+		t.Errorf("Put with stale ETag: got error %v", err)
+	}
+	// Creating a card which already exists is also a conflict.
+	if _, err := c.Put(john.Href, john.Card, ""); err != ErrPreconditionFailed {
+		t.Errorf("Put existing: got error %v", err)
+	}
+
+	john.Card.SetUID("urn:uuid:3")
+	if _, err := c.Put("/contacts/new.vcf", john.Card, ""); err != nil {
+		t.Errorf("Put new: unexpected error: %v", err)
+	}
+	john.Card.SetUID("urn:uuid:2")
+	var serr *StatusError
+	if _, err := c.Put("/contacts/other.vcf", john.Card, ""); !errors.As(err, &serr) || !strings.HasPrefix(serr.Status, "403") {
+		t.Errorf("Put with conflicting UID: got error %v", err)
+	}
+
+	if err := c.Delete(john.Href, john.ETag); err != ErrPreconditionFailed {
+		t.Errorf("Delete with stale ETag: got error %v", err)
+	}
+	if err := c.Delete(john.Href, etag); err != nil {
+		t.Errorf("Delete: unexpected error: %v", err)
+	}
+	if err := c.Delete(john.Href, ""); err != ErrNotFound {
+		t.Errorf("Delete missing: got error %v", err)
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	c := newTestClient(t)
+	changed, deleted, token, err := c.Sync("/contacts/", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changed) != 2 || len(deleted) != 0 || token == "" {
+		t.Fatalf("initial sync: got %v changed, deleted %q, token %q", len(changed), deleted, token)
+	}
+
+	jane, _ := c.Get("/contacts/jane.vcf")
+	jane.Card.SetFormattedName("Jane Q. Roe")
+	if _, err := c.Put(jane.Href, jane.Card, jane.ETag); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("/contacts/john.vcf", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, deleted, token2, err := c.Sync("/contacts/", token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changed) != 1 || changed[0].Card.FormattedName() != "Jane Q. Roe" {
+		t.Errorf("got changed %+v", changed)
+	}
+	if !reflect.DeepEqual(deleted, []string{"/contacts/john.vcf"}) {
+		t.Errorf("got deleted %q", deleted)
+	}
+	if changed, deleted, _, _ := c.Sync("/contacts/", token2); len(changed) != 0 || len(deleted) != 0 {
+		t.Errorf("sync without changes: got changed %+v, deleted %q", changed, deleted)
+	}
+	if _, _, _, err := c.Sync("/contacts/", "data:,bogus"); err != ErrInvalidSyncToken {
+		t.Errorf("invalid token: got error %v", err)
+	}
+}
+
+func TestClientReportDepth(t *testing.T) {
+	store := NewMemoryStore()
+	if _, _, err := store.Put("john.vcf", parseCard(t, johnVCard), Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(store, "/")
+	depths := make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "REPORT" {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			for _, report := range []string{"addressbook-multiget", "sync-collection"} {
+				if bytes.Contains(body, []byte(report)) {
+					depths[report] = r.Header["Depth"]
+				}
+			}
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := c.Sync("/", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string][]string{"addressbook-multiget": nil, "sync-collection": {"0"}}
+	if !reflect.DeepEqual(depths, want) {
+		t.Errorf("got Depth headers %q, want %q", depths, want)
+	}
+}
+
+func TestClientBasicAuth(t *testing.T) {
+	h := NewHandler(NewMemoryStore(), "/")
+	var users []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || pass != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		users = append(users, user)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serr *StatusError
+	if _, err := c.Discover(); !errors.As(err, &serr) || !strings.HasPrefix(serr.Status, "401") {
+		t.Errorf("without credentials: got error %v", err)
+	}
+	c.SetBasicAuth("user", "secret")
+	books, err := c.Discover()
+	if err != nil || len(books) != 1 || books[0].Href != "/" {
+		t.Errorf("got %+v, error %v", books, err)
+	}
+	if len(users) == 0 || users[0] != "user" {
+		t.Errorf("got users %q", users)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package carddav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ianprime0509/vcard"
+)
+
+// FileStore is a Store which keeps each object in a file of a directory.
+// Only files whose names end in ".vcf" are objects, and each must contain
+// exactly one card. Files which do not are left out of List and Changes (so
+// that one bad file does not hide the rest of the address book), and Get
+// returns an error for them.
+//
+// Changes made to the directory by other programs are seen by the store,
+// but the preconditions of changes are only checked atomically with respect
+// to other changes made through the same FileStore.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+	log *syncLog
+}
+
+// NewFileStore returns a new FileStore using the given directory, which must
+// already exist.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir, log: newSyncLog()}
+}
+
+// path returns the path of the file of the object with the given name, or
+// ErrNotFound if the name is not that of an object.
+func (s *FileStore) path(name string) (string, error) {
+	if !strings.HasSuffix(name, ".vcf") || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// List implements Store. The objects are sorted by name.
+func (s *FileStore) List() ([]Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *FileStore) list() ([]Object, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		obj, err := s.get(entry.Name())
+		var invalid *invalidFileError
+		if err == ErrNotFound || errors.As(err, &invalid) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *obj)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+// invalidFileError is returned when the file of an object does not contain
+// a single valid card.
+type invalidFileError struct {
+	path string
+	err  error
+}
+
+func (e *invalidFileError) Error() string {
+	return fmt.Sprintf("carddav: %v: %v", e.path, e.err)
+}
+
+func (e *invalidFileError) Unwrap() error {
+	return e.err
+}
+
+// Get implements Store.
+func (s *FileStore) Get(name string) (*Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(name)
+}
+
+func (s *FileStore) get(name string) (*Object, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	card, err := readCard(bytes.NewReader(data))
+	if err != nil {
+		return nil, &invalidFileError{path, err}
+	}
+	return &Object{
+		Name:    name,
+		ETag:    ETag(data),
+		ModTime: info.ModTime(),
+		Card:    card,
+	}, nil
+}
+
+// Put implements Store. The file is replaced atomically, by writing the card
+// to a temporary file and renaming it. Checking the UID of the card requires
+// reading all the other objects.
+func (s *FileStore) Put(name string, card *vcard.Card, cond Precondition) (*Object, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path, err := s.path(name)
+	if err != nil {
+		return nil, false, fmt.Errorf("carddav: invalid object name %q", name)
+	}
+	current, err := s.get(name)
+	if err == ErrNotFound {
+		current = nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if err := cond.Check(current); err != nil {
+		return nil, false, err
+	}
+	// The directory may have been changed by other programs, so the UIDs of
+	// the other objects cannot be indexed and must be read each time.
+	if uid := card.UID(); uid != "" {
+		objects, err := s.list()
+		if err != nil {
+			return nil, false, err
+		}
+		for _, obj := range objects {
+			if obj.Name != name && obj.Card.UID() == uid {
+				return nil, false, &UIDConflictError{Name: obj.Name}
+			}
+		}
+	}
+
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return nil, false, err
+	}
+	_, err = f.WriteString(card.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, false, err
+	}
+	obj, err := s.get(name)
+	return obj, current == nil, err
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(name string, cond Precondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, err := s.get(name)
+	if err != nil {
+		return err
+	}
+	if err := cond.Check(current); err != nil {
+		return err
+	}
+	path, _ := s.path(name)
+	return os.Remove(path)
+}
+
+// Changes implements Store.
+func (s *FileStore) Changes(token string) ([]Object, []string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, err := s.list()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return s.log.changes(objects, token)
+}
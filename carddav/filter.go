@@ -0,0 +1,90 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package carddav
+
+import (
+	"errors"
+
+	"github.com/ianprime0509/vcard"
+)
+
+// errUnsupportedCollation is returned when parsing a filter using a
+// collation other than "i;unicode-casemap", "i;ascii-casemap" or "i;octet".
+var errUnsupportedCollation = errors.New("carddav: unsupported collation")
+
+// errUnsupportedFilter is returned when parsing a filter using a match type
+// other than those in matchTypes.
+var errUnsupportedFilter = errors.New("carddav: unsupported filter")
+
+// matchTypes maps the values of the match-type attribute to match types.
+var matchTypes = map[string]vcard.MatchType{
+	"":            vcard.MatchContains,
+	"contains":    vcard.MatchContains,
+	"equals":      vcard.MatchEquals,
+	"starts-with": vcard.MatchStartsWith,
+	"ends-with":   vcard.MatchEndsWith,
+}
+
+// parseFilter parses the CARDDAV:filter element of an addressbook-query
+// report (RFC 6352, section 10.5).
+func parseFilter(n *node) (*vcard.Filter, error) {
+	f := &vcard.Filter{AllOf: n.attr("test") == "allof"}
+	for i := range n.Children {
+		c := &n.Children[i]
+		if !c.is(nsCardDAV, "prop-filter") {
+			continue
+		}
+		pf := vcard.PropFilter{Name: c.attr("name"), AllOf: c.attr("test") == "allof"}
+		for j := range c.Children {
+			cc := &c.Children[j]
+			switch {
+			case cc.is(nsCardDAV, "is-not-defined"):
+				pf.IsNotDefined = true
+			case cc.is(nsCardDAV, "text-match"):
+				tm, err := parseTextMatch(cc)
+				if err != nil {
+					return nil, err
+				}
+				pf.Texts = append(pf.Texts, *tm)
+			case cc.is(nsCardDAV, "param-filter"):
+				pmf := vcard.ParamFilter{Name: cc.attr("name")}
+				if cc.child(nsCardDAV, "is-not-defined") != nil {
+					pmf.IsNotDefined = true
+				} else if tmn := cc.child(nsCardDAV, "text-match"); tmn != nil {
+					tm, err := parseTextMatch(tmn)
+					if err != nil {
+						return nil, err
+					}
+					pmf.Text = tm
+				}
+				pf.Params = append(pf.Params, pmf)
+			}
+		}
+		f.Props = append(f.Props, pf)
+	}
+	return f, nil
+}
+
+// parseTextMatch parses a CARDDAV:text-match element.
+func parseTextMatch(n *node) (*vcard.TextMatch, error) {
+	tm := &vcard.TextMatch{
+		Text:      n.Text,
+		Collation: vcard.Collation(n.attr("collation")),
+		Negate:    n.attr("negate-condition") == "yes",
+	}
+	var ok bool
+	if tm.MatchType, ok = matchTypes[n.attr("match-type")]; !ok {
+		return nil, errUnsupportedFilter
+	}
+	switch tm.Collation {
+	case "", vcard.CollationUnicodeCasemap, vcard.CollationASCIICasemap, vcard.CollationOctet:
+	default:
+		return nil, errUnsupportedCollation
+	}
+	return tm, nil
+}
@@ -0,0 +1,620 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ianprime0509/vcard"
+)
+
+// vcardType is the media type of the bodies of objects.
+const vcardType = "text/vcard; charset=utf-8"
+
+// allowedMethods is the value of the Allow header.
+const allowedMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+
+// Handler is an http.Handler serving a single address book over CardDAV.
+//
+// The address book is at a fixed path, its prefix, and each object of the
+// store is a resource at the prefix followed by the name of the object. The
+// address book is also reported as the principal URL and address book home
+// set, so that clients can discover it starting from its own URL. Handler
+// does no authentication.
+type Handler struct {
+	store       Store
+	prefix      string
+	name        string
+	description string
+}
+
+// NewHandler returns a new handler serving the objects of the given store as
+// an address book at the given path, such as "/contacts/".
+func NewHandler(store Store, prefix string) *Handler {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Handler{store: store, prefix: prefix}
+}
+
+// SetDisplayName sets the name of the address book, which is reported in the
+// DAV:displayname property.
+func (h *Handler) SetDisplayName(name string) {
+	h.name = name
+}
+
+// SetDescription sets the description of the address book, which is
+// reported in the CARDDAV:addressbook-description property.
+func (h *Handler) SetDescription(description string) {
+	h.description = description
+}
+
+// httpError is an error resulting in a response with a particular status
+// code. If a condition is given, the body of the response is a DAV:error
+// element (RFC 4918, section 16) containing it.
+type httpError struct {
+	code      int
+	condition *node
+	msg       string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+// conditionError returns an error for a failed precondition of a request.
+func conditionError(space, local string, children ...node) error {
+	cond := newNode(space, local, children...)
+	return &httpError{http.StatusForbidden, &cond, "precondition " + local + " failed"}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := h.resource(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var err error
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1, 3, addressbook")
+		w.Header().Set("Allow", allowedMethods)
+	case "PROPFIND":
+		err = h.propfind(w, r, name)
+	case "REPORT":
+		err = h.report(w, r, name)
+	case "GET", "HEAD":
+		err = h.get(w, r, name)
+	case "PUT":
+		err = h.put(w, r, name)
+	case "DELETE":
+		err = h.delete(w, r, name)
+	default:
+		err = &httpError{http.StatusMethodNotAllowed, nil, "method not allowed"}
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+// writeError writes the response for an error.
+func writeError(w http.ResponseWriter, err error) {
+	var herr *httpError
+	switch {
+	case errors.As(err, &herr):
+	case errors.Is(err, ErrNotFound):
+		herr = &httpError{http.StatusNotFound, nil, "not found"}
+	case errors.Is(err, ErrPreconditionFailed):
+		herr = &httpError{http.StatusPreconditionFailed, nil, "precondition failed"}
+	default:
+		herr = &httpError{http.StatusInternalServerError, nil, err.Error()}
+	}
+	if herr.code == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", allowedMethods)
+	}
+	if herr.condition == nil {
+		http.Error(w, herr.msg, herr.code)
+		return
+	}
+	data, _ := xml.Marshal(newNode(nsDAV, "error", *herr.condition))
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(herr.code)
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+}
+
+// resource returns the name of the object at the given path, or the empty
+// string for the address book itself. The result ok is false if the path is
+// not that of a resource of the address book.
+func (h *Handler) resource(path string) (name string, ok bool) {
+	if path == h.prefix || path+"/" == h.prefix {
+		return "", true
+	}
+	if !strings.HasPrefix(path, h.prefix) {
+		return "", false
+	}
+	name = path[len(h.prefix):]
+	return name, !strings.Contains(name, "/")
+}
+
+// href returns the URL path of the object with the given name.
+func (h *Handler) href(name string) string {
+	return h.prefix + url.PathEscape(name)
+}
+
+// parseBody parses the XML body of a request, returning nil if it is empty.
+func parseBody(r *http.Request) (*node, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	n := new(node)
+	if err := xml.Unmarshal(data, n); err != nil {
+		return nil, &httpError{http.StatusBadRequest, nil, "invalid XML body: " + err.Error()}
+	}
+	return n, nil
+}
+
+// selection is the set of properties requested by a PROPFIND or REPORT
+// request.
+type selection struct {
+	all   bool   // whether all properties were requested (DAV:allprop)
+	names bool   // whether only the names were requested (DAV:propname)
+	props []node // the requested properties, otherwise
+}
+
+// parseSelection parses the selection of properties in the children of the
+// root element of a request.
+func parseSelection(root *node) selection {
+	if root == nil || root.child(nsDAV, "allprop") != nil {
+		return selection{all: true}
+	}
+	if root.child(nsDAV, "propname") != nil {
+		return selection{names: true}
+	}
+	if prop := root.child(nsDAV, "prop"); prop != nil {
+		return selection{props: prop.Children}
+	}
+	return selection{all: true}
+}
+
+// property is a property of a resource.
+type property struct {
+	space, local string
+	hidden       bool // whether the property is omitted from DAV:allprop
+	// value returns the value of the property, given the element which
+	// requested it (which is nil for DAV:allprop).
+	value func(req *node) (node, error)
+}
+
+// respond returns the response for a resource with the given properties.
+func respond(href string, properties []property, sel selection) (response, error) {
+	resp := response{Href: href}
+	found := propstat{Status: status(http.StatusOK)}
+	missing := propstat{Status: status(http.StatusNotFound)}
+	for _, p := range properties {
+		switch {
+		case sel.names:
+			found.Prop.Values = append(found.Prop.Values, newNode(p.space, p.local))
+		case sel.all && !p.hidden:
+			value, err := p.value(nil)
+			if err != nil {
+				return resp, err
+			}
+			found.Prop.Values = append(found.Prop.Values, value)
+		}
+	}
+	for i := range sel.props {
+		req := &sel.props[i]
+		var p *property
+		for j := range properties {
+			if req.is(properties[j].space, properties[j].local) {
+				p = &properties[j]
+			}
+		}
+		if p == nil {
+			missing.Prop.Values = append(missing.Prop.Values, newNode(req.XMLName.Space, req.XMLName.Local))
+			continue
+		}
+		value, err := p.value(req)
+		if err != nil {
+			return resp, err
+		}
+		found.Prop.Values = append(found.Prop.Values, value)
+	}
+	if len(found.Prop.Values) > 0 || len(missing.Prop.Values) == 0 {
+		resp.Propstats = append(resp.Propstats, found)
+	}
+	if len(missing.Prop.Values) > 0 {
+		resp.Propstats = append(resp.Propstats, missing)
+	}
+	return resp, nil
+}
+
+// constant returns a property with a constant value.
+func constant(space, local string, value node) property {
+	value.XMLName = xml.Name{Space: space, Local: local}
+	return property{space: space, local: local, value: func(*node) (node, error) { return value, nil }}
+}
+
+// collectionProperties returns the properties of the address book.
+func (h *Handler) collectionProperties() []property {
+	href := textNode(nsDAV, "href", h.prefix)
+	dataType := func(version string) node {
+		n := newNode(nsCardDAV, "address-data-type")
+		n.Attrs = []xml.Attr{{Name: xml.Name{Local: "content-type"}, Value: "text/vcard"}, {Name: xml.Name{Local: "version"}, Value: version}}
+		return n
+	}
+	report := func(space, local string) node {
+		return newNode(nsDAV, "supported-report", newNode(nsDAV, "report", newNode(space, local)))
+	}
+	properties := []property{
+		constant(nsDAV, "resourcetype", newNode("", "", newNode(nsDAV, "collection"), newNode(nsCardDAV, "addressbook"))),
+		constant(nsDAV, "current-user-principal", newNode("", "", href)),
+		constant(nsCardDAV, "addressbook-home-set", newNode("", "", href)),
+		constant(nsCardDAV, "supported-address-data", newNode("", "", dataType("3.0"), dataType("4.0"))),
+		constant(nsDAV, "supported-report-set", newNode("", "",
+			report(nsCardDAV, "addressbook-query"),
+			report(nsCardDAV, "addressbook-multiget"),
+			report(nsDAV, "sync-collection"),
+		)),
+		{space: nsDAV, local: "sync-token", hidden: true, value: func(*node) (node, error) {
+			_, _, token, err := h.store.Changes("")
+			return textNode(nsDAV, "sync-token", token), err
+		}},
+	}
+	if h.name != "" {
+		properties = append(properties, constant(nsDAV, "displayname", textNode("", "", h.name)))
+	}
+	if h.description != "" {
+		properties = append(properties, constant(nsCardDAV, "addressbook-description", textNode("", "", h.description)))
+	}
+	return properties
+}
+
+// objectProperties returns the properties of an object.
+func objectProperties(obj *Object) []property {
+	data := obj.Card.String()
+	return []property{
+		constant(nsDAV, "resourcetype", node{}),
+		constant(nsDAV, "getetag", textNode("", "", `"`+obj.ETag+`"`)),
+		constant(nsDAV, "getcontenttype", textNode("", "", vcardType)),
+		constant(nsDAV, "getcontentlength", textNode("", "", strconv.Itoa(len(data)))),
+		constant(nsDAV, "getlastmodified", textNode("", "", obj.ModTime.UTC().Format(http.TimeFormat))),
+		{space: nsCardDAV, local: "address-data", hidden: true, value: func(req *node) (node, error) {
+			return textNode(nsCardDAV, "address-data", addressData(obj.Card, req)), nil
+		}},
+	}
+}
+
+// addressData returns the contents of a card as requested by a
+// CARDDAV:address-data element, which may limit the properties included
+// using CARDDAV:prop elements.
+func addressData(card *vcard.Card, req *node) string {
+	if req == nil || req.child(nsCardDAV, "prop") == nil {
+		return card.String()
+	}
+	subset := new(vcard.Card)
+	names := []string{"VERSION"}
+	for _, child := range req.Children {
+		if child.is(nsCardDAV, "prop") && !strings.EqualFold(child.attr("name"), "VERSION") {
+			names = append(names, child.attr("name"))
+		}
+	}
+	for _, name := range names {
+		for _, prop := range card.Get(name) {
+			subset.Add(name, prop)
+		}
+	}
+	return subset.String()
+}
+
+// writeMultistatus writes a 207 (Multi-Status) response.
+func writeMultistatus(w http.ResponseWriter, ms *multistatus) error {
+	data, err := xml.Marshal(ms)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, xml.Header)
+	_, err = w.Write(data)
+	return err
+}
+
+// propfind handles a PROPFIND request. A Depth of "infinity" (the default) is
+// treated as "1", since the address book contains no further collections.
+func (h *Handler) propfind(w http.ResponseWriter, r *http.Request, name string) error {
+	root, err := parseBody(r)
+	if err != nil {
+		return err
+	}
+	if root != nil && !root.is(nsDAV, "propfind") {
+		return &httpError{http.StatusBadRequest, nil, "expected DAV:propfind element"}
+	}
+	sel := parseSelection(root)
+
+	ms := new(multistatus)
+	if name != "" {
+		obj, err := h.store.Get(name)
+		if err != nil {
+			return err
+		}
+		resp, err := respond(h.href(name), objectProperties(obj), sel)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+		return writeMultistatus(w, ms)
+	}
+
+	resp, err := respond(h.prefix, h.collectionProperties(), sel)
+	if err != nil {
+		return err
+	}
+	ms.Responses = append(ms.Responses, resp)
+	if r.Header.Get("Depth") != "0" {
+		objects, err := h.store.List()
+		if err != nil {
+			return err
+		}
+		for i := range objects {
+			resp, err := respond(h.href(objects[i].Name), objectProperties(&objects[i]), sel)
+			if err != nil {
+				return err
+			}
+			ms.Responses = append(ms.Responses, resp)
+		}
+	}
+	return writeMultistatus(w, ms)
+}
+
+// report handles a REPORT request, which must be made on the address book.
+func (h *Handler) report(w http.ResponseWriter, r *http.Request, name string) error {
+	root, err := parseBody(r)
+	if err != nil {
+		return err
+	}
+	switch {
+	case root == nil:
+		return &httpError{http.StatusBadRequest, nil, "missing report body"}
+	case name != "":
+		return conditionError(nsDAV, "supported-report")
+	case root.is(nsCardDAV, "addressbook-query"):
+		return h.query(w, root)
+	case root.is(nsCardDAV, "addressbook-multiget"):
+		return h.multiget(w, root)
+	case root.is(nsDAV, "sync-collection"):
+		return h.sync(w, root)
+	}
+	return conditionError(nsDAV, "supported-report")
+}
+
+// query handles an addressbook-query report.
+func (h *Handler) query(w http.ResponseWriter, root *node) error {
+	sel := parseSelection(root)
+	f := new(vcard.Filter)
+	if n := root.child(nsCardDAV, "filter"); n != nil {
+		var err error
+		if f, err = parseFilter(n); err == errUnsupportedCollation {
+			return conditionError(nsCardDAV, "supported-collation")
+		} else if err == errUnsupportedFilter {
+			return conditionError(nsCardDAV, "supported-filter")
+		} else if err != nil {
+			return err
+		}
+	}
+	limit := -1
+	if n := root.child(nsCardDAV, "limit"); n != nil {
+		if nresults := n.child(nsCardDAV, "nresults"); nresults != nil {
+			if l, err := strconv.Atoi(nresults.content()); err == nil && l >= 0 {
+				limit = l
+			}
+		}
+	}
+
+	objects, err := h.store.List()
+	if err != nil {
+		return err
+	}
+	ms := new(multistatus)
+	for i := range objects {
+		if !f.Match(objects[i].Card) {
+			continue
+		}
+		if len(ms.Responses) == limit {
+			// The results were truncated (RFC 6352, section 8.6.1).
+			ms.Responses = append(ms.Responses, response{Href: h.prefix, Status: status(http.StatusInsufficientStorage)})
+			break
+		}
+		resp, err := respond(h.href(objects[i].Name), objectProperties(&objects[i]), sel)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+	}
+	return writeMultistatus(w, ms)
+}
+
+// multiget handles an addressbook-multiget report.
+func (h *Handler) multiget(w http.ResponseWriter, root *node) error {
+	sel := parseSelection(root)
+	ms := new(multistatus)
+	for _, child := range root.Children {
+		if !child.is(nsDAV, "href") {
+			continue
+		}
+		href := child.content()
+		var obj *Object
+		u, err := url.Parse(href)
+		if err != nil {
+			err = ErrNotFound
+		} else if name, ok := h.resource(u.Path); ok && name != "" {
+			obj, err = h.store.Get(name)
+		} else {
+			err = ErrNotFound
+		}
+		if errors.Is(err, ErrNotFound) {
+			ms.Responses = append(ms.Responses, response{Href: href, Status: status(http.StatusNotFound)})
+			continue
+		} else if err != nil {
+			return err
+		}
+		resp, err := respond(href, objectProperties(obj), sel)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+	}
+	return writeMultistatus(w, ms)
+}
+
+// sync handles a sync-collection report (RFC 6578).
+func (h *Handler) sync(w http.ResponseWriter, root *node) error {
+	sel := parseSelection(root)
+	var token string
+	if n := root.child(nsDAV, "sync-token"); n != nil {
+		token = n.content()
+	}
+	changed, deleted, newToken, err := h.store.Changes(token)
+	if err == ErrInvalidSyncToken {
+		return conditionError(nsDAV, "valid-sync-token")
+	} else if err != nil {
+		return err
+	}
+
+	ms := &multistatus{SyncToken: newToken}
+	for i := range changed {
+		resp, err := respond(h.href(changed[i].Name), objectProperties(&changed[i]), sel)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, resp)
+	}
+	for _, name := range deleted {
+		ms.Responses = append(ms.Responses, response{Href: h.href(name), Status: status(http.StatusNotFound)})
+	}
+	return writeMultistatus(w, ms)
+}
+
+// get handles a GET or HEAD request.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, name string) error {
+	if name == "" {
+		return &httpError{http.StatusMethodNotAllowed, nil, "cannot get the address book"}
+	}
+	obj, err := h.store.Get(name)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+obj.ETag+`"`)
+	w.Header().Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	for _, etag := range parseETags(r.Header.Get("If-None-Match")) {
+		if etag == "*" || etag == obj.ETag {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	data := obj.Card.String()
+	w.Header().Set("Content-Type", vcardType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method != "HEAD" {
+		io.WriteString(w, data)
+	}
+	return nil
+}
+
+// put handles a PUT request. The body must contain a single card with a UID
+// which is not used by any other object, and the name must end in ".vcf".
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, name string) error {
+	if name == "" {
+		return &httpError{http.StatusMethodNotAllowed, nil, "cannot replace the address book"}
+	}
+	if !strings.HasSuffix(name, ".vcf") || strings.HasPrefix(name, ".") {
+		return &httpError{http.StatusForbidden, nil, `object names must end in ".vcf"`}
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "text/vcard" && mediaType != "text/x-vcard" {
+			return conditionError(nsCardDAV, "supported-address-data")
+		}
+	}
+	card, err := readCard(r.Body)
+	if err != nil || card.UID() == "" {
+		return conditionError(nsCardDAV, "valid-address-data")
+	}
+
+	_, created, err := h.store.Put(name, card, precondition(r))
+	var conflict *UIDConflictError
+	if errors.As(err, &conflict) {
+		return conditionError(nsCardDAV, "no-uid-conflict", textNode(nsDAV, "href", h.href(conflict.Name)))
+	} else if err != nil {
+		return err
+	}
+	// The card is stored re-serialized rather than byte for byte, so the
+	// entity tag must not be returned (RFC 6352, section 6.3.2.3): the
+	// client has to fetch the object to learn it.
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+// delete handles a DELETE request.
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, name string) error {
+	if name == "" {
+		return &httpError{http.StatusMethodNotAllowed, nil, "cannot delete the address book"}
+	}
+	if err := h.store.Delete(name, precondition(r)); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// precondition returns the precondition given by the If-Match and
+// If-None-Match headers of a request.
+func precondition(r *http.Request) Precondition {
+	var cond Precondition
+	if header := r.Header.Get("If-Match"); header != "" {
+		cond.IfMatch = parseETags(header)
+		if len(cond.IfMatch) == 0 {
+			// Only weak tags were given, which never match.
+			cond.IfMatch = []string{""}
+		}
+	}
+	cond.IfNoneMatch = strings.TrimSpace(r.Header.Get("If-None-Match")) == "*"
+	return cond
+}
+
+// parseETags parses a list of entity tags, as in the If-Match header,
+// returning them without quotes. Weak tags are ignored.
+func parseETags(header string) []string {
+	var etags []string
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" {
+			etags = append(etags, etag)
+		} else if len(etag) >= 2 && etag[0] == '"' && etag[len(etag)-1] == '"' {
+			etags = append(etags, etag[1:len(etag)-1])
+		}
+	}
+	return etags
+}
@@ -0,0 +1,324 @@
+package carddav
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const johnVCard = "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:urn:uuid:1\r\nFN:John Doe\r\nEMAIL;TYPE=work:john@example.com\r\nTEL;TYPE=cell:+1-555-0100\r\nEND:VCARD\r\n"
+const janeVCard = "BEGIN:VCARD\r\nVERSION:4.0\r\nUID:urn:uuid:2\r\nFN:Jane Roe\r\nEMAIL:jane@example.org\r\nEND:VCARD\r\n"
+
+// newTestServer returns a server for an address book at /contacts/
+// containing the cards of John and Jane.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	store := NewMemoryStore()
+	for name, data := range map[string]string{"john.vcf": johnVCard, "jane.vcf": janeVCard} {
+		if _, _, err := store.Put(name, parseCard(t, data), Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewHandler(store, "/contacts")
+	h.SetDisplayName("Contacts")
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do makes a request, returning the response and its body.
+func do(t *testing.T, method, url, body string, header ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+// parseMultistatus parses a multistatus response into a map from each href
+// to the responses with that href.
+func parseMultistatus(t *testing.T, resp *http.Response, body string) (map[string]response, string) {
+	t.Helper()
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("got status %v, want 207: %s", resp.Status, body)
+	}
+	var ms multistatus
+	if err := xml.Unmarshal([]byte(body), &ms); err != nil {
+		t.Fatalf("invalid multistatus %q: %v", body, err)
+	}
+	m := make(map[string]response)
+	for _, r := range ms.Responses {
+		m[r.Href] = r
+	}
+	return m, ms.SyncToken
+}
+
+// propValue returns the text of a property in the 200 propstat of a
+// response.
+func propValue(r response, local string) (string, bool) {
+	for _, ps := range r.Propstats {
+		if !strings.Contains(ps.Status, "200") {
+			continue
+		}
+		for _, v := range ps.Prop.Values {
+			if v.XMLName.Local == local {
+				return v.Text, true
+			}
+		}
+	}
+	return "", false
+}
+
+func TestOptions(t *testing.T) {
+	srv := newTestServer(t)
+	resp, _ := do(t, "OPTIONS", srv.URL+"/contacts/", "")
+	if dav := resp.Header.Get("DAV"); !strings.Contains(dav, "addressbook") {
+		t.Errorf("got DAV header %q", dav)
+	}
+	if resp, _ := do(t, "GET", srv.URL+"/elsewhere/john.vcf", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("outside prefix: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "MKCOL", srv.URL+"/contacts/", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("MKCOL: got status %v", resp.Status)
+	}
+}
+
+func TestPropfind(t *testing.T) {
+	srv := newTestServer(t)
+	const body = `<?xml version="1.0"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+  <D:prop><D:resourcetype/><D:displayname/><D:getetag/><C:addressbook-home-set/><D:quota-used-bytes/></D:prop>
+</D:propfind>`
+	resp, data := do(t, "PROPFIND", srv.URL+"/contacts/", body, "Depth", "1")
+	responses, _ := parseMultistatus(t, resp, data)
+	if len(responses) != 3 {
+		t.Fatalf("got %v responses, want 3: %s", len(responses), data)
+	}
+	collection := responses["/contacts/"]
+	if name, _ := propValue(collection, "displayname"); name != "Contacts" {
+		t.Errorf("got displayname %q", name)
+	}
+	var rt node
+	for _, v := range collection.Propstats[0].Prop.Values {
+		if v.XMLName.Local == "resourcetype" {
+			rt = v
+		}
+	}
+	if rt.child(nsDAV, "collection") == nil || rt.child(nsCardDAV, "addressbook") == nil {
+		t.Errorf("got resourcetype %+v", rt)
+	}
+	if len(collection.Propstats) != 2 || !strings.Contains(collection.Propstats[1].Status, "404") {
+		t.Errorf("got propstats %+v, want missing properties", collection.Propstats)
+	}
+	if etag, ok := propValue(responses["/contacts/john.vcf"], "getetag"); !ok || !strings.HasPrefix(etag, `"`) {
+		t.Errorf("got getetag %q", etag)
+	}
+
+	resp, data = do(t, "PROPFIND", srv.URL+"/contacts/", "", "Depth", "0")
+	if responses, _ := parseMultistatus(t, resp, data); len(responses) != 1 {
+		t.Errorf("Depth 0: got %v responses", len(responses))
+	}
+	resp, data = do(t, "PROPFIND", srv.URL+"/contacts/jane.vcf", "", "Depth", "0")
+	if responses, _ := parseMultistatus(t, resp, data); len(responses) != 1 {
+		t.Errorf("object: got %v responses", len(responses))
+	} else if ct, _ := propValue(responses["/contacts/jane.vcf"], "getcontenttype"); !strings.HasPrefix(ct, "text/vcard") {
+		t.Errorf("got getcontenttype %q", ct)
+	}
+	if resp, _ := do(t, "PROPFIND", srv.URL+"/contacts/", "<not-xml", "Depth", "0"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid body: got status %v", resp.Status)
+	}
+}
+
+func TestGetPutDelete(t *testing.T) {
+	srv := newTestServer(t)
+	resp, body := do(t, "GET", srv.URL+"/contacts/john.vcf", "")
+	if resp.StatusCode != http.StatusOK || body != johnVCard {
+		t.Fatalf("GET: got status %v, body %q", resp.Status, body)
+	}
+	etag := resp.Header.Get("ETag")
+	if resp, _ := do(t, "GET", srv.URL+"/contacts/john.vcf", "", "If-None-Match", etag); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET with If-None-Match: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "GET", srv.URL+"/contacts/missing.vcf", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET missing: got status %v", resp.Status)
+	}
+
+	updated := strings.Replace(johnVCard, "John Doe", "Johnny Doe", 1)
+	if resp, _ := do(t, "PUT", srv.URL+"/contacts/john.vcf", updated, "If-Match", `"wrong"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with wrong If-Match: got status %v", resp.Status)
+	}
+	resp, _ = do(t, "PUT", srv.URL+"/contacts/john.vcf", updated, "If-Match", etag, "Content-Type", "text/vcard")
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("ETag") != "" {
+		t.Errorf("PUT: got status %v, ETag %q", resp.Status, resp.Header.Get("ETag"))
+	}
+	if _, body := do(t, "GET", srv.URL+"/contacts/john.vcf", ""); body != updated {
+		t.Errorf("after PUT: got %q, want %q", body, updated)
+	}
+
+	created := strings.Replace(janeVCard, "urn:uuid:2", "urn:uuid:3", 1)
+	if resp, _ := do(t, "PUT", srv.URL+"/contacts/new.vcf", created, "If-None-Match", "*"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("PUT new: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "PUT", srv.URL+"/contacts/new.vcf", created, "If-None-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT existing with If-None-Match: got status %v", resp.Status)
+	}
+	resp, body = do(t, "PUT", srv.URL+"/contacts/copy.vcf", janeVCard)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "no-uid-conflict") || !strings.Contains(body, "/contacts/jane.vcf") {
+		t.Errorf("PUT with conflicting UID: got status %v, body %q", resp.Status, body)
+	}
+	resp, body = do(t, "PUT", srv.URL+"/contacts/bad.vcf", "BEGIN:VCARD\r\nFN:x\r\n")
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(body, "valid-address-data") {
+		t.Errorf("PUT invalid card: got status %v, body %q", resp.Status, body)
+	}
+	if resp, _ := do(t, "PUT", srv.URL+"/contacts/new.txt", created); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("PUT without .vcf: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "PUT", srv.URL+"/contacts/json.vcf", created, "Content-Type", "application/json"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("PUT with wrong content type: got status %v", resp.Status)
+	}
+
+	if resp, _ := do(t, "DELETE", srv.URL+"/contacts/jane.vcf", "", "If-Match", `"wrong"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with wrong If-Match: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "DELETE", srv.URL+"/contacts/jane.vcf", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "DELETE", srv.URL+"/contacts/jane.vcf", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("DELETE missing: got status %v", resp.Status)
+	}
+}
+
+func TestAddressbookQuery(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		filter string
+		hrefs  []string
+	}{
+		{``, []string{"/contacts/jane.vcf", "/contacts/john.vcf"}},
+		{`<C:filter><C:prop-filter name="EMAIL"><C:text-match match-type="ends-with">@EXAMPLE.COM</C:text-match></C:prop-filter></C:filter>`, []string{"/contacts/john.vcf"}},
+		{`<C:filter><C:prop-filter name="TEL"><C:is-not-defined/></C:prop-filter></C:filter>`, []string{"/contacts/jane.vcf"}},
+		{`<C:filter test="allof"><C:prop-filter name="FN"><C:text-match>doe</C:text-match></C:prop-filter>` +
+			`<C:prop-filter name="TEL"><C:param-filter name="TYPE"><C:text-match match-type="equals">cell</C:text-match></C:param-filter></C:prop-filter></C:filter>`, []string{"/contacts/john.vcf"}},
+		{`<C:filter><C:prop-filter name="FN"><C:text-match negate-condition="yes">Doe</C:text-match></C:prop-filter></C:filter>`, []string{"/contacts/jane.vcf"}},
+	}
+
+	for _, test := range tests {
+		body := `<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">` +
+			`<D:prop><D:getetag/><C:address-data><C:prop name="FN"/></C:address-data></D:prop>` + test.filter + `</C:addressbook-query>`
+		resp, data := do(t, "REPORT", srv.URL+"/contacts/", body, "Depth", "1")
+		responses, _ := parseMultistatus(t, resp, data)
+		if len(responses) != len(test.hrefs) {
+			t.Errorf("%v: got %v responses, want %q", test.filter, len(responses), test.hrefs)
+		}
+		for _, href := range test.hrefs {
+			r, ok := responses[href]
+			if !ok {
+				t.Errorf("%v: missing %v", test.filter, href)
+				continue
+			}
+			if card, _ := propValue(r, "address-data"); !strings.HasPrefix(card, "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:") || strings.Contains(card, "UID") {
+				t.Errorf("%v: got address-data %q", test.filter, card)
+			}
+		}
+	}
+
+	body := `<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav"><D:prop><D:getetag/></D:prop>` +
+		`<C:limit><C:nresults>1</C:nresults></C:limit></C:addressbook-query>`
+	resp, data := do(t, "REPORT", srv.URL+"/contacts/", body)
+	if responses, _ := parseMultistatus(t, resp, data); len(responses) != 2 || !strings.Contains(responses["/contacts/"].Status, "507") {
+		t.Errorf("limit: got %+v", responses)
+	}
+
+	body = `<C:addressbook-query xmlns:C="urn:ietf:params:xml:ns:carddav"><C:filter><C:prop-filter name="FN">` +
+		`<C:text-match collation="i;klingon">x</C:text-match></C:prop-filter></C:filter></C:addressbook-query>`
+	if resp, data := do(t, "REPORT", srv.URL+"/contacts/", body); resp.StatusCode != http.StatusForbidden || !strings.Contains(data, "supported-collation") {
+		t.Errorf("unsupported collation: got status %v, body %q", resp.Status, data)
+	}
+
+	body = `<C:addressbook-query xmlns:C="urn:ietf:params:xml:ns:carddav"><C:filter><C:prop-filter name="FN">` +
+		`<C:text-match match-type="sounds-like">x</C:text-match></C:prop-filter></C:filter></C:addressbook-query>`
+	if resp, data := do(t, "REPORT", srv.URL+"/contacts/", body); resp.StatusCode != http.StatusForbidden || !strings.Contains(data, "supported-filter") {
+		t.Errorf("unsupported match type: got status %v, body %q", resp.Status, data)
+	}
+}
+
+func TestAddressbookMultiget(t *testing.T) {
+	srv := newTestServer(t)
+	const body = `<C:addressbook-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">` +
+		`<D:prop><D:getetag/><C:address-data/></D:prop>` +
+		`<D:href>/contacts/john.vcf</D:href><D:href>/contacts/missing.vcf</D:href><D:href>/elsewhere/jane.vcf</D:href>` +
+		`<D:href>%zz</D:href></C:addressbook-multiget>`
+	resp, data := do(t, "REPORT", srv.URL+"/contacts/", body)
+	responses, _ := parseMultistatus(t, resp, data)
+	if card, _ := propValue(responses["/contacts/john.vcf"], "address-data"); card != johnVCard {
+		t.Errorf("got address-data %q, want %q", card, johnVCard)
+	}
+	for _, href := range []string{"/contacts/missing.vcf", "/elsewhere/jane.vcf", "%zz"} {
+		if !strings.Contains(responses[href].Status, "404") {
+			t.Errorf("%v: got %+v, want 404", href, responses[href])
+		}
+	}
+
+	if resp, _ := do(t, "REPORT", srv.URL+"/contacts/john.vcf", body); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("report on object: got status %v", resp.Status)
+	}
+	if resp, _ := do(t, "REPORT", srv.URL+"/contacts/", `<D:expand-property xmlns:D="DAV:"/>`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsupported report: got status %v", resp.Status)
+	}
+}
+
+func TestSyncCollection(t *testing.T) {
+	srv := newTestServer(t)
+	sync := func(token string) (map[string]response, string) {
+		body := `<D:sync-collection xmlns:D="DAV:"><D:sync-token>` + token + `</D:sync-token>` +
+			`<D:sync-level>1</D:sync-level><D:prop><D:getetag/></D:prop></D:sync-collection>`
+		resp, data := do(t, "REPORT", srv.URL+"/contacts/", body)
+		return parseMultistatus(t, resp, data)
+	}
+
+	responses, token := sync("")
+	if len(responses) != 2 || token == "" {
+		t.Fatalf("initial sync: got %v responses, token %q", len(responses), token)
+	}
+	do(t, "DELETE", srv.URL+"/contacts/jane.vcf", "")
+	do(t, "PUT", srv.URL+"/contacts/john.vcf", strings.Replace(johnVCard, "John Doe", "Johnny Doe", 1))
+
+	responses, token2 := sync(token)
+	if len(responses) != 2 || token2 == token {
+		t.Fatalf("incremental sync: got %v responses, token %q", len(responses), token2)
+	}
+	if _, ok := propValue(responses["/contacts/john.vcf"], "getetag"); !ok {
+		t.Errorf("got %+v for modified object", responses["/contacts/john.vcf"])
+	}
+	if !strings.Contains(responses["/contacts/jane.vcf"].Status, "404") {
+		t.Errorf("got %+v for deleted object", responses["/contacts/jane.vcf"])
+	}
+
+	resp, data := do(t, "PROPFIND", srv.URL+"/contacts/", `<D:propfind xmlns:D="DAV:"><D:prop><D:sync-token/></D:prop></D:propfind>`, "Depth", "0")
+	if responses, _ := parseMultistatus(t, resp, data); len(responses) != 1 {
+		t.Errorf("got %v responses", len(responses))
+	} else if got, _ := propValue(responses["/contacts/"], "sync-token"); got != token2 {
+		t.Errorf("got sync-token property %q, want %q", got, token2)
+	}
+
+	body := `<D:sync-collection xmlns:D="DAV:"><D:sync-token>data:,bogus</D:sync-token><D:sync-level>1</D:sync-level><D:prop/></D:sync-collection>`
+	if resp, data := do(t, "REPORT", srv.URL+"/contacts/", body); resp.StatusCode != http.StatusForbidden || !strings.Contains(data, "valid-sync-token") {
+		t.Errorf("invalid token: got status %v, body %q", resp.Status, data)
+	}
+}
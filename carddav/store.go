@@ -0,0 +1,197 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package carddav
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ianprime0509/vcard"
+)
+
+// maxSnapshots is the number of sync tokens remembered by a syncLog.
+const maxSnapshots = 100
+
+// syncLog issues sync tokens for a store, each of which identifies a
+// snapshot of the entity tags of its objects. The changes since a token was
+// issued are found by comparing its snapshot to the current objects, so
+// changes made without using the store (such as editing the files of a
+// FileStore) are also found.
+type syncLog struct {
+	mu        sync.Mutex
+	epoch     int64 // distinguishes the tokens of different logs
+	next      int
+	snapshots []snapshot // the most recent snapshots, oldest first
+}
+
+type snapshot struct {
+	token string
+	etags map[string]string
+}
+
+func newSyncLog() *syncLog {
+	return &syncLog{epoch: time.Now().UnixNano()}
+}
+
+// changes implements Store.Changes, given the current objects of the store.
+func (l *syncLog) changes(current []Object, token string) (changed []Object, deleted []string, newToken string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	etags := make(map[string]string, len(current))
+	for _, obj := range current {
+		etags[obj.Name] = obj.ETag
+	}
+	if n := len(l.snapshots); n > 0 && equalETags(l.snapshots[n-1].etags, etags) {
+		newToken = l.snapshots[n-1].token
+	} else {
+		l.next++
+		newToken = fmt.Sprintf("data:,%v-%v", l.epoch, l.next)
+		l.snapshots = append(l.snapshots, snapshot{newToken, etags})
+		if len(l.snapshots) > maxSnapshots {
+			l.snapshots = l.snapshots[1:]
+		}
+	}
+	if token == "" {
+		return current, nil, newToken, nil
+	}
+
+	var old map[string]string
+	for _, s := range l.snapshots {
+		if s.token == token {
+			old = s.etags
+		}
+	}
+	if old == nil {
+		return nil, nil, "", ErrInvalidSyncToken
+	}
+	for _, obj := range current {
+		if etag, ok := old[obj.Name]; !ok || etag != obj.ETag {
+			changed = append(changed, obj)
+		}
+	}
+	for name := range old {
+		if _, ok := etags[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	return changed, deleted, newToken, nil
+}
+
+func equalETags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, etag := range a {
+		if other, ok := b[name]; !ok || other != etag {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryStore is a Store which keeps objects in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	objects map[string]*Object
+	uids    map[string]string // the name of the object with each UID
+	log     *syncLog
+}
+
+// NewMemoryStore returns a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]*Object),
+		uids:    make(map[string]string),
+		log:     newSyncLog(),
+	}
+}
+
+// List implements Store. The objects are sorted by name.
+func (s *MemoryStore) List() ([]Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(), nil
+}
+
+func (s *MemoryStore) list() []Object {
+	objects := make([]Object, 0, len(s.objects))
+	for _, obj := range s.objects {
+		objects = append(objects, *obj)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(name string) (*Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	clone := *obj
+	return &clone, nil
+}
+
+// Put implements Store. The card is stored as it is, so it should not be
+// modified afterwards.
+func (s *MemoryStore) Put(name string, card *vcard.Card, cond Precondition) (*Object, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.objects[name]
+	if err := cond.Check(current); err != nil {
+		return nil, false, err
+	}
+	uid := card.UID()
+	if other, ok := s.uids[uid]; ok && uid != "" && other != name {
+		return nil, false, &UIDConflictError{Name: other}
+	}
+	if current != nil {
+		delete(s.uids, current.Card.UID())
+	}
+	if uid != "" {
+		s.uids[uid] = name
+	}
+	obj := &Object{
+		Name:    name,
+		ETag:    ETag([]byte(card.String())),
+		ModTime: time.Now(),
+		Card:    card,
+	}
+	s.objects[name] = obj
+	clone := *obj
+	return &clone, current == nil, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(name string, cond Precondition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.objects[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := cond.Check(current); err != nil {
+		return err
+	}
+	delete(s.objects, name)
+	delete(s.uids, current.Card.UID())
+	return nil
+}
+
+// Changes implements Store.
+func (s *MemoryStore) Changes(token string) ([]Object, []string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.changes(s.list(), token)
+}
@@ -0,0 +1,174 @@
+package carddav
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ianprime0509/vcard"
+)
+
+func parseCard(t *testing.T, s string) *vcard.Card {
+	t.Helper()
+	cards, err := vcard.ParseAll(strings.NewReader(s))
+	if err != nil || len(cards) != 1 {
+		t.Fatalf("parsing %q: got %v cards, error %v", s, len(cards), err)
+	}
+	return cards[0]
+}
+
+func names(objects []Object) []string {
+	var names []string
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+	return names
+}
+
+// testStore tests the behaviour common to all stores, which must be empty.
+func testStore(t *testing.T, s Store) {
+	john := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nUID:1\nFN:John Doe\nEND:VCARD")
+	jane := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nUID:2\nFN:Jane Roe\nEND:VCARD")
+
+	_, _, token, err := s.Changes("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	obj, created, err := s.Put("john.vcf", john, Precondition{IfNoneMatch: true})
+	if err != nil || !created {
+		t.Fatalf("Put: got created %v, error %v", created, err)
+	}
+	if obj.ETag == "" || obj.Card.FormattedName() != "John Doe" {
+		t.Errorf("Put: got object %+v", obj)
+	}
+	if _, _, err := s.Put("john.vcf", john, Precondition{IfNoneMatch: true}); err != ErrPreconditionFailed {
+		t.Errorf("Put existing with If-None-Match: got error %v", err)
+	}
+	if _, _, err := s.Put("john.vcf", jane, Precondition{IfMatch: []string{"wrong"}}); err != ErrPreconditionFailed {
+		t.Errorf("Put with wrong If-Match: got error %v", err)
+	}
+	if _, _, err := s.Put("jane.vcf", jane, Precondition{IfMatch: []string{"*"}}); err != ErrPreconditionFailed {
+		t.Errorf("Put new with If-Match *: got error %v", err)
+	}
+	if _, _, err := s.Put("jane.vcf", jane, Precondition{}); err != nil {
+		t.Fatalf("Put: unexpected error: %v", err)
+	}
+
+	got, err := s.Get("john.vcf")
+	if err != nil {
+		t.Fatalf("Get: unexpected error: %v", err)
+	}
+	if got.ETag != obj.ETag || got.Card.String() != john.String() {
+		t.Errorf("Get: got %+v, want %+v", got, obj)
+	}
+	if _, err := s.Get("missing.vcf"); err != ErrNotFound {
+		t.Errorf("Get missing: got error %v", err)
+	}
+	objects, err := s.List()
+	if err != nil {
+		t.Fatalf("List: unexpected error: %v", err)
+	}
+	if got := names(objects); !reflect.DeepEqual(got, []string{"jane.vcf", "john.vcf"}) {
+		t.Errorf("List: got %q", got)
+	}
+
+	changed, deleted, token2, err := s.Changes(token)
+	if err != nil {
+		t.Fatalf("Changes: unexpected error: %v", err)
+	}
+	if got := names(changed); !reflect.DeepEqual(got, []string{"jane.vcf", "john.vcf"}) || len(deleted) != 0 {
+		t.Errorf("Changes: got changed %q, deleted %q", got, deleted)
+	}
+
+	john.SetFormattedName("Johnny Doe")
+	if _, created, err := s.Put("john.vcf", john, Precondition{IfMatch: []string{obj.ETag}}); err != nil || created {
+		t.Fatalf("Put with If-Match: got created %v, error %v", created, err)
+	}
+	if err := s.Delete("jane.vcf", Precondition{IfMatch: []string{"wrong"}}); err != ErrPreconditionFailed {
+		t.Errorf("Delete with wrong If-Match: got error %v", err)
+	}
+	if err := s.Delete("jane.vcf", Precondition{}); err != nil {
+		t.Errorf("Delete: unexpected error: %v", err)
+	}
+	if err := s.Delete("jane.vcf", Precondition{}); err != ErrNotFound {
+		t.Errorf("Delete missing: got error %v", err)
+	}
+	// Jane's UID is free again, but John's is not.
+	if _, _, err := s.Put("jane2.vcf", jane, Precondition{}); err != nil {
+		t.Errorf("Put with UID of deleted object: unexpected error: %v", err)
+	}
+	if err := s.Delete("jane2.vcf", Precondition{}); err != nil {
+		t.Errorf("Delete: unexpected error: %v", err)
+	}
+	var conflict *UIDConflictError
+	if _, _, err := s.Put("john2.vcf", john, Precondition{}); !errors.As(err, &conflict) || conflict.Name != "john.vcf" {
+		t.Errorf("Put with conflicting UID: got error %v", err)
+	}
+
+	changed, deleted, token3, err := s.Changes(token2)
+	if err != nil {
+		t.Fatalf("Changes: unexpected error: %v", err)
+	}
+	if got := names(changed); !reflect.DeepEqual(got, []string{"john.vcf"}) || !reflect.DeepEqual(deleted, []string{"jane.vcf"}) {
+		t.Errorf("Changes: got changed %q, deleted %q", got, deleted)
+	}
+	if changed, deleted, token4, _ := s.Changes(token3); len(changed) != 0 || len(deleted) != 0 || token4 != token3 {
+		t.Errorf("Changes without changes: got changed %q, deleted %q, token %q", names(changed), deleted, token4)
+	}
+	if _, _, _, err := s.Changes("data:,bogus"); err != ErrInvalidSyncToken {
+		t.Errorf("Changes with invalid token: got error %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStore(dir)
+	testStore(t, s)
+
+	// Changes made outside the store are seen.
+	_, _, token, _ := s.Changes("")
+	if err := os.WriteFile(filepath.Join(dir, "other.vcf"), []byte("BEGIN:VCARD\r\nVERSION:4.0\r\nUID:3\r\nFN:Other\r\nEND:VCARD\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a card"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, _, _, err := s.Changes(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := names(changed); !reflect.DeepEqual(got, []string{"other.vcf"}) {
+		t.Errorf("got changed %q", got)
+	}
+	if _, err := s.Get("../other.vcf"); err != ErrNotFound {
+		t.Errorf("got error %v for invalid name", err)
+	}
+
+	// A file which is not a valid card is skipped, not fatal.
+	if err := os.WriteFile(filepath.Join(dir, "bad.vcf"), []byte("BEGIN:VCARD\r\nFN:x\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	objects, err := s.List()
+	if err != nil {
+		t.Fatalf("List with invalid file: unexpected error: %v", err)
+	}
+	if got := names(objects); !reflect.DeepEqual(got, []string{"john.vcf", "other.vcf"}) {
+		t.Errorf("List with invalid file: got %q", got)
+	}
+	if _, _, _, err := s.Changes(token); err != nil {
+		t.Errorf("Changes with invalid file: unexpected error: %v", err)
+	}
+	if _, _, err := s.Put("new.vcf", parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nUID:4\nFN:New\nEND:VCARD"), Precondition{}); err != nil {
+		t.Errorf("Put with invalid file: unexpected error: %v", err)
+	}
+	if _, err := s.Get("bad.vcf"); err == nil || err == ErrNotFound {
+		t.Errorf("Get invalid file: got error %v", err)
+	}
+}
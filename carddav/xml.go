@@ -0,0 +1,97 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package carddav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// node is an arbitrary XML element, used both for parsing request bodies and
+// for writing the values of properties.
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []node     `xml:",any"`
+}
+
+// newNode returns an element with the given name and children.
+func newNode(space, local string, children ...node) node {
+	return node{XMLName: xml.Name{Space: space, Local: local}, Children: children}
+}
+
+// textNode returns an element with the given name and text content.
+func textNode(space, local, text string) node {
+	return node{XMLName: xml.Name{Space: space, Local: local}, Text: text}
+}
+
+// is returns whether the element has the given name.
+func (n *node) is(space, local string) bool {
+	return n.XMLName.Space == space && n.XMLName.Local == local
+}
+
+// child returns the first child element with the given name, or nil if
+// there is none.
+func (n *node) child(space, local string) *node {
+	for i := range n.Children {
+		if n.Children[i].is(space, local) {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// attr returns the value of the attribute with the given name (ignoring its
+// namespace), or the empty string if there is none.
+func (n *node) attr(local string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// content returns the text content of the element, with surrounding space
+// removed.
+func (n *node) content() string {
+	return strings.TrimSpace(n.Text)
+}
+
+// multistatus is the body of a 207 (Multi-Status) response.
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"response"`
+	SyncToken string     `xml:"sync-token,omitempty"`
+}
+
+// response is the status of a single resource in a multistatus.
+type response struct {
+	Href      string     `xml:"href"`
+	Propstats []propstat `xml:"propstat"`
+	Status    string     `xml:"status,omitempty"`
+}
+
+// propstat is a set of properties of a resource with the same status.
+type propstat struct {
+	Prop   props  `xml:"prop"`
+	Status string `xml:"status"`
+}
+
+type props struct {
+	Values []node `xml:",any"`
+}
+
+// status returns the HTTP status line for the given code, as used in
+// multistatus responses.
+func status(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %v %v", code, http.StatusText(code))
+}
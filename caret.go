@@ -0,0 +1,56 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import "strings"
+
+// caretEncoder encodes the characters which cannot otherwise appear in
+// parameter values, as described in RFC 6868. Every line break, including a
+// lone "\r", is encoded as "^n".
+var caretEncoder = strings.NewReplacer(
+	"^", "^^",
+	"\r\n", "^n",
+	"\n", "^n",
+	"\r", "^n",
+	`"`, "^'",
+)
+
+// encodeCaret encodes a parameter value using the caret encoding described in
+// RFC 6868, so that it may contain newlines and double quotes.
+func encodeCaret(value string) string {
+	return caretEncoder.Replace(value)
+}
+
+// decodeCaret decodes a parameter value encoded as described in RFC 6868. As
+// required by the RFC, a caret which is not followed by one of the characters
+// with a defined meaning is left unchanged, along with the following character.
+func decodeCaret(value string) string {
+	if !strings.Contains(value, "^") {
+		return value
+	}
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '^' || i+1 == len(value) {
+			sb.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case 'n':
+			sb.WriteByte('\n')
+		case '^':
+			sb.WriteByte('^')
+		case '\'':
+			sb.WriteByte('"')
+		default:
+			sb.WriteByte('^')
+			continue
+		}
+		i++
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package vcard
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCaret(t *testing.T) {
+	tests := []struct {
+		decoded, encoded string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"1 Main St\nSpringfield", "1 Main St^nSpringfield"},
+		{`George Herman "Babe" Ruth`, "George Herman ^'Babe^' Ruth"},
+		{"a^b", "a^^b"},
+		{"^n", "^^n"},
+	}
+
+	for _, test := range tests {
+		if encoded := encodeCaret(test.decoded); encoded != test.encoded {
+			t.Errorf("encodeCaret(%q) = %q, want %q", test.decoded, encoded, test.encoded)
+		}
+		if decoded := decodeCaret(test.encoded); decoded != test.decoded {
+			t.Errorf("decodeCaret(%q) = %q, want %q", test.encoded, decoded, test.decoded)
+		}
+	}
+}
+
+func TestEncodeCaretLineBreaks(t *testing.T) {
+	// Every kind of line break becomes "^n", so it cannot end the line.
+	for _, s := range []string{"a\nb", "a\r\nb", "a\rb"} {
+		if encoded := encodeCaret(s); encoded != "a^nb" {
+			t.Errorf("encodeCaret(%q) = %q, want %q", s, encoded, "a^nb")
+		}
+	}
+}
+
+func TestDecodeCaretUnknown(t *testing.T) {
+	// Unknown sequences and a trailing caret are left unchanged.
+	for _, s := range []string{"^a", "a^", "^"} {
+		if decoded := decodeCaret(s); decoded != s {
+			t.Errorf("decodeCaret(%q) = %q, want %q", s, decoded, s)
+		}
+	}
+}
+
+func TestCaretRoundTrip(t *testing.T) {
+	var prop Property
+	prop.SetParam("LABEL", "1 Main St\nSpringfield, \"IL\"; USA: ^")
+	prop.SetComponents([]string{""}, []string{""}, []string{"1 Main St"})
+	card := new(Card)
+	card.Add("VERSION", Property{components: [][]string{{"4.0"}}})
+	card.Add("ADR", prop)
+
+	s := card.String()
+	if want := `ADR;LABEL="1 Main St^nSpringfield, ^'IL^'; USA: ^^":;;1 Main St`; !strings.Contains(s, want) {
+		t.Fatalf("got %q, want it to contain %q", s, want)
+	}
+	cards, err := ParseAll(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if label := cards[0].Get("ADR")[0].Param("LABEL"); len(label) != 1 || label[0] != prop.Param("LABEL")[0] {
+		t.Errorf("got LABEL %q, want %q", label, prop.Param("LABEL"))
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ianprime0509/vcard"
+)
+
+// describe returns a short description of a card for use in messages, such as
+// "card 2 (John Doe)".
+func describe(i int, card *vcard.Card) string {
+	if fn := card.FormattedName(); fn != "" {
+		return fmt.Sprintf("card %v (%v)", i+1, fn)
+	}
+	return fmt.Sprintf("card %v", i+1)
+}
+
+// runValidate reports all the parsing errors and violations of the vCard
+// specification in the input. Parsing is always lenient, so that as many
+// problems as possible are reported.
+func runValidate(e *env, fs *flag.FlagSet, args []string) error {
+	version := fs.String("version", "", "the version to validate against (default: the VERSION of each card)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	inputs, closeAll, err := e.inputs(fs.Args())
+	if err != nil {
+		return err
+	}
+	defer closeAll()
+
+	problems := 0
+	for _, in := range inputs {
+		p := e.parser(in)
+		p.SetLenient(true)
+		reported := 0
+		report := func() {
+			for _, diag := range p.Diagnostics()[reported:] {
+				fmt.Fprintln(e.stdout, positioned(in.name, diag))
+				problems++
+			}
+			reported = len(p.Diagnostics())
+		}
+		for i := 0; ; i++ {
+			card, err := p.Next()
+			report()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				fmt.Fprintln(e.stdout, positioned(in.name, err))
+				problems++
+				break
+			}
+
+			v := *version
+			var violations []vcard.Violation
+			if v == "" {
+				if props := card.Get("VERSION"); len(props) > 0 && len(props[0].Values()) > 0 {
+					v = props[0].Values()[0]
+				} else {
+					// There is no version to validate against.
+					violations = []vcard.Violation{{Property: "VERSION", Index: -1, Rule: vcard.RuleRequired}}
+				}
+			}
+			if violations == nil {
+				violations = card.Validate(v)
+			}
+			for _, violation := range violations {
+				fmt.Fprintf(e.stdout, "%v: %v: %v\n", in.name, describe(i, card), violation)
+				problems++
+			}
+		}
+	}
+	if problems > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// runFmt rewrites cards with consistent folding and line endings.
+func runFmt(e *env, fs *flag.FlagSet, args []string) error {
+	write := fs.Bool("w", false, "rewrite the files in place instead of writing to standard output")
+	width := fs.Int("width", 75, "the maximum length of a line in bytes")
+	lf := fs.Bool("lf", false, `end lines with "\n" instead of "\r\n"`)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	format := func(w io.Writer, cards []*vcard.Card) error {
+		bw := bufio.NewWriter(w)
+		enc := vcard.NewEncoder(bw)
+		enc.SetWidth(*width)
+		if *lf {
+			enc.SetLineEnding("\n")
+		}
+		for _, card := range cards {
+			if err := enc.Encode(card); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+
+	if !*write {
+		cards, err := e.readAll(fs.Args())
+		if err != nil {
+			return err
+		}
+		return format(e.stdout, cards)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(e.stderr, "vcard fmt: -w requires file arguments")
+		return errUsage
+	}
+	for _, name := range fs.Args() {
+		cards, err := e.readAll([]string{name})
+		if err != nil {
+			return err
+		}
+		if err := rewrite(name, func(w io.Writer) error { return format(w, cards) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite replaces the contents of the named file with the output of write.
+// The output is written to a temporary file which is renamed over the
+// original, so the original is left unchanged if writing fails.
+func rewrite(name string, write func(io.Writer) error) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// runConvert converts cards to another version, reporting any information
+// which is lost.
+func runConvert(e *env, fs *flag.FlagSet, args []string) error {
+	to := fs.String("to", "", `the version to convert to ("2.1", "3.0" or "4.0")`)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	switch *to {
+	case "2.1", "3.0", "4.0":
+	default:
+		fmt.Fprintf(e.stderr, "vcard convert: unsupported version %q\n", *to)
+		fs.Usage()
+		return errUsage
+	}
+	cards, err := e.readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	for i, card := range cards {
+		var warnings []vcard.Warning
+		if cards[i], warnings, err = vcard.Convert(card, *to); err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(e.stderr, "%v: %v\n", describe(i, card), warning)
+		}
+	}
+	return e.writeAll(cards)
+}
+
+// unsafeFileChars matches characters which should not be used in file names.
+var unsafeFileChars = regexp.MustCompile(`[^\pL\pN._-]+`)
+
+// runSplit writes each card to a separate file.
+func runSplit(e *env, fs *flag.FlagSet, args []string) error {
+	dir := fs.String("dir", ".", "the directory in which to write the files")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	cards, err := e.readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for i, card := range cards {
+		base := card.UID()
+		if base == "" {
+			base = card.FormattedName()
+		}
+		base = strings.Trim(unsafeFileChars.ReplaceAllString(base, "_"), "_.")
+		if base == "" {
+			base = "card-" + strconv.Itoa(i+1)
+		}
+		name := base + ".vcf"
+		for n := 2; used[name] || exists(filepath.Join(*dir, name)); n++ {
+			name = base + "-" + strconv.Itoa(n) + ".vcf"
+		}
+		used[name] = true
+
+		path := filepath.Join(*dir, name)
+		if err := os.WriteFile(path, []byte(card.String()), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, path)
+	}
+	return nil
+}
+
+// exists returns whether a file exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// runCat concatenates the cards from several files.
+func runCat(e *env, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	cards, err := e.readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	return e.writeAll(cards)
+}
+
+// runMerge merges duplicate cards.
+func runMerge(e *env, fs *flag.FlagSet, args []string) error {
+	all := fs.Bool("all", false, "merge all cards into a single card, rather than only duplicates")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	cards, err := e.readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		return nil
+	}
+	if *all {
+		return e.writeAll([]*vcard.Card{vcard.Merge(cards...)})
+	}
+
+	// Each group of duplicates is replaced by the merged card, in the
+	// position of its first card.
+	merged := make(map[*vcard.Card]*vcard.Card)
+	for _, group := range vcard.FindDuplicates(cards) {
+		card := vcard.Merge(group...)
+		for _, dup := range group {
+			merged[dup] = nil
+		}
+		merged[group[0]] = card
+	}
+	var out []*vcard.Card
+	for _, card := range cards {
+		if m, ok := merged[card]; !ok {
+			out = append(out, card)
+		} else if m != nil {
+			out = append(out, m)
+		}
+	}
+	return e.writeAll(out)
+}
+
+// runGrep prints the cards which have a property matching a pattern.
+func runGrep(e *env, fs *flag.FlagSet, args []string) error {
+	ignoreCase := fs.Bool("i", false, "match the pattern case-insensitively")
+	invert := fs.Bool("v", false, "print the cards which do not match instead")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 || !strings.Contains(fs.Arg(0), "=") {
+		fs.Usage()
+		return errUsage
+	}
+	i := strings.IndexByte(fs.Arg(0), '=')
+	name, pattern := fs.Arg(0)[:i], fs.Arg(0)[i+1:]
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	cards, err := e.readAll(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	var matched []*vcard.Card
+	for _, card := range cards {
+		match := false
+		for _, prop := range card.Get(name) {
+			var components []string
+			for _, values := range prop.Components() {
+				components = append(components, strings.Join(values, ","))
+			}
+			match = match || re.MatchString(strings.Join(components, ";"))
+		}
+		if match != *invert {
+			matched = append(matched, card)
+		}
+	}
+	if len(matched) == 0 {
+		return errFailed
+	}
+	return e.writeAll(matched)
+}
+
+// runToJSON writes cards as an array of jCards.
+func runToJSON(e *env, fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	cards, err := e.readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	if cards == nil {
+		cards = []*vcard.Card{}
+	}
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cards)
+}
+
+// runToCSV writes cards as CSV, with a header row.
+func runToCSV(e *env, fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "default", `the layout of the columns ("default", "google" or "outlook")`)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	switch *format {
+	case "default", "google", "outlook":
+	default:
+		fmt.Fprintf(e.stderr, "vcard to-csv: unknown format %q\n", *format)
+		fs.Usage()
+		return errUsage
+	}
+	cards, err := e.readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	// Properties which may appear more than once are given as numbered
+	// columns, enough for the card with the most occurrences.
+	n := 1
+	for _, card := range cards {
+		for _, name := range []string{"EMAIL", "TEL", "ADR", "URL"} {
+			n = max(n, len(card.Get(name)))
+		}
+	}
+	m := vcard.DefaultMapping(n)
+	switch *format {
+	case "google":
+		m = vcard.GoogleMapping(n)
+	case "outlook":
+		m = vcard.OutlookMapping()
+	}
+
+	enc := vcard.NewCSVEncoder(e.stdout, m)
+	for _, card := range cards {
+		if err := enc.Encode(card); err != nil {
+			return err
+		}
+	}
+	return enc.Flush()
+}
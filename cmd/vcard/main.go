@@ -0,0 +1,215 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+// Command vcard inspects and transforms files containing vCards.
+//
+// Usage:
+//
+//	vcard <command> [flags] [files...]
+//
+// Each command reads the cards in the given files (or standard input, if
+// there are none) and writes its results to standard output. The commands
+// are:
+//
+//	validate  report parsing errors and violations of the vCard specification
+//	fmt       rewrite cards with consistent folding and line endings
+//	convert   convert cards to another version of the vCard specification
+//	split     write each card to a separate file, named by its UID or FN
+//	cat       concatenate cards from several files
+//	merge     merge duplicate cards (or all cards) into single cards
+//	grep      print cards with a property matching a regular expression
+//	to-json   write cards in the jCard (JSON) format
+//	to-csv    write cards as CSV, one row per card
+//
+// Run "vcard <command> -h" for the flags accepted by each command.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ianprime0509/vcard"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// command is a subcommand of the program.
+type command struct {
+	name  string
+	args  string // a description of the arguments, for usage messages
+	usage string
+	run   func(e *env, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"validate", "[-version v] [files]", "report parsing errors and violations of the vCard specification", runValidate},
+	{"fmt", "[-w] [-width n] [-lf] [files]", "rewrite cards with consistent folding and line endings", runFmt},
+	{"convert", "-to version [files]", "convert cards to another version of the vCard specification", runConvert},
+	{"split", "[-dir dir] [files]", "write each card to a separate file, named by its UID or FN", runSplit},
+	{"cat", "[files]", "concatenate cards from several files", runCat},
+	{"merge", "[-all] [files]", "merge duplicate cards (or all cards) into single cards", runMerge},
+	{"grep", "[-i] [-v] PROPERTY=pattern [files]", "print cards with a property matching a regular expression", runGrep},
+	{"to-json", "[files]", "write cards in the jCard (JSON) format", runToJSON},
+	{"to-csv", "[-format f] [files]", "write cards as CSV, one row per card", runToCSV},
+}
+
+// env is the environment in which a command runs.
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	lenient        bool
+	compat21       bool
+}
+
+// errFailed is returned by commands which have already reported their
+// problems, so that the program exits with a non-zero status without printing
+// anything else.
+var errFailed = errors.New("failed")
+
+// errUsage is returned by commands which were given invalid arguments, after
+// reporting them.
+var errUsage = errors.New("invalid usage")
+
+// run runs the program with the given arguments, returning the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		e := &env{stdin: stdin, stdout: stdout, stderr: stderr}
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.SetOutput(stderr)
+		fs.BoolVar(&e.lenient, "lenient", false, "recover from malformed input")
+		fs.BoolVar(&e.compat21, "compat21", false, "accept vCard 2.1 syntax")
+		fs.Usage = func() {
+			fmt.Fprintf(stderr, "usage: vcard %v %v\n\n%v.\n\n", cmd.name, cmd.args, cmd.usage)
+			fs.PrintDefaults()
+		}
+		err := cmd.run(e, fs, args[1:])
+		switch err {
+		case nil:
+			return 0
+		case flag.ErrHelp, errUsage:
+			return 2
+		case errFailed:
+			return 1
+		}
+		fmt.Fprintf(stderr, "vcard %v: %v\n", cmd.name, err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "vcard: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+// usage writes the usage message of the program.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: vcard <command> [flags] [files...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9v %v\n", cmd.name, cmd.usage)
+	}
+}
+
+// input is a source of cards.
+type input struct {
+	name string // the name of the file, or "<stdin>"
+	r    io.Reader
+}
+
+// inputs returns the inputs named by the given arguments, or standard input
+// if there are none. The returned function closes any opened files.
+func (e *env) inputs(args []string) ([]input, func(), error) {
+	if len(args) == 0 {
+		return []input{{"<stdin>", e.stdin}}, func() {}, nil
+	}
+	var inputs []input
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for _, arg := range args {
+		f, err := os.Open(arg)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		inputs = append(inputs, input{arg, f})
+	}
+	return inputs, closeAll, nil
+}
+
+// parser returns a parser for the given input, configured according to the
+// common flags.
+func (e *env) parser(in input) *vcard.Parser {
+	p := vcard.NewParser(bufio.NewReader(in.r))
+	p.SetLenient(e.lenient)
+	p.SetCompat21(e.compat21)
+	return p
+}
+
+// readAll reads all the cards from the inputs named by the given arguments.
+// Parsing errors are reported with the name of the file in which they
+// occurred.
+func (e *env) readAll(args []string) ([]*vcard.Card, error) {
+	inputs, closeAll, err := e.inputs(args)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll()
+
+	var cards []*vcard.Card
+	for _, in := range inputs {
+		p := e.parser(in)
+		for {
+			card, err := p.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, positioned(in.name, err)
+			}
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
+
+// positioned returns an error prefixed by the file name and (for parsing
+// errors) the position at which it occurred.
+func positioned(name string, err error) error {
+	var perr vcard.ParseError
+	if errors.As(err, &perr) {
+		return fmt.Errorf("%v:%v:%v: %v", name, perr.Line, perr.Column, perr.Message())
+	}
+	return fmt.Errorf("%v: %v", name, err)
+}
+
+// writeAll writes cards to standard output.
+func (e *env) writeAll(cards []*vcard.Card) error {
+	w := bufio.NewWriter(e.stdout)
+	enc := vcard.NewEncoder(w)
+	for _, card := range cards {
+		if err := enc.Encode(card); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
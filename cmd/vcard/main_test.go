@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = "BEGIN:VCARD\r\n" +
+	"VERSION:4.0\r\n" +
+	"FN:John Doe\r\n" +
+	"UID:urn:uuid:1\r\n" +
+	"EMAIL;TYPE=work:john@example.com\r\n" +
+	"END:VCARD\r\n" +
+	"BEGIN:VCARD\r\n" +
+	"VERSION:4.0\r\n" +
+	"FN:Jane Roe\r\n" +
+	"TEL;TYPE=cell:+1-555-0100\r\n" +
+	"END:VCARD\r\n" +
+	"BEGIN:VCARD\r\n" +
+	"VERSION:4.0\r\n" +
+	"FN:Johnny Doe\r\n" +
+	"EMAIL:JOHN@example.com\r\n" +
+	"NOTE:a duplicate\r\n" +
+	"END:VCARD\r\n"
+
+// runString runs the program with the given arguments and standard input,
+// returning the exit status and the contents of standard output and standard
+// error.
+func runString(stdin string, args ...string) (int, string, string) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	status := run(args, strings.NewReader(stdin), stdout, stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	tests := [][]string{
+		nil,
+		{"help"},
+		{"frobnicate"},
+		{"convert"},
+		{"convert", "-to", "5.0"},
+		{"grep", "FN"},
+		{"cat", "-nonexistent"},
+	}
+
+	for _, test := range tests {
+		if status, _, stderr := runString("", test...); status != 2 {
+			t.Errorf("%q: got status %v, want 2", test, status)
+		} else if !strings.Contains(stderr, "usage:") && !strings.Contains(stderr, "not defined") {
+			t.Errorf("%q: got no usage message: %q", test, stderr)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if status, stdout, stderr := runString(sample, "validate"); status != 0 {
+		t.Errorf("got status %v, stdout %q, stderr %q", status, stdout, stderr)
+	}
+
+	const invalid = "BEGIN:VCARD\r\n" +
+		"VERSION:4.0\r\n" +
+		"N:Doe;John;;;\r\n" +
+		"bad line\r\n" +
+		"END:VCARD\r\n"
+	status, stdout, _ := runString(invalid, "validate")
+	if status != 1 {
+		t.Errorf("got status %v, want 1", status)
+	}
+	want := "<stdin>:4:4: expected ':'\n" +
+		"<stdin>: card 1: FN: required\n"
+	if stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+
+	status, stdout, _ = runString(sample, "validate", "-version", "5.0")
+	if status != 1 {
+		t.Errorf("unsupported version: got status %v, want 1", status)
+	}
+	if want := "<stdin>: card 1 (John Doe): VERSION[0]: unsupported-version\n"; !strings.HasPrefix(stdout, want) {
+		t.Errorf("unsupported version: got %q, want %q", stdout, want)
+	}
+
+	const noVersion = "BEGIN:VCARD\r\nFN:John Doe\r\nEND:VCARD\r\n"
+	status, stdout, _ = runString(noVersion, "validate")
+	if status != 1 {
+		t.Errorf("missing version: got status %v, want 1", status)
+	}
+	if want := "<stdin>: card 1 (John Doe): VERSION: required\n"; stdout != want {
+		t.Errorf("missing version: got %q, want %q", stdout, want)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	in := strings.Replace(sample, "FN:John Doe", "FN:John\r\n  Doe", 1)
+	status, stdout, stderr := runString(in, "fmt", "-lf")
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	if want := strings.Replace(sample, "\r\n", "\n", -1); stdout != want {
+		t.Errorf("got %q, want %q", stdout, want)
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cards.vcf")
+	if err := os.WriteFile(path, []byte(strings.Replace(sample, "\r\n", "\n", -1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, stderr := runString("", "fmt", "-w", path); status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	if data, err := os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != sample {
+		t.Errorf("got %q, want %q", data, sample)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("got mode %v, want %v", info.Mode().Perm(), os.FileMode(0644))
+	}
+	if entries, err := os.ReadDir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Errorf("got %v files, want only the rewritten file", len(entries))
+	}
+}
+
+func TestConvert(t *testing.T) {
+	status, stdout, stderr := runString(sample, "convert", "-to", "3.0")
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	if n := strings.Count(stdout, "VERSION:3.0\r\n"); n != 3 {
+		t.Errorf("got %v cards of version 3.0 in %q", n, stdout)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	in := sample + strings.Replace(sample[strings.Index(sample, "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Jane"):], "Johnny", "Jim", 1)
+	status, _, stderr := runString(in, "split", "-dir", dir)
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"Jane_Roe-2.vcf", "Jane_Roe.vcf", "Jim_Doe.vcf", "Johnny_Doe.vcf", "urn_uuid_1.vcf"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got files %q, want %q", names, want)
+	}
+}
+
+func TestCat(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i, card := range strings.SplitAfter(sample, "END:VCARD\r\n")[:3] {
+		path := filepath.Join(dir, string(rune('a'+i))+".vcf")
+		if err := os.WriteFile(path, []byte(card), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	status, stdout, stderr := runString("", append([]string{"cat"}, paths...)...)
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	if stdout != sample {
+		t.Errorf("got %q, want %q", stdout, sample)
+	}
+
+	if status, _, stderr := runString("", "cat", filepath.Join(dir, "missing.vcf")); status != 1 || stderr == "" {
+		t.Errorf("missing file: got status %v, stderr %q", status, stderr)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	status, stdout, stderr := runString(sample, "merge")
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	if n := strings.Count(stdout, "BEGIN:VCARD"); n != 2 {
+		t.Errorf("got %v cards, want 2: %q", n, stdout)
+	}
+	if !strings.Contains(stdout, "NOTE:a duplicate") || !strings.Contains(stdout, "UID:urn:uuid:1") {
+		t.Errorf("duplicates not merged: %q", stdout)
+	}
+
+	status, stdout, _ = runString(sample, "merge", "-all")
+	if status != 0 || strings.Count(stdout, "BEGIN:VCARD") != 1 {
+		t.Errorf("-all: got status %v, output %q", status, stdout)
+	}
+}
+
+func TestGrep(t *testing.T) {
+	tests := []struct {
+		args   []string
+		fns    []string
+		status int
+	}{
+		{[]string{"FN=Doe$"}, []string{"John Doe", "Johnny Doe"}, 0},
+		{[]string{"email=^john@"}, []string{"John Doe"}, 0},
+		{[]string{"-i", "email=^john@"}, []string{"John Doe", "Johnny Doe"}, 0},
+		{[]string{"-v", "FN=Doe"}, []string{"Jane Roe"}, 0},
+		{[]string{"NOTE=nothing"}, nil, 1},
+	}
+
+	for _, test := range tests {
+		status, stdout, _ := runString(sample, append([]string{"grep"}, test.args...)...)
+		if status != test.status {
+			t.Errorf("%q: got status %v, want %v", test.args, status, test.status)
+		}
+		var fns []string
+		for _, line := range strings.Split(stdout, "\r\n") {
+			if strings.HasPrefix(line, "FN:") {
+				fns = append(fns, line[len("FN:"):])
+			}
+		}
+		if !reflect.DeepEqual(fns, test.fns) {
+			t.Errorf("%q: got %q, want %q", test.args, fns, test.fns)
+		}
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	status, stdout, stderr := runString(sample, "to-json")
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	var cards []interface{}
+	if err := json.Unmarshal([]byte(stdout), &cards); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if len(cards) != 3 {
+		t.Errorf("got %v cards, want 3", len(cards))
+	}
+
+	if _, stdout, _ := runString("", "to-json"); strings.TrimSpace(stdout) != "[]" {
+		t.Errorf("got %q for no cards, want []", stdout)
+	}
+}
+
+func TestToCSV(t *testing.T) {
+	status, stdout, stderr := runString(sample, "to-csv")
+	if status != 0 {
+		t.Fatalf("got status %v, stderr %q", status, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %v lines, want 4: %q", len(lines), stdout)
+	}
+	want := []string{
+		"Formatted Name,Family Name,Given Name,Additional Names,Honorific Prefixes,Honorific Suffixes,Nickname,Organization,Title,Birthday,Note,UID,Email 1,Email 1 Type,Phone 1,Phone 1 Type,Address 1 Type,Address 1 PO Box,Address 1 Extended,Address 1 Street,Address 1 Locality,Address 1 Region,Address 1 Postal Code,Address 1 Country,URL 1",
+		"John Doe,,,,,,,,,,,urn:uuid:1,john@example.com,work,,,,,,,,,,,",
+		"Jane Roe,,,,,,,,,,,,,,+1-555-0100,cell,,,,,,,,,",
+		"Johnny Doe,,,,,,,,,,a duplicate,,JOHN@example.com,,,,,,,,,,,,",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+
+	status, stdout, _ = runString(sample, "to-csv", "-format", "outlook")
+	if status != 0 || !strings.HasPrefix(stdout, "Title,First Name,") {
+		t.Errorf("outlook: got status %v, output %q", status, stdout)
+	}
+	if status, _, _ := runString(sample, "to-csv", "-format", "excel"); status != 2 {
+		t.Errorf("unknown format: got status %v, want 2", status)
+	}
+}
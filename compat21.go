@@ -0,0 +1,224 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"unicode/utf8"
+)
+
+// SetCompat21 sets whether the parser should accept the syntax of vCard 2.1,
+// which is still produced by many older phones and mail clients. In this
+// mode, the parser accepts:
+//
+//   - parameters without a name (such as "TEL;HOME;VOICE:"), which are
+//     interpreted as values of the ENCODING, VALUE or TYPE parameter as
+//     appropriate;
+//   - values with the QUOTED-PRINTABLE encoding, including soft line breaks
+//     (lines ending in '=');
+//   - values in which only semicolons are special: commas do not separate
+//     values, and a backslash only escapes a following semicolon (unless the
+//     card has already declared VERSION 3.0 or 4.0, in which case the usual
+//     escapes apply to values which are not QUOTED-PRINTABLE);
+//   - values in a character set other than UTF-8, as given by the CHARSET
+//     parameter (only US-ASCII, ISO-8859-1 and Windows-1252 are supported);
+//   - blank lines between properties, such as those following BASE64 values.
+//
+// Values that are decoded from QUOTED-PRINTABLE or from another character set
+// are converted to UTF-8 text, and the corresponding ENCODING and CHARSET
+// parameters are removed from the property, so that the resulting card can
+// be written out as vCard 3.0 or 4.0 text.
+func (p *Parser) SetCompat21(compat bool) {
+	p.compat21 = compat
+}
+
+// skipBlankLines skips over any empty lines in the input, if vCard 2.1
+// compatibility or lenient parsing is enabled.
+func (p *Parser) skipBlankLines() error {
+	if !p.compat21 && !p.lenient {
+		return nil
+	}
+	b, err := p.r.PeekByte()
+	for err == nil && b == '\n' {
+		p.r.ReadByte()
+		b, err = p.r.PeekByte()
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// paramName21 returns the name of the parameter to which a vCard 2.1
+// parameter value without a name belongs.
+func paramName21(value string) string {
+	switch value {
+	case "7BIT", "8BIT", "QUOTED-PRINTABLE", "BASE64", "B":
+		return "ENCODING"
+	case "INLINE", "URL", "CONTENT-ID", "CID":
+		return "VALUE"
+	}
+	return "TYPE"
+}
+
+// parsePropertyComponents21 parses the components of a vCard 2.1 property
+// value, taking into account the ENCODING and CHARSET parameters of the
+// property (which are removed if the value is decoded).
+func (p *Parser) parsePropertyComponents21(prop *Property) ([][]string, error) {
+	encoding := strings.ToUpper(strings.Join(prop.Param("ENCODING"), ","))
+	charset := strings.ToUpper(strings.Join(prop.Param("CHARSET"), ","))
+	if encoding == "QUOTED-PRINTABLE" {
+		pos := p.position()
+		value, err := p.parseQuotedPrintable()
+		if err != nil {
+			return nil, err
+		}
+		if value, err = decodeCharset(value, charset); err != nil {
+			return nil, p.errorAt(pos, ErrEncoding, err.Error())
+		}
+		prop.removeParam("ENCODING")
+		prop.removeParam("CHARSET")
+		return splitComponents21(value), nil
+	}
+
+	if p.version == "3.0" || p.version == "4.0" {
+		pos := p.position()
+		components, err := p.parsePropertyComponents()
+		if err != nil || charset == "" {
+			return components, err
+		}
+		for _, values := range components {
+			for i := range values {
+				if values[i], err = decodeCharset(values[i], charset); err != nil {
+					return nil, p.errorAt(pos, ErrEncoding, err.Error())
+				}
+			}
+		}
+		prop.removeParam("CHARSET")
+		return components, nil
+	}
+
+	pos := p.position()
+	value, err := p.parseRawValue()
+	if err != nil {
+		return nil, err
+	}
+	if value, err = decodeCharset(value, charset); err != nil {
+		return nil, p.errorAt(pos, ErrEncoding, err.Error())
+	}
+	prop.removeParam("CHARSET")
+	return splitComponents21(value), nil
+}
+
+// parseRawValue parses a vCard 2.1 property value up to the end of the line,
+// without interpreting any escapes.
+func (p *Parser) parseRawValue() (string, error) {
+	var bs []byte
+	b, err := p.r.PeekByte()
+	for err == nil && (b == '\t' || ' ' <= b) {
+		p.r.ReadByte()
+		bs = append(bs, b)
+		b, err = p.r.PeekByte()
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// parseQuotedPrintable parses a property value in the QUOTED-PRINTABLE
+// encoding, returning the decoded value.
+func (p *Parser) parseQuotedPrintable() (string, error) {
+	var bs []byte
+
+	pos := p.position()
+	b, err := p.r.PeekByte()
+	for err == nil && b != '\n' {
+		p.r.ReadByte()
+		bs = append(bs, b)
+		if b == '=' {
+			// A soft line break continues the value on the next line.
+			if b2, err := p.r.PeekByte(); err == nil && b2 == '\n' {
+				p.r.ReadByte()
+				bs = append(bs, b2)
+			}
+		}
+		b, err = p.r.PeekByte()
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(bs)))
+	if err != nil {
+		return "", p.errorAt(pos, ErrEncoding, fmt.Sprintf("invalid quoted-printable value: %v", err))
+	}
+	// Line breaks in the decoded value usually use "\r\n", but the line
+	// breaks in property values are just '\n'.
+	return strings.Replace(string(decoded), "\r\n", "\n", -1), nil
+}
+
+// splitComponents21 splits a decoded vCard 2.1 value into its components,
+// which are separated by unescaped semicolons. Commas are not treated
+// specially, since vCard 2.1 does not use them to separate values.
+func splitComponents21(value string) [][]string {
+	var components [][]string
+	var bs []byte
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ';':
+			bs = append(bs, ';')
+			i++
+		case value[i] == ';':
+			components = append(components, []string{string(bs)})
+			bs = nil
+		default:
+			bs = append(bs, value[i])
+		}
+	}
+	return append(components, []string{string(bs)})
+}
+
+// windows1252 contains the characters corresponding to the bytes 0x80 through
+// 0x9F in the Windows-1252 character set, which is otherwise identical to
+// ISO-8859-1. Undefined bytes are mapped to the replacement character.
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// decodeCharset converts a string in the given character set (which must be
+// in uppercase) to UTF-8. An empty character set is treated as UTF-8.
+func decodeCharset(s, charset string) (string, error) {
+	switch charset {
+	case "", "UTF-8", "US-ASCII", "ASCII":
+		if !utf8.ValidString(s) {
+			if charset == "" {
+				charset = "UTF-8"
+			}
+			return "", fmt.Errorf("invalid text in charset %v", charset)
+		}
+		return s, nil
+	case "ISO-8859-1", "LATIN1", "WINDOWS-1252", "CP1252":
+		sb := new(strings.Builder)
+		for i := 0; i < len(s); i++ {
+			b := s[i]
+			if 0x80 <= b && b < 0xA0 && (charset == "WINDOWS-1252" || charset == "CP1252") {
+				sb.WriteRune(windows1252[b-0x80])
+			} else {
+				sb.WriteRune(rune(b))
+			}
+		}
+		return sb.String(), nil
+	}
+	return "", fmt.Errorf("unsupported charset %v", charset)
+}
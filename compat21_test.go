@@ -0,0 +1,122 @@
+package vcard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleVCard21 = "BEGIN:VCARD\r\n" +
+	"VERSION:2.1\r\n" +
+	"N;CHARSET=ISO-8859-1;ENCODING=QUOTED-PRINTABLE:M=FCller;J=FCrgen;;;\r\n" +
+	"FN;ENCODING=QUOTED-PRINTABLE;CHARSET=UTF-8:J=C3=BCrgen M=C3=BCller\r\n" +
+	"TEL;HOME;VOICE:+49 30 1234\r\n" +
+	"ADR;WORK;ENCODING=QUOTED-PRINTABLE:;;Hauptstra=C3=9Fe 1=0D=0A=\r\n" +
+	"Hinterhaus;Berlin;;10115;Germany\r\n" +
+	"NOTE;ENCODING=QUOTED-PRINTABLE;CHARSET=WINDOWS-1252:=93Hi=94, there\\;=\r\n" +
+	"\r\n" +
+	"TITLE;CHARSET=ISO-8859-1:Gesch\xe4ftsf\xfchrer\r\n" +
+	"PHOTO;ENCODING=BASE64;TYPE=GIF:\r\n" +
+	" R0lGODdh\r\n" +
+	"\r\n" +
+	"EMAIL;INTERNET;PREF:juergen@example.com\r\n" +
+	"END:VCARD\r\n" +
+	"\r\n"
+
+func TestCompat21(t *testing.T) {
+	p := NewParser(strings.NewReader(sampleVCard21))
+	p.SetCompat21(true)
+	card, err := p.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.Next(); err == nil {
+		t.Fatal("parsed card after end of input")
+	}
+
+	const expected = "BEGIN:VCARD\n" +
+		"VERSION:2.1\n" +
+		"N:Müller;Jürgen;;;\n" +
+		"FN:Jürgen Müller\n" +
+		"TEL;TYPE=HOME,VOICE:+49 30 1234\n" +
+		"ADR;TYPE=WORK:;;Hauptstraße 1\\nHinterhaus;Berlin;;10115;Germany\n" +
+		"NOTE:“Hi”\\, there\\;\n" +
+		"TITLE:Geschäftsführer\n" +
+		"PHOTO;ENCODING=BASE64;TYPE=GIF:R0lGODdh\n" +
+		"EMAIL;TYPE=INTERNET,PREF:juergen@example.com\n" +
+		"END:VCARD\n"
+	if out := card.UnfoldedString(); out != expected {
+		t.Fatalf("got %q, want %q", out, expected)
+	}
+}
+
+func TestCompat21Failure(t *testing.T) {
+	tests := []struct {
+		in       string
+		compat21 bool
+		line     int
+		msg      string
+	}{
+		{"BEGIN:VCARD\r\nNOTE;CHARSET=KOI8-R:test\r\nEND:VCARD\r\n", true, 2, "unsupported charset KOI8-R"},
+		{"BEGIN:VCARD\r\nNOTE;QUOTED-PRINTABLE;CHARSET=UTF-8:=FF\r\nEND:VCARD\r\n", true, 2, "invalid text in charset UTF-8"},
+		{"BEGIN:VCARD\r\nNOTE;QUOTED-PRINTABLE;CHARSET=EBCDIC:=\r\n=C1\r\nEND:VCARD\r\n", true, 2, "unsupported charset EBCDIC"},
+		{"BEGIN:VCARD\r\nTEL;HOME:123\r\nEND:VCARD\r\n", false, 2, "expected '=' after parameter name HOME"},
+	}
+
+	for _, test := range tests {
+		p := NewParser(strings.NewReader(test.in))
+		p.SetCompat21(test.compat21)
+		card, err := p.Next()
+		if err == nil {
+			t.Errorf("successfully parsed %q as %q", test.in, card)
+			continue
+		}
+		perr, ok := err.(ParseError)
+		if !ok {
+			t.Errorf("Next() on %q error %q, not a parse error", test.in, err)
+		} else if test.line != perr.Line || !strings.Contains(perr.Message(), test.msg) {
+			t.Errorf("Next() on %q error %q, want %q on line %v", test.in, perr, test.msg, test.line)
+		}
+	}
+}
+
+func TestCompat21Values(t *testing.T) {
+	tests := []struct {
+		in         string
+		components [][]string
+	}{
+		{"NOTE:a, b", [][]string{{"a, b"}}},
+		{`ADR:;;C:\path;Berlin`, [][]string{{""}, {""}, {`C:\path`}, {"Berlin"}}},
+		{`NOTE:a\;b\,c\n`, [][]string{{`a;b\,c\n`}}},
+		{"NOTE;CHARSET=ISO-8859-1:M\xfcller, J.", [][]string{{"Müller, J."}}},
+	}
+
+	for _, test := range tests {
+		in := "BEGIN:VCARD\r\nVERSION:2.1\r\n" + test.in + "\r\nEND:VCARD\r\n"
+		p := NewParser(strings.NewReader(in))
+		p.SetCompat21(true)
+		card, err := p.Next()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.in, err)
+			continue
+		}
+		name := test.in[:strings.IndexAny(test.in, ";:")]
+		if got := card.Get(name)[0].Components(); !reflect.DeepEqual(got, test.components) {
+			t.Errorf("%q: got components %q, want %q", test.in, got, test.components)
+		}
+	}
+}
+
+func TestCompat21Version30(t *testing.T) {
+	// Cards which declare a later version keep the usual escapes.
+	const in = "BEGIN:VCARD\r\nVERSION:3.0\r\nNOTE:a\\, b\\nc,d\r\nEND:VCARD\r\n"
+	p := NewParser(strings.NewReader(in))
+	p.SetCompat21(true)
+	card, err := p.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := card.Get("NOTE")[0].Components(), [][]string{{"a, b\nc", "d"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got components %q, want %q", got, want)
+	}
+}
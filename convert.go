@@ -0,0 +1,525 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Warning describes information which was lost or changed in a way that may
+// not be understood when converting a card between versions.
+type Warning struct {
+	Property string // the name of the property concerned
+	Message  string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%v: %v", w.Property, w.Message)
+}
+
+// versions contains the supported versions, in increasing order.
+var versions = []string{"2.1", "3.0", "4.0"}
+
+// binaryProperties contains the names of the properties whose values may be
+// binary data.
+var binaryProperties = map[string]bool{
+	"PHOTO": true,
+	"LOGO":  true,
+	"SOUND": true,
+	"KEY":   true,
+}
+
+// properties40 contains the names of the properties which are only defined
+// in vCard 4.0, and which have no equivalent in earlier versions.
+var properties40 = map[string]bool{
+	"XML":           true,
+	"RELATED":       true,
+	"LANG":          true,
+	"CLIENTPIDMAP":  true,
+	"BIRTHPLACE":    true,
+	"DEATHPLACE":    true,
+	"DEATHDATE":     true,
+	"EXPERTISE":     true,
+	"HOBBY":         true,
+	"INTEREST":      true,
+	"ORG-DIRECTORY": true,
+}
+
+// params40 contains the names of the parameters which are only defined in
+// vCard 4.0, and which have no equivalent in earlier versions.
+var params40 = map[string]bool{
+	"ALTID":    true,
+	"PID":      true,
+	"CALSCALE": true,
+	"GEO":      true,
+	"TZ":       true,
+	"INDEX":    true,
+	"LEVEL":    true,
+}
+
+// properties30 contains the names of the properties which were removed in
+// vCard 4.0.
+var properties30 = map[string]bool{
+	"AGENT":  true,
+	"NAME":   true,
+	"MAILER": true,
+	"CLASS":  true,
+}
+
+// properties30Only contains the names of the properties which were added in
+// vCard 3.0, and which have no equivalent in vCard 2.1.
+var properties30Only = map[string]bool{
+	"NAME":        true,
+	"PROFILE":     true,
+	"SOURCE":      true,
+	"NICKNAME":    true,
+	"CATEGORIES":  true,
+	"PRODID":      true,
+	"SORT-STRING": true,
+	"CLASS":       true,
+	"IMPP":        true,
+}
+
+// ErrUnsupportedVersion is returned by Convert when asked to convert to a
+// version of the vCard specification which it does not support.
+var ErrUnsupportedVersion = errors.New("vcard: unsupported version")
+
+// Convert converts a card to the given version of the vCard specification
+// ("2.1", "3.0" or "4.0"), returning a new card and a list of warnings about
+// any information that was lost or may not be understood in the new version.
+// The original card is not modified. If the card has no VERSION property (or
+// an unsupported version), it is assumed to be vCard 3.0. If the target
+// version is not supported, the error wraps ErrUnsupportedVersion.
+//
+// The conversion handles the differences between versions in the
+// representation of preferences (TYPE=PREF and PREF=1), address labels (the
+// LABEL property and the LABEL parameter of ADR), binary data (ENCODING=b and
+// "data:" URIs), the kind of object represented (KIND and the equivalent
+// extensions used by Apple), geographical positions, time zones and dates, and
+// drops properties and parameters which are not supported by the target
+// version.
+func Convert(card *Card, target string) (*Card, []Warning, error) {
+	to := indexOf(versions, target)
+	if to == -1 {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnsupportedVersion, target)
+	}
+	c := new(converter)
+	from := indexOf(versions, card.text("VERSION"))
+	if from == -1 {
+		c.warn("VERSION", "unsupported or missing version %q, assuming 3.0", card.text("VERSION"))
+		from = indexOf(versions, "3.0")
+	}
+
+	steps := map[string]func(*Card) *Card{
+		"2.1>3.0": c.up21,
+		"3.0>4.0": c.up30,
+		"4.0>3.0": c.down40,
+		"3.0>2.1": c.down30,
+	}
+	for from != to {
+		next := from + 1
+		if to < from {
+			next = from - 1
+		}
+		card = steps[versions[from]+">"+versions[next]](card)
+		from = next
+	}
+	// The final pass ensures that the result is a copy even if no steps
+	// were needed.
+	card = c.convert(card, c.add)
+	card.setText("VERSION", target)
+	return card, c.warnings, nil
+}
+
+// converter holds the state of a conversion between versions.
+type converter struct {
+	warnings []Warning
+	out      *Card // the card being built by the current step
+}
+
+// warn records a warning about a property.
+func (c *converter) warn(name, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, Warning{name, fmt.Sprintf(format, args...)})
+}
+
+// add adds a property to the card being built.
+func (c *converter) add(name string, prop Property) {
+	c.out.Add(name, prop)
+}
+
+// convert builds a new card by calling f with a copy of each property of the
+// given card, in order. The function is responsible for adding the converted
+// properties to the new card using add.
+func (c *converter) convert(card *Card, f func(name string, prop Property)) *Card {
+	c.out = new(Card)
+	card.walk(func(name string, prop Property) error {
+		f(name, prop.clone())
+		return nil
+	})
+	return c.out
+}
+
+// up21 converts a vCard 2.1 card to vCard 3.0.
+func (c *converter) up21(card *Card) *Card {
+	return c.convert(card, func(name string, prop Property) {
+		switch strings.ToUpper(strings.Join(prop.Param("ENCODING"), ",")) {
+		case "BASE64":
+			prop.SetParam("ENCODING", "b")
+		case "7BIT", "8BIT":
+			prop.removeParam("ENCODING")
+		case "QUOTED-PRINTABLE":
+			c.warn(name, "value is still quoted-printable (use Parser.SetCompat21 to decode it)")
+		}
+		switch charset := strings.ToUpper(strings.Join(prop.Param("CHARSET"), ",")); charset {
+		case "":
+		case "UTF-8", "US-ASCII":
+			prop.removeParam("CHARSET")
+		default:
+			c.warn(name, "value is still in charset %v (use Parser.SetCompat21 to decode it)", charset)
+		}
+		if values := prop.Param("VALUE"); len(values) > 0 && strings.EqualFold(values[0], "URL") {
+			prop.SetParam("VALUE", "uri")
+		}
+		c.add(name, prop)
+	})
+}
+
+// up30 converts a vCard 3.0 card to vCard 4.0.
+func (c *converter) up30(card *Card) *Card {
+	labels := matchLabels(card)
+	var sortString []string
+	if props := card.Get("SORT-STRING"); len(props) > 0 {
+		sortString = props[0].Values()
+	}
+	adrs, labelCount := 0, 0 // the number of ADR and LABEL properties seen so far
+	return c.convert(card, func(name string, prop Property) {
+		if properties30[name] {
+			c.warn(name, "property is not supported in vCard 4.0")
+			return
+		}
+		if prop.pref() == 1 && len(prop.Param("PREF")) == 0 {
+			prop.removeType("pref")
+			prop.SetParam("PREF", "1")
+		}
+		if binaryProperties[name] {
+			c.toDataURI(name, &prop)
+		}
+
+		switch name {
+		case "SORT-STRING":
+			if len(card.Get("N")) == 0 {
+				c.warn(name, "property is not supported in vCard 4.0")
+			}
+			return
+		case "N":
+			if sortString != nil && len(prop.Param("SORT-AS")) == 0 {
+				prop.SetParam("SORT-AS", sortString...)
+				sortString = nil
+			}
+		case "LABEL":
+			if !labels.matched[labelCount] {
+				c.warn(name, "no matching ADR property for label")
+			}
+			labelCount++
+			return
+		case "ADR":
+			if label, ok := labels.byADR[adrs]; ok {
+				prop.SetParam("LABEL", label)
+			}
+			adrs++
+		case "X-ABSHOWAS":
+			if strings.EqualFold(prop.text(), "COMPANY") {
+				c.addKind("org")
+				return
+			}
+		case "X-ADDRESSBOOKSERVER-KIND":
+			c.addKind(strings.ToLower(prop.text()))
+			return
+		case "X-ADDRESSBOOKSERVER-MEMBER":
+			name = "MEMBER"
+		case "X-ANNIVERSARY":
+			name = "ANNIVERSARY"
+			toBasicDate(&prop)
+		case "X-GENDER":
+			name = "GENDER"
+		case "GEO":
+			// The value is two floats, which we need to convert to a
+			// "geo:" URI.
+			if len(prop.components) == 2 {
+				prop.setJoined("geo:" + prop.component(0) + "," + prop.component(1))
+			}
+			prop.removeParam("VALUE")
+		case "TZ":
+			if len(prop.Param("VALUE")) == 0 {
+				prop.SetValues(strings.Replace(prop.text(), ":", "", -1))
+				prop.SetParam("VALUE", "utc-offset")
+			} else if strings.EqualFold(prop.Param("VALUE")[0], "text") {
+				prop.removeParam("VALUE")
+			}
+		case "BDAY", "REV":
+			toBasicDate(&prop)
+		}
+		c.add(name, prop)
+	})
+}
+
+// addKind adds a KIND property to the card being built, unless it already has
+// one.
+func (c *converter) addKind(kind string) {
+	if len(c.out.Get("KIND")) == 0 {
+		var prop Property
+		prop.SetValues(kind)
+		c.add("KIND", prop)
+	}
+}
+
+// toBasicDate converts a date, time or date-time in the ISO 8601 extended
+// format (such as "1985-04-12T10:22:00-05:00"), as commonly used in vCard 3.0,
+// to the basic format required by vCard 4.0 (such as "19850412T102200-0500").
+// Values which cannot be parsed are left unchanged.
+func toBasicDate(prop *Property) {
+	if d, err := prop.PartialDate(); err == nil {
+		prop.SetValues(d.String())
+	}
+}
+
+// toDataURI converts inline binary data in a property to a "data:" URI.
+func (c *converter) toDataURI(name string, prop *Property) {
+	if len(prop.Param("ENCODING")) == 0 {
+		// The value is not inline, so it must be a URI.
+		prop.removeParam("VALUE")
+		return
+	}
+	data, mediaType, err := prop.Data()
+	if err != nil {
+		c.warn(name, "cannot convert to data URI: %v", err)
+		return
+	}
+	prop.SetData(data, mediaType, EncodingDataURI)
+}
+
+// labels holds the result of matching LABEL properties to ADR properties.
+type labels struct {
+	byADR   map[int]string // the label for each ADR, by index
+	matched map[int]bool   // whether each LABEL was matched, by index
+}
+
+// matchLabels matches each LABEL property of a card to the first unmatched
+// ADR property with the same group (if any) or TYPE parameter.
+func matchLabels(card *Card) labels {
+	l := labels{byADR: make(map[int]string), matched: make(map[int]bool)}
+	adrs := card.Get("ADR")
+	for i, label := range card.Get("LABEL") {
+		for j, adr := range adrs {
+			if _, ok := l.byADR[j]; ok {
+				continue
+			}
+			sameGroup := label.group != "" && strings.EqualFold(label.group, adr.group)
+			if sameGroup || label.group == "" && sameTypes(label.types(), adr.types()) {
+				l.byADR[j] = label.text()
+				l.matched[i] = true
+				break
+			}
+		}
+	}
+	return l
+}
+
+// sameTypes returns whether two lists of types contain the same types,
+// ignoring case and order.
+func sameTypes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, t := range a {
+		found := false
+		for _, u := range b {
+			if strings.EqualFold(t, u) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// down40 converts a vCard 4.0 card to vCard 3.0.
+func (c *converter) down40(card *Card) *Card {
+	return c.convert(card, func(name string, prop Property) {
+		if properties40[name] {
+			c.warn(name, "property is not supported in vCard 3.0")
+			return
+		}
+		for _, key := range append([]string(nil), prop.paramOrder...) {
+			if params40[key] {
+				c.warn(name, "%v parameter is not supported in vCard 3.0", key)
+				prop.removeParam(key)
+			}
+		}
+		if values := prop.Param("PREF"); len(values) > 0 {
+			if prop.pref() == 1 {
+				prop.addParam("TYPE", "pref")
+			} else {
+				c.warn(name, "preference %v is not supported in vCard 3.0", values[0])
+			}
+			prop.removeParam("PREF")
+		}
+		if binaryProperties[name] {
+			c.fromDataURI(name, &prop)
+		}
+		prop.removeParam("MEDIATYPE")
+		var sortAs []string
+		if name == "N" {
+			sortAs = prop.Param("SORT-AS")
+		} else if len(prop.Param("SORT-AS")) > 0 {
+			c.warn(name, "SORT-AS parameter is not supported in vCard 3.0")
+		}
+		prop.removeParam("SORT-AS")
+		var label string
+		if values := prop.Param("LABEL"); len(values) > 0 {
+			label = strings.Join(values, ",")
+		}
+		prop.removeParam("LABEL")
+
+		switch name {
+		case "KIND":
+			switch kind := strings.ToLower(prop.text()); kind {
+			case "individual":
+			case "org":
+				prop.SetValues("COMPANY")
+				c.add("X-ABSHOWAS", prop)
+			case "group":
+				prop.SetValues("group")
+				c.add("X-ADDRESSBOOKSERVER-KIND", prop)
+			default:
+				c.warn(name, "kind %v is not supported in vCard 3.0", kind)
+			}
+			return
+		case "MEMBER":
+			name = "X-ADDRESSBOOKSERVER-MEMBER"
+		case "ANNIVERSARY":
+			name = "X-ANNIVERSARY"
+		case "GENDER":
+			name = "X-GENDER"
+		case "GEO":
+			value := prop.joined()
+			if !strings.HasPrefix(strings.ToLower(value), "geo:") {
+				c.warn(name, "cannot convert %q to a vCard 3.0 position", value)
+				return
+			}
+			// Any altitude or URI parameters are dropped.
+			coords := strings.Split(strings.SplitN(value[len("geo:"):], ";", 2)[0], ",")
+			if len(coords) < 2 {
+				c.warn(name, "cannot convert %q to a vCard 3.0 position", value)
+				return
+			}
+			prop.removeParam("VALUE")
+			prop.SetComponents([]string{coords[0]}, []string{coords[1]})
+		case "TZ":
+			if t := ValueType("4.0", name, prop); t == "utc-offset" {
+				prop.removeParam("VALUE")
+				if offset := prop.text(); len(offset) == 5 {
+					prop.SetValues(offset[:3] + ":" + offset[3:])
+				}
+			} else if t == "text" {
+				prop.SetParam("VALUE", "text")
+			}
+		case "TEL":
+			if value := prop.joined(); strings.HasPrefix(strings.ToLower(value), "tel:") {
+				prop.removeParam("VALUE")
+				// An extension is written after the number with the
+				// common "x" convention, and any other URI parameters
+				// (such as phone-context) are dropped.
+				parts := strings.Split(value[len("tel:"):], ";")
+				number := parts[0]
+				for _, param := range parts[1:] {
+					if len(param) > len("ext=") && strings.EqualFold(param[:len("ext=")], "ext=") {
+						number += " x" + param[len("ext="):]
+					} else {
+						c.warn(name, "parameter %q of telephone URI is not supported in vCard 3.0", param)
+					}
+				}
+				prop.SetValues(number)
+			}
+		case "BDAY":
+			if d, err := prop.PartialDate(); err == nil && d.HasDate() && !d.hasYear() {
+				c.warn(name, "date without year is not supported in vCard 3.0")
+			}
+		}
+		c.add(name, prop)
+
+		if sortAs != nil {
+			var sortString Property
+			sortString.SetValues(sortAs...)
+			c.add("SORT-STRING", sortString)
+		}
+		if label != "" {
+			var labelProp Property
+			labelProp.group = prop.group
+			if types := prop.Param("TYPE"); len(types) > 0 {
+				labelProp.SetParam("TYPE", types...)
+			}
+			labelProp.SetValues(label)
+			c.add("LABEL", labelProp)
+		}
+	})
+}
+
+// fromDataURI converts a "data:" URI in a property to inline binary data.
+func (c *converter) fromDataURI(name string, prop *Property) {
+	data, mediaType, err := prop.Data()
+	if err == ErrNotInline {
+		// In vCard 3.0, the default is inline data, so URIs must be
+		// marked as such.
+		prop.SetParam("VALUE", "uri")
+		return
+	} else if err != nil {
+		c.warn(name, "cannot convert data URI: %v", err)
+		return
+	}
+	prop.SetData(data, mediaType, EncodingB)
+}
+
+// down30 converts a vCard 3.0 card to vCard 2.1.
+func (c *converter) down30(card *Card) *Card {
+	return c.convert(card, func(name string, prop Property) {
+		if properties30Only[name] {
+			c.warn(name, "property is not supported in vCard 2.1")
+			return
+		}
+		if values := prop.Param("ENCODING"); len(values) > 0 && strings.EqualFold(values[0], "b") {
+			prop.SetParam("ENCODING", "BASE64")
+		}
+		if values := prop.Param("VALUE"); len(values) > 0 && strings.EqualFold(values[0], "uri") {
+			prop.SetParam("VALUE", "URL")
+		}
+		nonASCII := false
+		for _, values := range prop.components {
+			for _, value := range values {
+				if strings.Contains(value, "\n") {
+					c.warn(name, "line breaks are not supported in vCard 2.1 without quoted-printable encoding")
+				}
+				for i := 0; i < len(value); i++ {
+					if value[i] >= utf8.RuneSelf {
+						nonASCII = true
+					}
+				}
+			}
+		}
+		if nonASCII {
+			prop.SetParam("CHARSET", "UTF-8")
+		}
+		c.add(name, prop)
+	})
+}
@@ -0,0 +1,106 @@
+package vcard
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		in       string
+		target   string
+		out      string
+		warnings []Warning
+	}{
+		{
+			"BEGIN:VCARD\nVERSION:3.0\nN:Doe;John;;;\nFN:John Doe\nSORT-STRING:Doe\nEMAIL;TYPE=work,pref:john@example.com\nADR;TYPE=home:;;1 Main St;Springfield;;;\nLABEL;TYPE=home:1 Main St\\nSpringfield\nMAILER:Mail\nX-ABShowAs:COMPANY\nGEO:37.386013;-122.082932\nTZ:-05:00\nBDAY:1985-04-12\nEND:VCARD",
+			"4.0",
+			"BEGIN:VCARD\nVERSION:4.0\nN;SORT-AS=Doe:Doe;John;;;\nFN:John Doe\nEMAIL;TYPE=work;PREF=1:john@example.com\nADR;TYPE=home;LABEL=1 Main St^nSpringfield:;;1 Main St;Springfield;;;\nKIND:org\nGEO:geo:37.386013,-122.082932\nTZ;VALUE=utc-offset:-0500\nBDAY:19850412\nEND:VCARD\n",
+			[]Warning{{"MAILER", "property is not supported in vCard 4.0"}},
+		},
+		{
+			"BEGIN:VCARD\nVERSION:3.0\nFN:a\nLABEL;TYPE=work:Somewhere\nPHOTO;ENCODING=b;TYPE=JPEG:aGVsbG8=\nEND:VCARD",
+			"4.0",
+			"BEGIN:VCARD\nVERSION:4.0\nFN:a\nPHOTO:data:image/jpeg;base64,aGVsbG8=\nEND:VCARD\n",
+			[]Warning{{"LABEL", "no matching ADR property for label"}},
+		},
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nKIND:org\nN;SORT-AS=Doe:Doe;John;;;\nFN:John Doe\nEMAIL;PREF=1;PID=1.1:john@example.com\nTEL;PREF=2;VALUE=uri:tel:+1-555-555-5555\nADR;TYPE=home;LABEL=\"1 Main St\":;;1 Main St;Springfield;;;\nPHOTO:data:image/png;base64,aGVsbG8=\nGEO:geo:37.386013,-122.082932\nTZ;VALUE=utc-offset:-0500\nGENDER:M\nHOBBY:reading\nBDAY:--0412\nEND:VCARD",
+			"3.0",
+			"BEGIN:VCARD\nVERSION:3.0\nX-ABSHOWAS:COMPANY\nN:Doe;John;;;\nSORT-STRING:Doe\nFN:John Doe\nEMAIL;TYPE=pref:john@example.com\nTEL:+1-555-555-5555\nADR;TYPE=home:;;1 Main St;Springfield;;;\nLABEL;TYPE=home:1 Main St\nPHOTO;ENCODING=b;TYPE=PNG:aGVsbG8=\nGEO:37.386013;-122.082932\nTZ:-05:00\nX-GENDER:M\nBDAY:--0412\nEND:VCARD\n",
+			[]Warning{
+				{"EMAIL", "PID parameter is not supported in vCard 3.0"},
+				{"TEL", "preference 2 is not supported in vCard 3.0"},
+				{"HOBBY", "property is not supported in vCard 3.0"},
+				{"BDAY", "date without year is not supported in vCard 3.0"},
+			},
+		},
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nFN:Jöhn\nNICKNAME:Johnny\nPHOTO:http://example.com/photo.jpg\nEND:VCARD",
+			"2.1",
+			"BEGIN:VCARD\nVERSION:2.1\nFN;CHARSET=UTF-8:Jöhn\nPHOTO;VALUE=URL:http://example.com/photo.jpg\nEND:VCARD\n",
+			[]Warning{{"NICKNAME", "property is not supported in vCard 2.1"}},
+		},
+		{
+			"BEGIN:VCARD\nVERSION:2.1\nFN:a\nPHOTO;ENCODING=BASE64;TYPE=GIF:aGVsbG8=\nEND:VCARD",
+			"4.0",
+			"BEGIN:VCARD\nVERSION:4.0\nFN:a\nPHOTO:data:image/gif;base64,aGVsbG8=\nEND:VCARD\n",
+			nil,
+		},
+		{
+			"BEGIN:VCARD\nVERSION:4.0\nFN:a\nTEL;VALUE=uri:tel:+1-555-0100;ext=102\nTEL;VALUE=uri:tel:0100;phone-context=example.com\nEND:VCARD",
+			"3.0",
+			"BEGIN:VCARD\nVERSION:3.0\nFN:a\nTEL:+1-555-0100 x102\nTEL:0100\nEND:VCARD\n",
+			[]Warning{{"TEL", `parameter "phone-context=example.com" of telephone URI is not supported in vCard 3.0`}},
+		},
+		{
+			"BEGIN:VCARD\nFN:a\nEND:VCARD",
+			"3.0",
+			"BEGIN:VCARD\nVERSION:3.0\nFN:a\nEND:VCARD\n",
+			[]Warning{{"VERSION", `unsupported or missing version "", assuming 3.0`}},
+		},
+	}
+
+	for _, test := range tests {
+		cards, err := ParseAll(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("parsing %q: unexpected error: %v", test.in, err)
+			continue
+		}
+		card, warnings, err := Convert(cards[0], test.target)
+		if err != nil {
+			t.Errorf("Convert(%q, %q): unexpected error: %v", test.in, test.target, err)
+			continue
+		}
+		if out := card.UnfoldedString(); out != test.out {
+			t.Errorf("Convert(%q, %q) = %q, want %q", test.in, test.target, out, test.out)
+		}
+		if !reflect.DeepEqual(warnings, test.warnings) {
+			t.Errorf("Convert(%q, %q) warnings = %v, want %v", test.in, test.target, warnings, test.warnings)
+		}
+	}
+}
+
+func TestConvertDoesNotModify(t *testing.T) {
+	cards, err := ParseAll(strings.NewReader(sampleVCard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := cards[0].UnfoldedString()
+	Convert(cards[0], "4.0")
+	if got := cards[0].UnfoldedString(); got != want {
+		t.Errorf("original card modified: got %q, want %q", got, want)
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	cards, err := ParseAll(strings.NewReader(sampleVCard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if card, _, err := Convert(cards[0], "5.0"); card != nil || !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got card %v, error %v, want ErrUnsupportedVersion", card, err)
+	}
+}
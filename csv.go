@@ -0,0 +1,558 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Column describes how a column of a CSV file corresponds to part of a
+// property of a card.
+//
+// Columns with the same Property, Types and Index refer to the same
+// occurrence of the property, so that (for example) the components of an
+// address can be given in separate columns.
+type Column struct {
+	Header   string   // the header of the column, in the first row
+	Property string   // the name of the property, such as "EMAIL"
+	Types    []string // the values of the TYPE parameter to match or set
+	// Index is the index of the occurrence among those matching Types, so
+	// that properties which may appear more than once can be given in
+	// numbered columns.
+	Index int
+	// Component is the index of the component of the value in the column,
+	// or -1 for the whole value.
+	Component int
+	// Param, if not empty, is the name of a parameter whose values are in
+	// the column instead of the value of the property.
+	Param string
+	// Separator separates the values of Param in the column, or is empty
+	// to separate them by commas.
+	Separator string
+}
+
+// Mapping is a set of columns describing the layout of a CSV file.
+type Mapping []Column
+
+// slot is the part of a column identifying the occurrence it refers to.
+type slot struct {
+	name  string
+	types string // the lowercase types, sorted and joined by commas
+	index int
+}
+
+// slot returns the slot of the column.
+func (col *Column) slot() slot {
+	types := make([]string, len(col.Types))
+	for i, t := range col.Types {
+		types[i] = strings.ToLower(t)
+	}
+	sort.Strings(types)
+	return slot{strings.ToUpper(col.Property), strings.Join(types, ","), col.Index}
+}
+
+// separator returns the separator between values of the parameter in the
+// column.
+func (col *Column) separator() string {
+	if col.Separator == "" {
+		return ","
+	}
+	return col.Separator
+}
+
+// column returns a column with the given header for a component (or the
+// whole value, if i is -1) of a property.
+func column(header, name string, i int, types ...string) Column {
+	return Column{Header: header, Property: name, Types: types, Component: i}
+}
+
+// numbered returns columns for the first n occurrences of a property, with
+// headers formed by replacing "#" in each of the given headers by the number
+// of the occurrence (starting from 1). Each of the given columns should have
+// an Index of 0.
+func numbered(n int, cols ...Column) Mapping {
+	var m Mapping
+	for i := 0; i < n; i++ {
+		for _, col := range cols {
+			col.Header = strings.Replace(col.Header, "#", strconv.Itoa(i+1), -1)
+			col.Index = i
+			m = append(m, col)
+		}
+	}
+	return m
+}
+
+// DefaultMapping returns a mapping with a column for each of the common
+// single-valued properties (such as FN and the components of N), and columns
+// for the first n occurrences of EMAIL, TEL, ADR and URL.
+func DefaultMapping(n int) Mapping {
+	m := Mapping{
+		column("Formatted Name", "FN", -1),
+		column("Family Name", "N", 0),
+		column("Given Name", "N", 1),
+		column("Additional Names", "N", 2),
+		column("Honorific Prefixes", "N", 3),
+		column("Honorific Suffixes", "N", 4),
+		column("Nickname", "NICKNAME", -1),
+		column("Organization", "ORG", -1),
+		column("Title", "TITLE", -1),
+		column("Birthday", "BDAY", -1),
+		column("Note", "NOTE", -1),
+		column("UID", "UID", -1),
+	}
+	m = append(m, numbered(n,
+		column("Email #", "EMAIL", -1),
+		Column{Header: "Email # Type", Property: "EMAIL", Component: -1, Param: "TYPE"},
+	)...)
+	m = append(m, numbered(n,
+		column("Phone #", "TEL", -1),
+		Column{Header: "Phone # Type", Property: "TEL", Component: -1, Param: "TYPE"},
+	)...)
+	m = append(m, numbered(n,
+		Column{Header: "Address # Type", Property: "ADR", Component: -1, Param: "TYPE"},
+		column("Address # PO Box", "ADR", 0),
+		column("Address # Extended", "ADR", 1),
+		column("Address # Street", "ADR", 2),
+		column("Address # Locality", "ADR", 3),
+		column("Address # Region", "ADR", 4),
+		column("Address # Postal Code", "ADR", 5),
+		column("Address # Country", "ADR", 6),
+	)...)
+	m = append(m, numbered(n,
+		column("URL #", "URL", -1),
+	)...)
+	return m
+}
+
+// googleSeparator separates the types in a Google Contacts CSV file, as in
+// "* Home ::: Work".
+const googleSeparator = " ::: "
+
+// GoogleMapping returns a mapping for the CSV layout used by Google Contacts,
+// with columns for the first n occurrences of EMAIL, TEL, ADR and URL. When
+// reading, columns which are not present in the file are ignored, so n may
+// be larger than necessary.
+func GoogleMapping(n int) Mapping {
+	m := Mapping{
+		column("Name", "FN", -1),
+		column("Given Name", "N", 1),
+		column("Additional Name", "N", 2),
+		column("Family Name", "N", 0),
+		column("Name Prefix", "N", 3),
+		column("Name Suffix", "N", 4),
+		column("Nickname", "NICKNAME", -1),
+		column("Birthday", "BDAY", -1),
+		column("Notes", "NOTE", -1),
+		column("Organization 1 - Name", "ORG", 0),
+		column("Organization 1 - Title", "TITLE", -1),
+		column("Organization 1 - Department", "ORG", 1),
+	}
+	m = append(m, numbered(n,
+		Column{Header: "E-mail # - Type", Property: "EMAIL", Component: -1, Param: "TYPE", Separator: googleSeparator},
+		column("E-mail # - Value", "EMAIL", -1),
+	)...)
+	m = append(m, numbered(n,
+		Column{Header: "Phone # - Type", Property: "TEL", Component: -1, Param: "TYPE", Separator: googleSeparator},
+		column("Phone # - Value", "TEL", -1),
+	)...)
+	m = append(m, numbered(n,
+		Column{Header: "Address # - Type", Property: "ADR", Component: -1, Param: "TYPE", Separator: googleSeparator},
+		Column{Header: "Address # - Formatted", Property: "ADR", Component: -1, Param: "LABEL"},
+		column("Address # - Street", "ADR", 2),
+		column("Address # - City", "ADR", 3),
+		column("Address # - PO Box", "ADR", 0),
+		column("Address # - Region", "ADR", 4),
+		column("Address # - Postal Code", "ADR", 5),
+		column("Address # - Country", "ADR", 6),
+		column("Address # - Extended Address", "ADR", 1),
+	)...)
+	m = append(m, numbered(n,
+		Column{Header: "Website # - Type", Property: "URL", Component: -1, Param: "TYPE", Separator: googleSeparator},
+		column("Website # - Value", "URL", -1),
+	)...)
+	return m
+}
+
+// OutlookMapping returns a mapping for the CSV layout used by Microsoft
+// Outlook. Outlook has a fixed set of columns, most of which are
+// distinguished by type (such as "Business Phone" and "Home Phone"), so
+// properties without any of the expected types are only written if there is
+// a column for them (such as "Other Phone") which is not already used.
+func OutlookMapping() Mapping {
+	return Mapping{
+		column("Title", "N", 3),
+		column("First Name", "N", 1),
+		column("Middle Name", "N", 2),
+		column("Last Name", "N", 0),
+		column("Suffix", "N", 4),
+		column("Company", "ORG", 0),
+		column("Department", "ORG", 1),
+		column("Job Title", "TITLE", -1),
+		column("Business Street", "ADR", 2, "work"),
+		column("Business City", "ADR", 3, "work"),
+		column("Business State", "ADR", 4, "work"),
+		column("Business Postal Code", "ADR", 5, "work"),
+		column("Business Country/Region", "ADR", 6, "work"),
+		column("Home Street", "ADR", 2, "home"),
+		column("Home City", "ADR", 3, "home"),
+		column("Home State", "ADR", 4, "home"),
+		column("Home Postal Code", "ADR", 5, "home"),
+		column("Home Country/Region", "ADR", 6, "home"),
+		column("Other Street", "ADR", 2),
+		column("Other City", "ADR", 3),
+		column("Other State", "ADR", 4),
+		column("Other Postal Code", "ADR", 5),
+		column("Other Country/Region", "ADR", 6),
+		column("Business Fax", "TEL", -1, "work", "fax"),
+		column("Business Phone", "TEL", -1, "work"),
+		{Header: "Business Phone 2", Property: "TEL", Types: []string{"work"}, Index: 1, Component: -1},
+		column("Home Fax", "TEL", -1, "home", "fax"),
+		column("Home Phone", "TEL", -1, "home"),
+		{Header: "Home Phone 2", Property: "TEL", Types: []string{"home"}, Index: 1, Component: -1},
+		column("Mobile Phone", "TEL", -1, "cell"),
+		column("Pager", "TEL", -1, "pager"),
+		column("Other Phone", "TEL", -1),
+		column("Birthday", "BDAY", -1),
+		column("Notes", "NOTE", -1),
+		column("E-mail Address", "EMAIL", -1),
+		{Header: "E-mail 2 Address", Property: "EMAIL", Index: 1, Component: -1},
+		{Header: "E-mail 3 Address", Property: "EMAIL", Index: 2, Component: -1},
+		column("Web Page", "URL", -1),
+	}
+}
+
+// CSVParser reads cards from CSV input, in which the first row contains the
+// headers of the columns and each following row is a card. The columns are
+// matched to those of a Mapping by their headers (case-insensitively), and
+// columns which are not in the mapping are ignored.
+//
+// Each card has a VERSION of "4.0". If the mapping does not provide an FN
+// property, it is formed from the components of N (or, failing that, the
+// organization name) so that the card is valid.
+type CSVParser struct {
+	r       *csv.Reader
+	m       Mapping
+	columns []*Column // the column of the mapping for each column of input, if any
+	started bool
+}
+
+// NewCSVParser returns a new parser reading CSV input with the given layout.
+func NewCSVParser(r io.Reader, m Mapping) *CSVParser {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &CSVParser{r: cr, m: m}
+}
+
+// ParseAllCSV parses all the cards in the given CSV input.
+func ParseAllCSV(r io.Reader, m Mapping) ([]*Card, error) {
+	p := NewCSVParser(r, m)
+	var cards []*Card
+	for {
+		card, err := p.Next()
+		if err == io.EOF {
+			return cards, nil
+		} else if err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+}
+
+// Next returns the card in the next row of input. If there are no more rows,
+// the error will be io.EOF. Empty rows are skipped.
+func (p *CSVParser) Next() (*Card, error) {
+	if !p.started {
+		header, err := p.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		p.started = true
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+		p.columns = make([]*Column, len(header))
+		for i, h := range header {
+			h = strings.TrimSpace(h)
+			for j := range p.m {
+				if strings.EqualFold(p.m[j].Header, h) {
+					p.columns[i] = &p.m[j]
+					break
+				}
+			}
+		}
+	}
+
+	for {
+		row, err := p.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if card := p.card(row); card != nil {
+			return card, nil
+		}
+	}
+}
+
+// card returns the card in a row, or nil if the row is empty.
+func (p *CSVParser) card(row []string) *Card {
+	var slots []slot
+	props := make(map[slot]*Property)
+	cols := make(map[slot]*Column) // a column of each slot, for its types
+	for i, value := range row {
+		if i >= len(p.columns) || p.columns[i] == nil || strings.TrimSpace(value) == "" {
+			continue
+		}
+		col := p.columns[i]
+		s := col.slot()
+		prop, ok := props[s]
+		if !ok {
+			prop = new(Property)
+			props[s] = prop
+			cols[s] = col
+			slots = append(slots, s)
+		}
+
+		switch {
+		case col.Param != "":
+			var values []string
+			for _, v := range strings.Split(value, col.separator()) {
+				// Google Contacts marks the primary value with "* ".
+				v = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(v), "*"))
+				if v != "" {
+					values = append(values, v)
+				}
+			}
+			prop.addParam(col.Param, values...)
+		case col.Component < 0 && (len(componentNames[s.name]) > 0 || s.name == "ORG"):
+			components := strings.Split(value, ";")
+			for j, component := range components {
+				setComponent(prop, j, component)
+			}
+		case col.Component < 0:
+			setComponent(prop, 0, value)
+		default:
+			setComponent(prop, col.Component, value)
+		}
+	}
+	if len(slots) == 0 {
+		return nil
+	}
+
+	card := new(Card)
+	card.Add("VERSION", Property{components: [][]string{{"4.0"}}})
+	for _, s := range slots {
+		prop := props[s]
+		if n := len(componentNames[s.name]); len(prop.components) < n {
+			setComponent(prop, n-1, "")
+		}
+		for i := range prop.components {
+			if prop.components[i] == nil {
+				prop.components[i] = []string{""}
+			}
+		}
+		if len(prop.components) == 0 {
+			// Only parameters were given.
+			continue
+		}
+		if types := cols[s].Types; len(types) > 0 {
+			prop.SetParam("TYPE", append(append([]string(nil), types...), prop.Param("TYPE")...)...)
+		}
+		card.Add(s.name, *prop)
+	}
+	if len(card.Get("FN")) == 0 {
+		card.setText("FN", formattedName(card))
+	}
+	return card
+}
+
+// setComponent sets the value of a component of a property, adding empty
+// components before it if necessary.
+func setComponent(prop *Property, i int, value string) {
+	for len(prop.components) <= i {
+		prop.components = append(prop.components, nil)
+	}
+	prop.components[i] = []string{value}
+}
+
+// formattedName returns a name for a card without an FN property, formed
+// from the components of N or the organization name.
+func formattedName(card *Card) string {
+	name := card.Name()
+	var parts []string
+	for _, values := range [][]string{name.Prefix, name.Given, name.Additional, name.Family, name.Suffix} {
+		for _, part := range values {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, " ")
+	}
+	if org := card.Organization(); len(org) > 0 {
+		return org[0]
+	}
+	return ""
+}
+
+// CSVEncoder writes cards as rows of CSV output, according to a Mapping. The
+// first row contains the headers of the columns, and is written before the
+// first card (or by Flush, if there are none).
+//
+// Each occurrence of a property is written in at most one set of columns.
+// Columns with more Types are filled first, so that (for example) a
+// telephone number with the types "work" and "fax" is written in a column
+// for work fax numbers rather than one for all work numbers, if there is
+// one.
+type CSVEncoder struct {
+	w       *csv.Writer
+	m       Mapping
+	slots   []slot // the distinct slots of the mapping, in the order they are filled
+	started bool
+}
+
+// NewCSVEncoder returns a new encoder that writes to the given writer with
+// the given layout. The output is buffered, so Flush must be called when
+// all cards have been encoded.
+func NewCSVEncoder(w io.Writer, m Mapping) *CSVEncoder {
+	e := &CSVEncoder{w: csv.NewWriter(w), m: m}
+	seen := make(map[slot]bool)
+	for i := range m {
+		if s := m[i].slot(); !seen[s] {
+			seen[s] = true
+			e.slots = append(e.slots, s)
+		}
+	}
+	sort.SliceStable(e.slots, func(i, j int) bool {
+		return typeCount(e.slots[i]) > typeCount(e.slots[j])
+	})
+	return e
+}
+
+// typeCount returns the number of types of a slot.
+func typeCount(s slot) int {
+	if s.types == "" {
+		return 0
+	}
+	return strings.Count(s.types, ",") + 1
+}
+
+// Encode writes a card as a single row.
+func (e *CSVEncoder) Encode(card *Card) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	// Assign each slot an occurrence of its property. The slots with the
+	// same name and types are filled at the same time, from the
+	// occurrences which have not already been used.
+	props := make(map[slot]Property)
+	used := make(map[string][]bool)
+	filled := make(map[slot]bool) // the groups already filled, with index 0
+	for _, group := range e.slots {
+		group.index = 0
+		if filled[group] {
+			continue
+		}
+		filled[group] = true
+		all := card.Get(group.name)
+		if used[group.name] == nil {
+			used[group.name] = make([]bool, len(all))
+		}
+		var matching []int
+		for i, prop := range all {
+			if !used[group.name][i] && hasTypes(prop, group.types) {
+				matching = append(matching, i)
+			}
+		}
+		for _, s := range e.slots {
+			if s.name == group.name && s.types == group.types && s.index < len(matching) {
+				props[s] = all[matching[s.index]]
+				used[s.name][matching[s.index]] = true
+			}
+		}
+	}
+
+	row := make([]string, len(e.m))
+	for i := range e.m {
+		col := &e.m[i]
+		prop, ok := props[col.slot()]
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.EqualFold(col.Param, "TYPE"):
+			var types []string
+			for _, t := range prop.types() {
+				if !containsFold(col.Types, t) {
+					types = append(types, t)
+				}
+			}
+			row[i] = strings.Join(types, col.separator())
+		case col.Param != "":
+			row[i] = strings.Join(prop.Param(col.Param), col.separator())
+		case col.Component < 0:
+			row[i] = prop.joined()
+		default:
+			row[i] = prop.component(col.Component)
+		}
+	}
+	return e.w.Write(row)
+}
+
+// Flush writes any buffered output to the underlying writer, including the
+// header row if no cards have been encoded.
+func (e *CSVEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// writeHeader writes the header row, if it has not already been written.
+func (e *CSVEncoder) writeHeader() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	header := make([]string, len(e.m))
+	for i, col := range e.m {
+		header[i] = col.Header
+	}
+	return e.w.Write(header)
+}
+
+// hasTypes returns whether a property has all of the given types, which are
+// lowercase and joined by commas.
+func hasTypes(prop Property, types string) bool {
+	if types == "" {
+		return true
+	}
+	have := prop.types()
+	for _, t := range strings.Split(types, ",") {
+		if !containsFold(have, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold returns whether a slice contains a string, ignoring case.
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package vcard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeCSV(t *testing.T) {
+	card := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nN:Doe;John;Q.;;\nORG:ABC\\, Inc.;Sales\n"+
+		"EMAIL;TYPE=work:john@example.com\nEMAIL:jd@example.org\n"+
+		"TEL;TYPE=home:555-0100\nTEL;TYPE=work,fax:555-0101\nTEL;TYPE=work:555-0102\nTEL;TYPE=voice:555-0103\n"+
+		"ADR;TYPE=work;LABEL=\"1 Main St\":;;1 Main St;Springfield;IL;62701;USA\nEND:VCARD")
+
+	tests := []struct {
+		m    Mapping
+		want string
+	}{
+		{DefaultMapping(1), "Formatted Name,Family Name,Given Name,Additional Names,Honorific Prefixes,Honorific Suffixes,Nickname,Organization,Title,Birthday,Note,UID," +
+			"Email 1,Email 1 Type,Phone 1,Phone 1 Type,Address 1 Type,Address 1 PO Box,Address 1 Extended,Address 1 Street,Address 1 Locality,Address 1 Region,Address 1 Postal Code,Address 1 Country,URL 1\n" +
+			"John Doe,Doe,John,Q.,,,,\"ABC, Inc.;Sales\",,,,,john@example.com,work,555-0100,home,work,,,1 Main St,Springfield,IL,62701,USA,\n"},
+		{Mapping{
+			column("Name", "FN", -1),
+			column("Business Phone", "TEL", -1, "work"),
+			column("Business Fax", "TEL", -1, "WORK", "fax"),
+			column("Other Phone", "TEL", -1),
+			{Header: "Other Phone 2", Property: "TEL", Index: 1, Component: -1},
+			{Header: "Email 2", Property: "EMAIL", Index: 1, Component: -1},
+			{Header: "Address", Property: "ADR", Component: -1, Param: "LABEL"},
+		}, "Name,Business Phone,Business Fax,Other Phone,Other Phone 2,Email 2,Address\n" +
+			"John Doe,555-0102,555-0101,555-0100,555-0103,jd@example.org,1 Main St\n"},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		enc := NewCSVEncoder(buf, test.m)
+		if err := enc.Encode(card); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("got %q, want %q", buf, test.want)
+		}
+	}
+}
+
+func TestEncodeCSVEmpty(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := NewCSVEncoder(buf, Mapping{column("Name", "FN", -1)}).Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "Name\n" {
+		t.Errorf("got %q, want header only", buf)
+	}
+}
+
+func TestParseCSVGoogle(t *testing.T) {
+	const in = "\ufeffName,Given Name,Family Name,E-mail 1 - Type,E-mail 1 - Value,E-mail 2 - Type,E-mail 2 - Value," +
+		"Phone 1 - Type,Phone 1 - Value,Address 1 - Type,Address 1 - Street,Address 1 - City,Address 1 - Postal Code,Unknown\n" +
+		"Jane Roe,Jane,Roe,* Work ::: Home,jane@example.com,,jroe@example.org,Mobile,555-0100,Home,2 Elm St,Shelbyville,62565,x\n" +
+		",,,,,,,,,,,,,\n" +
+		"Bob,Bob,,,bob@example.com,,,,,,,,,\n"
+	cards, err := ParseAllCSV(strings.NewReader(in), GoogleMapping(3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"BEGIN:VCARD\nVERSION:4.0\nFN:Jane Roe\nN:Roe;Jane;;;\nEMAIL;TYPE=Work,Home:jane@example.com\nEMAIL:jroe@example.org\n" +
+			"TEL;TYPE=Mobile:555-0100\nADR;TYPE=Home:;;2 Elm St;Shelbyville;;62565;\nEND:VCARD\n",
+		"BEGIN:VCARD\nVERSION:4.0\nFN:Bob\nN:;Bob;;;\nEMAIL:bob@example.com\nEND:VCARD\n",
+	}
+	if len(cards) != len(want) {
+		t.Fatalf("got %v cards, want %v", len(cards), len(want))
+	}
+	for i, card := range cards {
+		if got := card.UnfoldedString(); got != want[i] {
+			t.Errorf("card %v: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestEncodeCSVGoogleTypes(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := NewCSVEncoder(buf, Mapping{
+		{Header: "Phone 1 - Type", Property: "TEL", Component: -1, Param: "TYPE", Separator: googleSeparator},
+		column("Phone 1 - Value", "TEL", -1),
+	})
+	if err := enc.Encode(parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nTEL;TYPE=home,voice:555-0100\nEND:VCARD\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "Phone 1 - Type,Phone 1 - Value\nhome ::: voice,555-0100\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf, want)
+	}
+}
+
+func TestParseCSVOutlook(t *testing.T) {
+	const in = "First Name,Last Name,Company,Business Phone,Mobile Phone,Business Fax,E-mail Address,Business City\r\n" +
+		"John,Doe,ABC,555-0100,555-0101,555-0102,john@example.com,Springfield\r\n" +
+		",,XYZ Corp,,,,,\r\n"
+	cards, err := ParseAllCSV(strings.NewReader(in), OutlookMapping())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"BEGIN:VCARD\nVERSION:4.0\nN:Doe;John;;;\nORG:ABC\nTEL;TYPE=work:555-0100\nTEL;TYPE=cell:555-0101\n" +
+			"TEL;TYPE=work,fax:555-0102\nEMAIL:john@example.com\nADR;TYPE=work:;;;Springfield;;;\nFN:John Doe\nEND:VCARD\n",
+		"BEGIN:VCARD\nVERSION:4.0\nORG:XYZ Corp\nFN:XYZ Corp\nEND:VCARD\n",
+	}
+	if len(cards) != len(want) {
+		t.Fatalf("got %v cards, want %v", len(cards), len(want))
+	}
+	for i, card := range cards {
+		if got := card.UnfoldedString(); got != want[i] {
+			t.Errorf("card %v: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	const in = "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nN:Doe;John;;Dr.;\nORG:ABC;Sales\nTITLE:Manager\n" +
+		"EMAIL;TYPE=work:john@example.com\nTEL;TYPE=cell:555-0100\nTEL;TYPE=home,voice:555-0101\n" +
+		"ADR;TYPE=home:;;1 Main St;Springfield;IL;62701;USA\nURL:http://example.com\nEND:VCARD\n"
+	for _, m := range []Mapping{DefaultMapping(2), GoogleMapping(2)} {
+		buf := new(bytes.Buffer)
+		enc := NewCSVEncoder(buf, m)
+		if err := enc.Encode(parseCard(t, in)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cards, err := ParseAllCSV(buf, m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(cards) != 1 || !cards[0].Equal(parseCard(t, in)) {
+			t.Errorf("got %q, want %q", cards, in)
+		}
+	}
+}
+
+func TestParseCSVFailure(t *testing.T) {
+	tests := []string{
+		"Name\n\"unterminated\n",
+	}
+
+	for _, test := range tests {
+		if cards, err := ParseAllCSV(strings.NewReader(test), DefaultMapping(1)); err == nil {
+			t.Errorf("successfully parsed %q as %q", test, cards)
+		}
+	}
+}
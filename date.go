@@ -0,0 +1,319 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Date is a date and/or time, any of whose fields may be absent, as used by
+// properties such as BDAY, ANNIVERSARY and DEATHDATE. For example, a birthday
+// may be given without a year ("--0415") or with only a year ("1985").
+//
+// The month and day are absent if they are zero. Since the other fields may
+// be present with the value zero (as in "T1400"), they are absent if they are
+// zero and the corresponding Has field is not set; ParseDate only sets a Has
+// field if its field is zero. The zero Date therefore has no fields present,
+// and Date{Month: 4, Day: 15} is the date "--0415".
+//
+// Not every combination of present fields can be represented: the date must
+// be a year, a year and month, a complete date, a month, a month and day, or a
+// day; and similarly for the time. In addition, RFC 6350 only allows a date
+// and time to appear together if the date has a day and the time has an hour.
+type Date struct {
+	Year, Month, Day     int
+	Hour, Minute, Second int
+
+	HasYear, HasHour, HasMinute, HasSecond bool // whether zero fields are present
+
+	HasOffset bool          // whether the UTC offset is given
+	Offset    time.Duration // the offset of the time zone from UTC
+}
+
+// ParseDate parses a date and/or time in any of the forms allowed by vCard
+// 3.0 and 4.0: a date, a time preceded by "T", or a date and time separated by
+// "T". Both the basic format of vCard 4.0 (such as "19961022T140000-0500") and
+// the extended format commonly used in vCard 3.0 (such as
+// "1996-10-22T14:00:00-05:00") are accepted, as is a date followed by an empty
+// time ("19850412T").
+func ParseDate(s string) (Date, error) {
+	var d Date
+	date, t := s, ""
+	i := strings.IndexByte(s, 'T')
+	if i != -1 {
+		date, t = s[:i], s[i+1:]
+	}
+	if date != "" || i == -1 {
+		if rest, ok := parseDate(date, &d); !ok || rest != "" || d.Day > daysIn(d) {
+			return Date{}, fmt.Errorf("vcard: invalid date %q", s)
+		}
+	}
+	if t != "" || i == 0 {
+		if rest, ok := parseTime(t, &d); !ok || rest != "" {
+			return Date{}, fmt.Errorf("vcard: invalid date %q", s)
+		}
+	}
+	// The parsers mark every field they find as present, but only zero
+	// fields need to be marked.
+	d.HasYear = d.HasYear && d.Year == 0
+	d.HasHour = d.HasHour && d.Hour == 0
+	d.HasMinute = d.HasMinute && d.Minute == 0
+	d.HasSecond = d.HasSecond && d.Second == 0
+	return d, nil
+}
+
+func (d Date) hasYear() bool   { return d.Year != 0 || d.HasYear }
+func (d Date) hasMonth() bool  { return d.Month != 0 }
+func (d Date) hasDay() bool    { return d.Day != 0 }
+func (d Date) hasHour() bool   { return d.Hour != 0 || d.HasHour }
+func (d Date) hasMinute() bool { return d.Minute != 0 || d.HasMinute }
+func (d Date) hasSecond() bool { return d.Second != 0 || d.HasSecond }
+
+// HasDate returns whether any of the date fields (the year, month and day) are
+// present.
+func (d Date) HasDate() bool {
+	return d.hasYear() || d.hasMonth() || d.hasDay()
+}
+
+// HasTime returns whether any of the time fields (the hour, minute and second)
+// are present.
+func (d Date) HasTime() bool {
+	return d.hasHour() || d.hasMinute() || d.hasSecond()
+}
+
+// Time returns the date as a time.Time, giving any absent fields their lowest
+// possible values (zero for the year and time fields and one for the month
+// and day). The result is in UTC unless the UTC offset is given.
+func (d Date) Time() time.Time {
+	month, day := d.Month, d.Day
+	if !d.hasMonth() {
+		month = 1
+	}
+	if !d.hasDay() {
+		day = 1
+	}
+	loc := time.UTC
+	if d.HasOffset && d.Offset != 0 {
+		loc = time.FixedZone("", int(d.Offset/time.Second))
+	}
+	return time.Date(d.Year, time.Month(month), day, d.Hour, d.Minute, d.Second, 0, loc)
+}
+
+// String returns the date in the basic format used by vCard 4.0, such as
+// "--0415", "19850412T1022" or "T102200Z".
+func (d Date) String() string {
+	return d.format(false)
+}
+
+// format returns the date in the basic format, or in the extended format
+// (such as "--04-15", "1985-04-12T10:22" or "T10:22:00Z") used by jCard.
+func (d Date) format(extended bool) string {
+	sep := ""
+	if extended {
+		sep = "-"
+	}
+	sb := new(strings.Builder)
+	switch {
+	case d.hasYear() && d.hasMonth() && d.hasDay():
+		fmt.Fprintf(sb, "%04d%s%02d%s%02d", d.Year, sep, d.Month, sep, d.Day)
+	case d.hasYear() && d.hasMonth():
+		fmt.Fprintf(sb, "%04d-%02d", d.Year, d.Month)
+	case d.hasYear():
+		fmt.Fprintf(sb, "%04d", d.Year)
+	case d.hasMonth():
+		fmt.Fprintf(sb, "--%02d", d.Month)
+		if d.hasDay() {
+			fmt.Fprintf(sb, "%s%02d", sep, d.Day)
+		}
+	case d.hasDay():
+		fmt.Fprintf(sb, "---%02d", d.Day)
+	}
+	if !d.HasTime() {
+		return sb.String()
+	}
+
+	if extended {
+		sep = ":"
+	}
+	sb.WriteByte('T')
+	switch {
+	case d.hasHour():
+		fmt.Fprintf(sb, "%02d", d.Hour)
+		if d.hasMinute() {
+			fmt.Fprintf(sb, "%s%02d", sep, d.Minute)
+			if d.hasSecond() {
+				fmt.Fprintf(sb, "%s%02d", sep, d.Second)
+			}
+		}
+	case d.hasMinute():
+		fmt.Fprintf(sb, "-%02d", d.Minute)
+		if d.hasSecond() {
+			fmt.Fprintf(sb, "%s%02d", sep, d.Second)
+		}
+	default:
+		fmt.Fprintf(sb, "--%02d", d.Second)
+	}
+	if d.HasOffset {
+		if d.Offset == 0 {
+			sb.WriteByte('Z')
+		} else {
+			sb.WriteString(formatUTCOffset(int(d.Offset/time.Second), extended))
+		}
+	}
+	return sb.String()
+}
+
+// PartialDate returns the value of the property as a Date, in any of the
+// forms accepted by ParseDate. If the VALUE parameter is "time", the value may
+// also be a time which is not preceded by "T". This is intended for use with
+// properties such as BDAY, ANNIVERSARY and DEATHDATE; if the VALUE parameter
+// of such a property is "text" (as in "BDAY;VALUE=text:circa 1800"), the
+// error is a ValueError. On error, the Date is the zero Date, which has no
+// fields present.
+func (p *Property) PartialDate() (Date, error) {
+	value := p.text()
+	s := value
+	if values := p.Param("VALUE"); len(values) > 0 {
+		switch strings.ToLower(values[0]) {
+		case "text":
+			return Date{}, ValueError{"date-and-or-time", value}
+		case "time":
+			if !strings.HasPrefix(s, "T") {
+				s = "T" + s
+			}
+		}
+	}
+	d, err := ParseDate(s)
+	if err != nil {
+		return Date{}, ValueError{"date-and-or-time", value}
+	}
+	return d, nil
+}
+
+// SetPartialDate sets the value of the property to the given Date. A VALUE
+// parameter of "text" is removed, since the value is no longer text.
+func (p *Property) SetPartialDate(d Date) {
+	if values := p.Param("VALUE"); len(values) > 0 && strings.EqualFold(values[0], "text") {
+		p.removeParam("VALUE")
+	}
+	p.SetValues(d.String())
+}
+
+// daysIn returns the number of days in the month of d, allowing February 29
+// if the year is absent. If the month is absent, any day up to 31 is allowed.
+func daysIn(d Date) int {
+	switch {
+	case !d.hasMonth():
+		return 31
+	case !d.hasYear():
+		// Use a leap year, so that every day of the month is allowed.
+		return time.Date(2000, time.Month(d.Month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	}
+	return time.Date(d.Year, time.Month(d.Month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// parseDate parses a date into d, returning the unparsed remainder of s.
+func parseDate(s string, d *Date) (string, bool) {
+	var ok bool
+	switch {
+	case strings.HasPrefix(s, "---"):
+		d.Day, s, ok = parseDigits(s[3:], 2, 1, 31)
+		return s, ok
+	case strings.HasPrefix(s, "--"):
+		if d.Month, s, ok = parseDigits(s[2:], 2, 1, 12); !ok || s == "" {
+			return s, ok
+		}
+		// The extended format may separate the month and day.
+		s = strings.TrimPrefix(s, "-")
+		d.Day, s, ok = parseDigits(s, 2, 1, 31)
+		return s, ok
+	}
+	if d.Year, s, ok = parseDigits(s, 4, 0, 9999); !ok {
+		return s, false
+	}
+	d.HasYear = true
+	if s == "" {
+		return s, true
+	}
+	if s[0] == '-' {
+		// Either the extended format or a year and month.
+		if d.Month, s, ok = parseDigits(s[1:], 2, 1, 12); !ok || s == "" {
+			return s, ok
+		}
+		if s[0] != '-' {
+			return s, false
+		}
+		d.Day, s, ok = parseDigits(s[1:], 2, 1, 31)
+		return s, ok
+	}
+	if d.Month, s, ok = parseDigits(s, 2, 1, 12); !ok {
+		return s, false
+	}
+	d.Day, s, ok = parseDigits(s, 2, 1, 31)
+	return s, ok
+}
+
+// parseTime parses a time (including any UTC offset) into d, returning the
+// unparsed remainder of s.
+func parseTime(s string, d *Date) (string, bool) {
+	var ok bool
+	switch {
+	case strings.HasPrefix(s, "--"):
+		if d.Second, s, ok = parseDigits(s[2:], 2, 0, 60); !ok {
+			return s, false
+		}
+		d.HasSecond = true
+	case strings.HasPrefix(s, "-"):
+		if d.Minute, s, ok = parseDigits(s[1:], 2, 0, 59); !ok {
+			return s, false
+		}
+		d.HasMinute = true
+		if len(s) > 2 && s[0] == ':' {
+			s = s[1:]
+		}
+		if len(s) > 0 && isDigit(s[0]) {
+			if d.Second, s, ok = parseDigits(s, 2, 0, 60); !ok {
+				return s, false
+			}
+			d.HasSecond = true
+		}
+	default:
+		if d.Hour, s, ok = parseDigits(s, 2, 0, 23); !ok {
+			return s, false
+		}
+		d.HasHour = true
+		// The minute and second may be separated by colons in the
+		// extended format.
+		if len(s) > 2 && s[0] == ':' {
+			s = s[1:]
+		}
+		if len(s) > 0 && isDigit(s[0]) {
+			if d.Minute, s, ok = parseDigits(s, 2, 0, 59); !ok {
+				return s, false
+			}
+			d.HasMinute = true
+			if len(s) > 2 && s[0] == ':' {
+				s = s[1:]
+			}
+			if len(s) > 0 && isDigit(s[0]) {
+				if d.Second, s, ok = parseDigits(s, 2, 0, 60); !ok {
+					return s, false
+				}
+				d.HasSecond = true
+			}
+		}
+	}
+	if s == "" {
+		return s, true
+	}
+	offset, ok := parseUTCOffset(s)
+	d.HasOffset, d.Offset = ok, time.Duration(offset)*time.Second
+	return "", ok
+}
@@ -0,0 +1,112 @@
+package vcard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		date Date
+		out  string
+	}{
+		{"19850412", Date{Year: 1985, Month: 4, Day: 12}, "19850412"},
+		{"1985-04-12", Date{Year: 1985, Month: 4, Day: 12}, "19850412"},
+		{"1985-04", Date{Year: 1985, Month: 4}, "1985-04"},
+		{"1985", Date{Year: 1985}, "1985"},
+		{"0000", Date{HasYear: true}, "0000"},
+		{"--0415", Date{Month: 4, Day: 15}, "--0415"},
+		{"--04-15", Date{Month: 4, Day: 15}, "--0415"},
+		{"--04", Date{Month: 4}, "--04"},
+		{"--0229", Date{Month: 2, Day: 29}, "--0229"},
+		{"20000229", Date{Year: 2000, Month: 2, Day: 29}, "20000229"},
+		{"---15", Date{Day: 15}, "---15"},
+		{"19850412T", Date{Year: 1985, Month: 4, Day: 12}, "19850412"},
+		{"T102200", Date{Hour: 10, Minute: 22, HasSecond: true}, "T102200"},
+		{"T1022", Date{Hour: 10, Minute: 22}, "T1022"},
+		{"T10", Date{Hour: 10}, "T10"},
+		{"T-2200", Date{Minute: 22, HasSecond: true}, "T-2200"},
+		{"T-22", Date{Minute: 22}, "T-22"},
+		{"T--00", Date{HasSecond: true}, "T--00"},
+		{"T102200Z", Date{Hour: 10, Minute: 22, HasSecond: true, HasOffset: true}, "T102200Z"},
+		{"T102200-0800", Date{Hour: 10, Minute: 22, HasSecond: true, HasOffset: true, Offset: -8 * time.Hour}, "T102200-0800"},
+		{"19961022T140000", Date{Year: 1996, Month: 10, Day: 22, Hour: 14, HasMinute: true, HasSecond: true}, "19961022T140000"},
+		{"--1022T1400", Date{Month: 10, Day: 22, Hour: 14, HasMinute: true}, "--1022T1400"},
+		{"---22T14", Date{Day: 22, Hour: 14}, "---22T14"},
+		{"T00", Date{HasHour: true}, "T00"},
+		{"1996-10-22T14:00:00+05:30", Date{Year: 1996, Month: 10, Day: 22, Hour: 14, HasMinute: true, HasSecond: true, HasOffset: true, Offset: 5*time.Hour + 30*time.Minute}, "19961022T140000+0530"},
+	}
+
+	for _, test := range tests {
+		date, err := ParseDate(test.in)
+		if err != nil {
+			t.Errorf("ParseDate(%q): unexpected error: %v", test.in, err)
+			continue
+		}
+		if date != test.date {
+			t.Errorf("ParseDate(%q) = %#v, want %#v", test.in, date, test.date)
+		}
+		if out := date.String(); out != test.out {
+			t.Errorf("ParseDate(%q).String() = %q, want %q", test.in, out, test.out)
+		}
+	}
+}
+
+func TestParseDateFailure(t *testing.T) {
+	for _, in := range []string{"", "T", "85", "198504", "1985-4", "1985-13", "--1301", "----01", "T25", "T1060", "T10Z0", "19961022T140000+05:3", "1985x", "20230231", "2023-02-29", "19000229", "--0431", "--0230", "2023-04-31"} {
+		if _, err := ParseDate(in); err == nil {
+			t.Errorf("ParseDate(%q): expected error", in)
+		}
+	}
+}
+
+func TestDateZero(t *testing.T) {
+	var d Date
+	if d.HasDate() || d.HasTime() || d.String() != "" {
+		t.Errorf("zero Date: HasDate() = %v, HasTime() = %v, String() = %q", d.HasDate(), d.HasTime(), d.String())
+	}
+	if s := (Date{Month: 4, Day: 15}).String(); s != "--0415" {
+		t.Errorf("Date{Month: 4, Day: 15}.String() = %q, want %q", s, "--0415")
+	}
+	if s := (Date{Year: 1985, Month: 4, Day: 12, Hour: 10, HasMinute: true}).String(); s != "19850412T1000" {
+		t.Errorf("got %q, want %q", s, "19850412T1000")
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	date, _ := ParseDate("--0415T10-0500")
+	want := time.Date(0, 4, 15, 10, 0, 0, 0, time.FixedZone("", -5*3600))
+	if tm := date.Time(); !tm.Equal(want) {
+		t.Errorf("Time() = %v, want %v", tm, want)
+	}
+	if !date.HasDate() || !date.HasTime() {
+		t.Errorf("HasDate() = %v, HasTime() = %v, want true, true", date.HasDate(), date.HasTime())
+	}
+}
+
+func TestPartialDate(t *testing.T) {
+	var prop Property
+	prop.SetValues("--0415")
+	if d, err := prop.PartialDate(); err != nil || d.Year != 0 || d.Month != 4 || d.Day != 15 {
+		t.Errorf("PartialDate() = %#v, %v", d, err)
+	}
+
+	prop.SetParam("VALUE", "time")
+	prop.SetValues("1022")
+	if d, err := prop.PartialDate(); err != nil || d.Hour != 10 || d.Minute != 22 || d.HasDate() {
+		t.Errorf("PartialDate() with VALUE=time = %#v, %v", d, err)
+	}
+
+	prop.SetParam("VALUE", "text")
+	prop.SetValues("circa 1800")
+	if _, err := prop.PartialDate(); err != (ValueError{"date-and-or-time", "circa 1800"}) {
+		t.Errorf("PartialDate() with VALUE=text: got error %v, want ValueError", err)
+	}
+
+	d, _ := ParseDate("1985")
+	prop.SetPartialDate(d)
+	if prop.text() != "1985" || len(prop.Param("VALUE")) != 0 {
+		t.Errorf("SetPartialDate: got %q with VALUE %q", prop.text(), prop.Param("VALUE"))
+	}
+}
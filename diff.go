@@ -0,0 +1,236 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrPatchConflict is the error returned by Patch.Apply when a property which
+// is removed or modified by the patch is not present in the card.
+var ErrPatchConflict = errors.New("vcard: patch does not apply to card")
+
+// Equal returns whether the card has the same properties as another card.
+// Property names and parameter names are compared case-insensitively, as are
+// groups, but the values of parameters and properties are compared exactly.
+// The order of the properties does not matter, consistent with Diff, which
+// does not report properties as changed if they have only moved.
+func (c *Card) Equal(other *Card) bool {
+	if len(c.m) != len(other.m) {
+		return false
+	}
+	for name, props := range c.m {
+		others := other.m[name]
+		if len(props) != len(others) {
+			return false
+		}
+		for _, j := range matchProperties(props, others, true) {
+			if j == -1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Equal returns whether the property has the same group, parameters and value
+// as another property. The group and parameter names are compared
+// case-insensitively, but the order of parameters does not matter.
+func (p *Property) Equal(other Property) bool {
+	if !strings.EqualFold(p.group, other.group) || len(p.params) != len(other.params) {
+		return false
+	}
+	for key, values := range p.params {
+		if !equalStrings(values, other.Param(key)) {
+			return false
+		}
+	}
+	if len(p.components) != len(other.components) {
+		return false
+	}
+	for i := range p.components {
+		if !equalStrings(p.components[i], other.components[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalStrings returns whether two slices contain the same strings in the same
+// order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Change is a change to a single property of a card.
+type Change struct {
+	Name string   // the name of the property
+	Old  Property // the property before the change (unless it was added)
+	New  Property // the property after the change (unless it was removed)
+}
+
+// Patch is a set of changes that can be applied to a card, as returned by
+// Diff.
+type Patch struct {
+	Added    []Change
+	Removed  []Change
+	Modified []Change
+}
+
+// Empty returns whether the patch has no changes.
+func (p *Patch) Empty() bool {
+	return len(p.Added) == 0 && len(p.Removed) == 0 && len(p.Modified) == 0
+}
+
+// Diff returns the changes needed to turn card a into card b. Occurrences of
+// each property in a are matched with occurrences in b (so they can be
+// reported as modified rather than removed and added) using the first of the
+// following rules which applies: the occurrences have the same PID parameter,
+// they are equal, they have the same (non-empty) group, or they have the same
+// position among the remaining unmatched occurrences.
+//
+// The changes in each list of the patch are sorted by property name, and then
+// by position in the card.
+func Diff(a, b *Card) *Patch {
+	names := make(map[string]bool)
+	for name := range a.m {
+		names[name] = true
+	}
+	for name := range b.m {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	patch := new(Patch)
+	for _, name := range sorted {
+		olds, news := a.m[name], b.m[name]
+		match := matchProperties(olds, news, false)
+		for i, j := range match {
+			if j == -1 {
+				patch.Removed = append(patch.Removed, Change{Name: name, Old: olds[i]})
+			} else if !olds[i].Equal(news[j]) {
+				patch.Modified = append(patch.Modified, Change{Name: name, Old: olds[i], New: news[j]})
+			}
+		}
+		matched := make([]bool, len(news))
+		for _, j := range match {
+			if j != -1 {
+				matched[j] = true
+			}
+		}
+		for j, prop := range news {
+			if !matched[j] {
+				patch.Added = append(patch.Added, Change{Name: name, New: prop})
+			}
+		}
+	}
+	return patch
+}
+
+// matchProperties matches occurrences of a property in an old and a new card,
+// as described in Diff (or, if exact is true, only matching equal occurrences).
+// The result gives the index of the matching new occurrence for each old
+// occurrence, or -1 if there is none.
+func matchProperties(olds, news []Property, exact bool) []int {
+	match := make([]int, len(olds))
+	for i := range match {
+		match[i] = -1
+	}
+	matched := make([]bool, len(news))
+	pass := func(same func(from, to Property) bool) {
+		for i, from := range olds {
+			if match[i] != -1 {
+				continue
+			}
+			for j, to := range news {
+				if !matched[j] && same(from, to) {
+					match[i] = j
+					matched[j] = true
+					break
+				}
+			}
+		}
+	}
+
+	if exact {
+		pass(func(from, to Property) bool {
+			return from.Equal(to)
+		})
+		return match
+	}
+	pass(func(from, to Property) bool {
+		pid := from.Param("PID")
+		return len(pid) > 0 && equalStrings(pid, to.Param("PID"))
+	})
+	pass(func(from, to Property) bool {
+		return from.Equal(to)
+	})
+	pass(func(from, to Property) bool {
+		return from.group != "" && strings.EqualFold(from.group, to.group)
+	})
+	pass(func(from, to Property) bool {
+		return true
+	})
+	return match
+}
+
+// Apply applies the changes in the patch to a card. Each property which is
+// removed or modified must be present in the card (exactly as it was in the
+// card the patch was made from), or else the result is an error wrapping
+// ErrPatchConflict and the card is left unchanged. Modified properties keep
+// their positions, while added properties are added at the end of the card.
+func (p *Patch) Apply(c *Card) error {
+	// The changes are made to a copy, so that the card is unchanged if
+	// any of them fail.
+	card := c.clone()
+	for _, change := range p.Modified {
+		i := card.index(change.Name, change.Old)
+		if i == -1 {
+			return fmt.Errorf("%w: cannot find %v property to modify", ErrPatchConflict, change.Name)
+		}
+		card.SetAt(change.Name, i, change.New)
+	}
+	for _, change := range p.Removed {
+		i := card.index(change.Name, change.Old)
+		if i == -1 {
+			return fmt.Errorf("%w: cannot find %v property to remove", ErrPatchConflict, change.Name)
+		}
+		card.RemoveAt(change.Name, i)
+	}
+	for _, change := range p.Added {
+		card.Add(change.Name, change.New)
+	}
+	*c = *card
+	return nil
+}
+
+// index returns the index of the first occurrence of the given property which
+// is equal to prop, or -1 if there is none.
+func (c *Card) index(name string, prop Property) int {
+	for i, p := range c.Get(name) {
+		if p.Equal(prop) {
+			return i
+		}
+	}
+	return -1
+}
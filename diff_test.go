@@ -0,0 +1,102 @@
+package vcard
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func parseCard(t *testing.T, s string) *Card {
+	t.Helper()
+	cards, err := ParseAll(strings.NewReader(s))
+	if err != nil || len(cards) != 1 {
+		t.Fatalf("parsing %q: got %v cards, error %v", s, len(cards), err)
+	}
+	return cards[0]
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{sampleVCard, sampleVCard, true},
+		{"BEGIN:VCARD\nFN:a\nN:b;c\nEND:VCARD", "begin:vcard\nn:b;c\nfn:a\nend:vcard", true},
+		{"BEGIN:VCARD\nitem1.EMAIL;TYPE=work;PREF=1:a\nEND:VCARD", "BEGIN:VCARD\nITEM1.EMAIL;pref=1;type=work:a\nEND:VCARD", true},
+		{"BEGIN:VCARD\nEMAIL;TYPE=work:a\nEND:VCARD", "BEGIN:VCARD\nEMAIL;TYPE=WORK:a\nEND:VCARD", false},
+		{"BEGIN:VCARD\nEMAIL:a\nEMAIL:b\nEND:VCARD", "BEGIN:VCARD\nEMAIL:b\nEMAIL:a\nEND:VCARD", true},
+		{"BEGIN:VCARD\nEMAIL:a\nEMAIL:a\nEND:VCARD", "BEGIN:VCARD\nEMAIL:a\nEMAIL:b\nEND:VCARD", false},
+		{"BEGIN:VCARD\nFN:a\nEND:VCARD", "BEGIN:VCARD\nFN:A\nEND:VCARD", false},
+		{"BEGIN:VCARD\nFN:a\nEND:VCARD", "BEGIN:VCARD\nFN:a\nNOTE:b\nEND:VCARD", false},
+		{"BEGIN:VCARD\nN:a;b\nEND:VCARD", "BEGIN:VCARD\nN:a,b\nEND:VCARD", false},
+	}
+
+	for _, test := range tests {
+		a, b := parseCard(t, test.a), parseCard(t, test.b)
+		if equal := a.Equal(b); equal != test.equal {
+			t.Errorf("Equal(%q, %q) = %v, want %v", test.a, test.b, equal, test.equal)
+		}
+		if equal := b.Equal(a); equal != test.equal {
+			t.Errorf("Equal(%q, %q) = %v, want %v", test.b, test.a, equal, test.equal)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nEMAIL;PID=1.1:john@example.com\nEMAIL;PID=2.1:jd@example.com\nTEL:+1-555-0100\nitem1.URL:http://example.com\nNOTE:old\nEND:VCARD")
+	b := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:John Q. Doe\nEMAIL;PID=2.1:jd@example.org\nEMAIL;PID=1.1:john@example.com\nTEL:+1-555-0199\nTEL:+1-555-0100\nitem1.URL:https://example.com\nEND:VCARD")
+
+	patch := Diff(a, b)
+	summarize := func(changes []Change) string {
+		var s []string
+		for _, change := range changes {
+			s = append(s, change.Name+":"+change.Old.joined()+">"+change.New.joined())
+		}
+		return strings.Join(s, " ")
+	}
+	if s := summarize(patch.Added); s != "TEL:>+1-555-0199" {
+		t.Errorf("got added %q", s)
+	}
+	if s := summarize(patch.Removed); s != "NOTE:old>" {
+		t.Errorf("got removed %q", s)
+	}
+	if s := summarize(patch.Modified); s != "EMAIL:jd@example.com>jd@example.org FN:John Doe>John Q. Doe URL:http://example.com>https://example.com" {
+		t.Errorf("got modified %q", s)
+	}
+
+	if err := patch.Apply(a); err != nil {
+		t.Fatalf("unexpected error applying patch: %v", err)
+	}
+	if !a.Equal(b) {
+		t.Errorf("after applying patch, got %q, want %q", a.UnfoldedString(), b.UnfoldedString())
+	}
+	if patch := Diff(a, b); !patch.Empty() {
+		t.Errorf("got non-empty diff between equal cards: %+v", patch)
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	a := parseCard(t, "BEGIN:VCARD\nFN:a\nNOTE:x\nEND:VCARD")
+	b := parseCard(t, "BEGIN:VCARD\nFN:b\nEND:VCARD")
+	patch := Diff(a, b)
+
+	c := parseCard(t, "BEGIN:VCARD\nFN:a\nNOTE:y\nEND:VCARD")
+	want := c.UnfoldedString()
+	if err := patch.Apply(c); !errors.Is(err, ErrPatchConflict) {
+		t.Errorf("got error %v, want ErrPatchConflict", err)
+	}
+	if got := c.UnfoldedString(); got != want {
+		t.Errorf("card modified by failed patch: got %q, want %q", got, want)
+	}
+}
+
+func TestApplyKeepsOrder(t *testing.T) {
+	a := parseCard(t, "BEGIN:VCARD\nFN:a\nEMAIL:1\nNOTE:x\nEMAIL:2\nEMAIL:3\nEND:VCARD")
+	b := parseCard(t, "BEGIN:VCARD\nFN:a\nEMAIL:1\nNOTE:y\nEMAIL:3\nEND:VCARD")
+	if err := Diff(a, b).Apply(a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := a.UnfoldedString(), b.UnfoldedString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// Encoder writes cards in vCard syntax to an underlying writer. Each line is
+// folded as it is written, so an arbitrary number of cards may be encoded
+// without ever holding more than a single line in memory.
+//
+// Each call to Encode results in one call to Write on the underlying writer
+// per line of the card (before folding), so for efficiency it is a good idea
+// to wrap unbuffered writers in a bufio.Writer.
+type Encoder struct {
+	w          io.Writer
+	width      int
+	lineEnding string
+	fold       bool
+	line       bytes.Buffer // the current line, before folding
+	out        bytes.Buffer // the current line, after folding
+}
+
+// NewEncoder returns a new encoder that writes to the given writer. By
+// default, the encoder folds lines so that they are at most 75 bytes long
+// (not including the line ending) and ends each line with "\r\n", as
+// recommended by the vCard specification.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:          w,
+		width:      75,
+		lineEnding: "\r\n",
+		fold:       true,
+	}
+}
+
+// SetWidth sets the maximum number of bytes in each line of output, not
+// including the line ending. Lines are never broken in the middle of a UTF-8
+// codepoint, so the width should be at least 5 to ensure that it can always be
+// respected; a line is only allowed to exceed the width if it contains a
+// single codepoint (after the leading space of a continuation line). Widths
+// less than 2 are treated as 2. This has no effect if folding is disabled.
+func (e *Encoder) SetWidth(width int) {
+	if width < 2 {
+		width = 2
+	}
+	e.width = width
+}
+
+// SetLineEnding sets the sequence that is written at the end of each line,
+// including those introduced by folding. The vCard specification requires
+// this to be "\r\n", but it may be useful to use "\n" for human-readable
+// output.
+func (e *Encoder) SetLineEnding(ending string) {
+	e.lineEnding = ending
+}
+
+// SetFold sets whether long lines should be folded.
+func (e *Encoder) SetFold(fold bool) {
+	e.fold = fold
+}
+
+// Encode writes a single card to the underlying writer. The properties are
+// written in the order they were added to the card, except that the VERSION
+// property (if present) will always be first. If an error is returned, the
+// card may have been partially written.
+func (e *Encoder) Encode(card *Card) error {
+	if err := e.writeLine("BEGIN:VCARD"); err != nil {
+		return err
+	}
+	err := card.walk(func(name string, prop Property) error {
+		writeProperty(&e.line, name, prop)
+		return e.flushLine()
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeLine("END:VCARD")
+}
+
+// writeLine writes a complete line to the underlying writer.
+func (e *Encoder) writeLine(line string) error {
+	e.line.WriteString(line)
+	return e.flushLine()
+}
+
+// flushLine folds the current line and writes it to the underlying writer,
+// followed by the line ending.
+func (e *Encoder) flushLine() error {
+	defer e.line.Reset()
+	defer e.out.Reset()
+
+	if !e.fold {
+		e.line.WriteString(e.lineEnding)
+		_, err := e.w.Write(e.line.Bytes())
+		return err
+	}
+
+	line := e.line.Bytes()
+	n := 0     // the length of the current output line
+	start := 0 // the length of the current output line before its content
+	for len(line) > 0 {
+		_, size := utf8.DecodeRune(line)
+		// Folding before the first codepoint of a line would only
+		// produce an empty line.
+		if n+size > e.width && n > start {
+			e.out.WriteString(e.lineEnding)
+			e.out.WriteByte(' ')
+			n, start = 1, 1
+		}
+		e.out.Write(line[:size])
+		n += size
+		line = line[size:]
+	}
+	e.out.WriteString(e.lineEnding)
+	_, err := e.w.Write(e.out.Bytes())
+	return err
+}
@@ -0,0 +1,105 @@
+package vcard
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func BenchmarkEncode(b *testing.B) {
+	e := NewEncoder(io.Discard)
+	for i := 0; i < b.N; i++ {
+		e.Encode(sampleVCardParsed)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	card := new(Card)
+	card.Add("VERSION", Property{components: [][]string{{"4.0"}}})
+	card.Add("NOTE", Property{components: [][]string{{"こんにちは世界, hello world"}}})
+
+	tests := []struct {
+		width      int
+		lineEnding string
+		fold       bool
+		out        string
+	}{
+		{75, "\r\n", true, "BEGIN:VCARD\r\nVERSION:4.0\r\nNOTE:こんにちは世界\\, hello world\r\nEND:VCARD\r\n"},
+		{8, "\r\n", true, "BEGIN:VC\r\n ARD\r\nVERSION:\r\n 4.0\r\nNOTE:こ\r\n んに\r\n ちは\r\n 世界\\\r\n , hello\r\n  world\r\nEND:VCAR\r\n D\r\n"},
+		{8, "\n", true, "BEGIN:VC\n ARD\nVERSION:\n 4.0\nNOTE:こ\n んに\n ちは\n 世界\\\n , hello\n  world\nEND:VCAR\n D\n"},
+		{8, "\n", false, "BEGIN:VCARD\nVERSION:4.0\nNOTE:こんにちは世界\\, hello world\nEND:VCARD\n"},
+	}
+
+	sb := new(strings.Builder)
+	for _, test := range tests {
+		sb.Reset()
+		e := NewEncoder(sb)
+		e.SetWidth(test.width)
+		e.SetLineEnding(test.lineEnding)
+		e.SetFold(test.fold)
+		if err := e.Encode(card); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else if sb.String() != test.out {
+			t.Errorf("Encode with width %v, line ending %q and fold %v = %q, want %q", test.width, test.lineEnding, test.fold, sb.String(), test.out)
+		}
+	}
+}
+
+func TestEncodeNarrow(t *testing.T) {
+	card := new(Card)
+	card.Add("VERSION", Property{components: [][]string{{"4.0"}}})
+	card.Add("NOTE", Property{components: [][]string{{"こんにちは, hello"}}})
+	want := strings.Replace(card.UnfoldedString(), "\n", "\r\n", -1)
+
+	for _, width := range []int{-1, 0, 1, 2, 3, 4} {
+		sb := new(strings.Builder)
+		e := NewEncoder(sb)
+		e.SetWidth(width)
+		if err := e.Encode(card); err != nil {
+			t.Fatalf("width %v: unexpected error: %v", width, err)
+		}
+		out := sb.String()
+		limit := width
+		if limit < 2 {
+			limit = 2
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+			if content := strings.TrimPrefix(line, " "); content == "" || len(line) > limit && utf8.RuneCountInString(content) > 1 {
+				t.Errorf("width %v: got line %q in %q", width, line, out)
+			}
+		}
+		if unfolded := strings.Replace(out, "\r\n ", "", -1); unfolded != want {
+			t.Errorf("width %v: got %q, which unfolds to %q, want %q", width, out, unfolded, want)
+		}
+	}
+}
+
+func TestEncodeMatchesFold(t *testing.T) {
+	sb := new(strings.Builder)
+	e := NewEncoder(sb)
+	for i := 0; i < 2; i++ {
+		if err := e.Encode(sampleVCardParsed); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	folded := Fold(strings.Repeat(sampleVCardParsed.UnfoldedString(), 2), 77)
+	if sb.String() != folded {
+		t.Fatalf("got %q, want %q", sb.String(), folded)
+	}
+}
+
+type errWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestEncodeError(t *testing.T) {
+	if err := NewEncoder(errWriter{}).Encode(sampleVCardParsed); err != errWrite {
+		t.Fatalf("got error %v, want %v", err, errWrite)
+	}
+}
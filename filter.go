@@ -0,0 +1,431 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Filter is a condition on the properties of a card, modelled on the filter
+// of a CardDAV addressbook-query report (RFC 6352, section 10.5).
+type Filter struct {
+	// AllOf is whether all the property filters must match, rather than
+	// any of them.
+	AllOf bool
+	// Props are the property filters. A filter without any matches every
+	// card.
+	Props []PropFilter
+}
+
+// PropFilter is a condition on the occurrences of a property.
+//
+// If IsNotDefined is set, the filter matches if the card has no occurrences
+// of the property. Otherwise, it matches if the card has an occurrence which
+// matches the text matches and parameter filters (all of them, if AllOf is
+// set, or otherwise any of them). A filter without any text matches or
+// parameter filters matches if the property is defined.
+type PropFilter struct {
+	Name         string
+	AllOf        bool
+	IsNotDefined bool
+	Texts        []TextMatch   // conditions on the value of the property
+	Params       []ParamFilter // conditions on the parameters of the property
+}
+
+// ParamFilter is a condition on a parameter of a property.
+//
+// If IsNotDefined is set, the filter matches if the property does not have
+// the parameter. Otherwise, it matches if the property has the parameter and,
+// if Text is not nil, one of its values matches Text. Values containing
+// commas are also split into separate values, so that (for example) the
+// value "work" matches TYPE="work,voice".
+type ParamFilter struct {
+	Name         string
+	IsNotDefined bool
+	Text         *TextMatch
+}
+
+// MatchType is the way in which a TextMatch compares text.
+type MatchType int
+
+const (
+	// MatchContains matches values containing the text.
+	MatchContains MatchType = iota
+	// MatchEquals matches values equal to the text.
+	MatchEquals
+	// MatchStartsWith matches values starting with the text.
+	MatchStartsWith
+	// MatchEndsWith matches values ending with the text.
+	MatchEndsWith
+)
+
+// Collation is a way of comparing text (RFC 4790).
+type Collation string
+
+const (
+	// CollationUnicodeCasemap compares text case-insensitively, according
+	// to Unicode case folding. It is the default collation. This is an
+	// approximation of the collation defined by RFC 5051: only simple case
+	// folding is used, so a character never folds to several (for
+	// example, "ß" does not match "ss"), and text is not normalized, so
+	// precomposed and decomposed characters do not match.
+	CollationUnicodeCasemap Collation = "i;unicode-casemap"
+	// CollationASCIICasemap compares text case-insensitively, but only
+	// folds the case of ASCII letters.
+	CollationASCIICasemap Collation = "i;ascii-casemap"
+	// CollationOctet compares text exactly.
+	CollationOctet Collation = "i;octet"
+)
+
+// TextMatch is a condition on a value of a property or parameter.
+type TextMatch struct {
+	Text      string
+	Collation Collation // the collation, or "" for CollationUnicodeCasemap
+	MatchType MatchType
+	Negate    bool // whether the condition holds if the value does not match
+}
+
+// Match returns whether a card matches the filter.
+func (f *Filter) Match(card *Card) bool {
+	if len(f.Props) == 0 {
+		return true
+	}
+	return test(f.AllOf, len(f.Props), func(i int) bool { return f.Props[i].Match(card) })
+}
+
+// Select returns the cards which match the filter.
+func (f *Filter) Select(cards []*Card) []*Card {
+	var selected []*Card
+	for _, card := range cards {
+		if f.Match(card) {
+			selected = append(selected, card)
+		}
+	}
+	return selected
+}
+
+// Match returns whether a card matches the property filter.
+func (f *PropFilter) Match(card *Card) bool {
+	props := card.Get(f.Name)
+	if f.IsNotDefined {
+		return len(props) == 0
+	}
+	n := len(f.Texts) + len(f.Params)
+	for _, prop := range props {
+		if n == 0 || test(f.AllOf, n, func(i int) bool {
+			if i < len(f.Texts) {
+				return f.Texts[i].Match(prop.joined())
+			}
+			return f.Params[i-len(f.Texts)].Match(prop)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns whether a property matches the parameter filter.
+func (f *ParamFilter) Match(prop Property) bool {
+	values := prop.Param(f.Name)
+	if f.IsNotDefined {
+		return len(values) == 0
+	}
+	if len(values) == 0 {
+		return false
+	}
+	if f.Text == nil {
+		return true
+	}
+	// A negated condition holds only if none of the values match, so the
+	// negation is applied after checking every value.
+	matched := false
+	for _, value := range values {
+		if f.Text.matches(value) {
+			matched = true
+			break
+		}
+		if strings.Contains(value, ",") {
+			for _, v := range strings.Split(value, ",") {
+				if f.Text.matches(v) {
+					matched = true
+					break
+				}
+			}
+		}
+	}
+	return matched != f.Text.Negate
+}
+
+// Match returns whether a value matches the text match. An unknown collation
+// is treated as CollationOctet.
+func (m *TextMatch) Match(value string) bool {
+	return m.matches(value) != m.Negate
+}
+
+// matches returns whether a value matches the text match, ignoring Negate.
+func (m *TextMatch) matches(value string) bool {
+	text := m.Text
+	switch m.Collation {
+	case "", CollationUnicodeCasemap:
+		value, text = unicodeCasemap(value), unicodeCasemap(text)
+	case CollationASCIICasemap:
+		value, text = asciiCasemap(value), asciiCasemap(text)
+	}
+	var matched bool
+	switch m.MatchType {
+	case MatchEquals:
+		matched = value == text
+	case MatchStartsWith:
+		matched = strings.HasPrefix(value, text)
+	case MatchEndsWith:
+		matched = strings.HasSuffix(value, text)
+	default:
+		matched = strings.Contains(value, text)
+	}
+	return matched
+}
+
+// unicodeCasemap folds the case of a string, so that strings differing only
+// in case become equal. It uses simple case folding and does not normalize s.
+func unicodeCasemap(s string) string {
+	return strings.Map(func(r rune) rune {
+		// The smallest rune in the orbit of r under simple case folding
+		// identifies all the runes which fold together.
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, s)
+}
+
+// asciiCasemap folds the case of the ASCII letters of a string.
+func asciiCasemap(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// test returns whether all (if allOf is set) or any of the n conditions
+// hold.
+func test(allOf bool, n int, cond func(i int) bool) bool {
+	for i := 0; i < n; i++ {
+		if cond(i) != allOf {
+			return !allOf
+		}
+	}
+	return allOf
+}
+
+// matchTypes maps the operators of the filter syntax to match types.
+var matchTypes = map[string]MatchType{
+	"contains":    MatchContains,
+	"equals":      MatchEquals,
+	"=":           MatchEquals,
+	"starts-with": MatchStartsWith,
+	"ends-with":   MatchEndsWith,
+}
+
+// ParseFilter parses a filter written as a sequence of conditions joined by
+// AND or OR (which cannot be mixed). Each condition is one of the following,
+// where NAME is the name of a property, PARAM is the name of a parameter, OP
+// is one of "contains", "equals" (or "="), "starts-with" and "ends-with",
+// and TEXT is a word or a double-quoted string (in which a backslash escapes
+// the next character):
+//
+//	NAME is defined
+//	NAME is not defined
+//	NAME [not] OP TEXT
+//	NAME param PARAM is [not] defined
+//	NAME param PARAM [not] OP TEXT [is defined]
+//
+// For example:
+//
+//	EMAIL contains @example.com AND TEL param TYPE=cell is defined
+//
+// Keywords are case-insensitive, and text is compared using
+// CollationUnicodeCasemap.
+func ParseFilter(s string) (*Filter, error) {
+	tokens, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f := new(Filter)
+	var join string
+	for {
+		pf, err := p.parsePropFilter()
+		if err != nil {
+			return nil, err
+		}
+		f.Props = append(f.Props, pf)
+		if p.done() {
+			return f, nil
+		}
+		conj := strings.ToUpper(p.next().text)
+		if conj != "AND" && conj != "OR" {
+			return nil, p.errorf("expected AND or OR, got %q", p.tokens[p.pos-1].text)
+		}
+		if join != "" && conj != join {
+			return nil, p.errorf("cannot mix AND and OR")
+		}
+		join = conj
+		f.AllOf = conj == "AND"
+	}
+}
+
+// filterToken is a token of the filter syntax.
+type filterToken struct {
+	text   string
+	quoted bool // whether the token was a quoted string, and so not a keyword
+}
+
+// tokenizeFilter splits a filter into tokens, which are separated by spaces
+// (except within quoted strings). The character "=" is always a token by
+// itself.
+func tokenizeFilter(s string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '=':
+			tokens = append(tokens, filterToken{"=", false})
+			i++
+		case c == '"':
+			var b strings.Builder
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("vcard: invalid filter: unterminated string")
+			}
+			tokens = append(tokens, filterToken{b.String(), true})
+			i++
+		default:
+			start := i
+			for i < len(s) && strings.IndexByte(" \t\n\r=\"", s[i]) == -1 {
+				i++
+			}
+			tokens = append(tokens, filterToken{s[start:i], false})
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser parses the tokens of a filter.
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos == len(p.tokens)
+}
+
+// next returns the next token, or an empty token at the end of the input.
+func (p *filterParser) next() filterToken {
+	if p.done() {
+		return filterToken{}
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// keyword consumes the next token if it is the given keyword.
+func (p *filterParser) keyword(kw string) bool {
+	if !p.done() && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("vcard: invalid filter: "+format, args...)
+}
+
+// parseName parses the name of a property or parameter.
+func (p *filterParser) parseName(what string) (string, error) {
+	t := p.next()
+	if t.text == "" || t.quoted || t.text == "=" {
+		return "", p.errorf("expected %v name, got %q", what, t.text)
+	}
+	return t.text, nil
+}
+
+// parseDefined parses the rest of "is [not] defined", after "is", returning
+// whether "not" was present.
+func (p *filterParser) parseDefined() (notDefined bool, err error) {
+	notDefined = p.keyword("not")
+	if !p.keyword("defined") {
+		return false, p.errorf(`expected "defined" after "is"`)
+	}
+	return notDefined, nil
+}
+
+// parseTextMatch parses "[not] OP TEXT".
+func (p *filterParser) parseTextMatch() (*TextMatch, error) {
+	m := &TextMatch{Negate: p.keyword("not")}
+	op := p.next()
+	matchType, ok := matchTypes[strings.ToLower(op.text)]
+	if !ok || op.quoted {
+		return nil, p.errorf("expected operator, got %q", op.text)
+	}
+	m.MatchType = matchType
+	if p.done() {
+		return nil, p.errorf("expected text after %q", op.text)
+	}
+	m.Text = p.next().text
+	return m, nil
+}
+
+// parsePropFilter parses a single condition.
+func (p *filterParser) parsePropFilter() (PropFilter, error) {
+	var pf PropFilter
+	var err error
+	if pf.Name, err = p.parseName("property"); err != nil {
+		return pf, err
+	}
+	switch {
+	case p.keyword("is"):
+		pf.IsNotDefined, err = p.parseDefined()
+	case p.keyword("param"):
+		pmf := ParamFilter{}
+		if pmf.Name, err = p.parseName("parameter"); err != nil {
+			return pf, err
+		}
+		if p.keyword("is") {
+			pmf.IsNotDefined, err = p.parseDefined()
+		} else if pmf.Text, err = p.parseTextMatch(); err == nil && p.keyword("is") {
+			// A trailing "is defined" is redundant, but reads naturally:
+			// "TEL param TYPE=cell is defined".
+			if notDefined, derr := p.parseDefined(); derr != nil || notDefined {
+				err = p.errorf(`expected "is defined" after parameter value`)
+			}
+		}
+		pf.Params = append(pf.Params, pmf)
+	default:
+		var m *TextMatch
+		if m, err = p.parseTextMatch(); err == nil {
+			pf.Texts = append(pf.Texts, *m)
+		}
+	}
+	return pf, err
+}
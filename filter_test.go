@@ -0,0 +1,131 @@
+package vcard
+
+import (
+	"testing"
+)
+
+func TestTextMatch(t *testing.T) {
+	tests := []struct {
+		m     TextMatch
+		value string
+		want  bool
+	}{
+		{TextMatch{Text: "doe"}, "John Doe", true},
+		{TextMatch{Text: "doe", Collation: CollationOctet}, "John Doe", false},
+		{TextMatch{Text: "doe", Collation: CollationASCIICasemap}, "John Doe", true},
+		{TextMatch{Text: "ÉMILE", Collation: CollationASCIICasemap}, "émile", false},
+		{TextMatch{Text: "ÉMILE"}, "émile", true},
+		{TextMatch{Text: "john doe", MatchType: MatchEquals}, "John Doe", true},
+		{TextMatch{Text: "john", MatchType: MatchEquals}, "John Doe", false},
+		{TextMatch{Text: "john", MatchType: MatchStartsWith}, "John Doe", true},
+		{TextMatch{Text: "john", MatchType: MatchEndsWith}, "John Doe", false},
+		{TextMatch{Text: "DOE", MatchType: MatchEndsWith}, "John Doe", true},
+		{TextMatch{Text: "jane", Negate: true}, "John Doe", true},
+		{TextMatch{Text: "john", Negate: true}, "John Doe", false},
+	}
+	for _, test := range tests {
+		if got := test.m.Match(test.value); got != test.want {
+			t.Errorf("%+v matching %q: got %v, want %v", test.m, test.value, got, test.want)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	cards := []*Card{
+		parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nEMAIL;TYPE=work:john@example.com\nTEL;TYPE=\"cell,voice\":+1-555-555-0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:Jane Roe\nEMAIL:jane@example.org\nTEL;TYPE=home:+1-555-555-0101\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:Richard Roe\nEMAIL;TYPE=home:richard@EXAMPLE.com\nEND:VCARD"),
+	}
+	tests := []struct {
+		f    Filter
+		want []int
+	}{
+		{Filter{}, []int{0, 1, 2}},
+		{Filter{Props: []PropFilter{{Name: "tel"}}}, []int{0, 1}},
+		{Filter{Props: []PropFilter{{Name: "TEL", IsNotDefined: true}}}, []int{2}},
+		{Filter{Props: []PropFilter{{Name: "EMAIL", Texts: []TextMatch{{Text: "@example.com"}}}}}, []int{0, 2}},
+		{Filter{Props: []PropFilter{{Name: "TEL", Params: []ParamFilter{{Name: "TYPE", Text: &TextMatch{Text: "cell", MatchType: MatchEquals}}}}}}, []int{0}},
+		{Filter{Props: []PropFilter{{Name: "EMAIL", Params: []ParamFilter{{Name: "TYPE", IsNotDefined: true}}}}}, []int{1}},
+		{Filter{Props: []PropFilter{{Name: "TEL", Params: []ParamFilter{{Name: "TYPE", Text: &TextMatch{Text: "voice", Negate: true}}}}}}, []int{1}},
+		{Filter{Props: []PropFilter{{Name: "TEL", Params: []ParamFilter{{Name: "TYPE", Text: &TextMatch{Text: "cell", MatchType: MatchEquals, Negate: true}}}}}}, []int{1}},
+		{Filter{AllOf: true, Props: []PropFilter{
+			{Name: "EMAIL", Texts: []TextMatch{{Text: "@example.com", MatchType: MatchEndsWith}}},
+			{Name: "FN", Texts: []TextMatch{{Text: "roe"}}},
+		}}, []int{2}},
+		{Filter{Props: []PropFilter{
+			{Name: "EMAIL", Texts: []TextMatch{{Text: "@example.org", MatchType: MatchEndsWith}}},
+			{Name: "FN", Texts: []TextMatch{{Text: "john", MatchType: MatchStartsWith}}},
+		}}, []int{0, 1}},
+		{Filter{Props: []PropFilter{{Name: "EMAIL", AllOf: true,
+			Texts:  []TextMatch{{Text: "example.com"}},
+			Params: []ParamFilter{{Name: "TYPE", Text: &TextMatch{Text: "home"}}},
+		}}}, []int{2}},
+		{Filter{Props: []PropFilter{{Name: "EMAIL",
+			Texts:  []TextMatch{{Text: "example.org"}},
+			Params: []ParamFilter{{Name: "TYPE", Text: &TextMatch{Text: "work"}}},
+		}}}, []int{0, 1}},
+	}
+	for i, test := range tests {
+		got := test.f.Select(cards)
+		if len(got) != len(test.want) {
+			t.Errorf("filter %v: got %v cards, want %v", i, len(got), len(test.want))
+			continue
+		}
+		for j, card := range got {
+			if card != cards[test.want[j]] {
+				t.Errorf("filter %v: card %v is %q, want %q", i, j, card.FormattedName(), cards[test.want[j]].FormattedName())
+			}
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	card := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nEMAIL;TYPE=work:john@example.com\nTEL;TYPE=cell:+1-555-555-0100\nEND:VCARD")
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"EMAIL contains @example.com AND TEL param TYPE=cell is defined", true},
+		{"EMAIL contains @example.com AND TEL param TYPE = home", false},
+		{"EMAIL contains @example.com and tel param type is defined", true},
+		{"NOTE is defined OR FN starts-with john", true},
+		{"NOTE is not defined AND FN not contains jane", true},
+		{`FN equals "john doe"`, true},
+		{`FN = "john \"doe\""`, false},
+		{"FN ends-with DOE AND EMAIL param TYPE is not defined", false},
+		{`NOTE is defined OR FN contains "AND"`, false},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if got := f.Match(card); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"EMAIL",
+		"EMAIL matches x",
+		"EMAIL contains",
+		"EMAIL is",
+		"EMAIL is there",
+		"EMAIL contains x AND",
+		"EMAIL contains x BUT FN contains y",
+		"EMAIL contains x AND FN contains y OR TEL is defined",
+		`EMAIL contains "x`,
+		`"EMAIL" is defined`,
+		"TEL param TYPE=cell is not defined",
+		"TEL param",
+	}
+	for _, s := range tests {
+		if _, err := ParseFilter(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
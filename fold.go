@@ -16,11 +16,17 @@ import (
 // UnfoldingReader is a Reader that unfolds lines of text as they are
 // encountered and converts the "\r\n" line ending sequence to a single '\n'.
 type UnfoldingReader struct {
-	r          io.Reader
-	line       int
-	unread     []byte // a stack of bytes that are queued up to be read
-	peeked     int    // if not -1, the byte that was peeked at
-	peekedLine int    // the line number of the peeked byte
+	r               io.Reader
+	line            int
+	pos             int64  // the number of (folded) bytes consumed so far
+	lineStart       int64  // the value of pos at the start of the current line
+	unfoldedOffset  int    // the number of (unfolded) bytes read so far
+	last            int    // if not -1, the last (unfolded) byte read
+	unread          []byte // a stack of bytes that are queued up to be read
+	peeked          int    // if not -1, the byte that was peeked at
+	peekedLine      int    // the line number of the peeked byte
+	peekedPos       int64  // the value of pos after the peeked byte
+	peekedLineStart int64  // the value of lineStart after the peeked byte
 }
 
 // NewUnfoldingReader returns a new UnfoldingReader wrapping the given Reader.
@@ -28,6 +34,7 @@ func NewUnfoldingReader(r io.Reader) *UnfoldingReader {
 	return &UnfoldingReader{
 		r:      r,
 		line:   1,
+		last:   -1,
 		peeked: -1,
 	}
 }
@@ -46,6 +53,17 @@ func (r *UnfoldingReader) Read(bs []byte) (n int, err error) {
 
 // ReadByte reads a single byte from the reader.
 func (r *UnfoldingReader) ReadByte() (byte, error) {
+	b, err := r.readUnfolded()
+	if err != nil {
+		return 0, err
+	}
+	r.unfoldedOffset++
+	r.last = int(b)
+	return b, nil
+}
+
+// readUnfolded reads a single byte, taking care of unfolding.
+func (r *UnfoldingReader) readUnfolded() (byte, error) {
 	b, err := r.readByte()
 	if err != nil {
 		return 0, err
@@ -61,21 +79,21 @@ func (r *UnfoldingReader) ReadByte() (byte, error) {
 				return '\n', nil
 			}
 			if b3 == ' ' || b3 == '\t' {
-				return r.ReadByte()
+				return r.readUnfolded()
 			}
-			r.unread = append(r.unread, b3)
+			r.unreadByte(b3)
 			return '\n', nil
 		}
-		r.unread = append(r.unread, b2)
+		r.unreadByte(b2)
 	} else if b == '\n' {
 		b2, err := r.readByte()
 		if err != nil {
 			return '\n', nil
 		}
 		if b2 == ' ' || b2 == '\t' {
-			return r.ReadByte()
+			return r.readUnfolded()
 		}
-		r.unread = append(r.unread, b2)
+		r.unreadByte(b2)
 	}
 	return b, nil
 }
@@ -86,11 +104,13 @@ func (r *UnfoldingReader) readByte() (byte, error) {
 	if b := r.peeked; b != -1 {
 		r.peeked = -1
 		r.line = r.peekedLine
+		r.pos, r.lineStart = r.peekedPos, r.peekedLineStart
 		return byte(b), nil
 	}
 	if len(r.unread) > 0 {
 		b := r.unread[len(r.unread)-1]
 		r.unread = r.unread[:len(r.unread)-1]
+		r.pos++
 		return b, nil
 	}
 
@@ -99,30 +119,74 @@ func (r *UnfoldingReader) readByte() (byte, error) {
 	if n == 0 {
 		return 0, err
 	}
+	r.pos++
 	if bs[0] == '\n' {
 		r.line++
+		r.lineStart = r.pos
 	}
 	return bs[0], nil
 }
 
+// unreadByte queues up a byte read by readByte to be read again.
+func (r *UnfoldingReader) unreadByte(b byte) {
+	r.unread = append(r.unread, b)
+	r.pos--
+}
+
 // PeekByte reads the next byte but keeps it for a future call to ReadByte.
 func (r *UnfoldingReader) PeekByte() (byte, error) {
-	line := r.line
-	b, err := r.ReadByte()
+	line, pos, lineStart := r.line, r.pos, r.lineStart
+	b, err := r.readUnfolded()
 	if err != nil {
 		return 0, err
 	}
 	r.peeked = int(b)
 	r.peekedLine = r.line
-	r.line = line
+	r.peekedPos, r.peekedLineStart = r.pos, r.lineStart
+	r.line, r.pos, r.lineStart = line, pos, lineStart
 	return b, nil
 }
 
 // Line returns the number of the current line being read.
 func (r *UnfoldingReader) Line() int {
+	if r.peekedAhead() {
+		return r.peekedLine
+	}
 	return r.line
 }
 
+// Column returns the column (in bytes, starting from 1) of the next byte to be
+// read within the current line. Lines are counted before unfolding, so the
+// column of a byte on a continuation line is relative to the start of the
+// continuation line.
+func (r *UnfoldingReader) Column() int {
+	pos, lineStart := r.pos, r.lineStart
+	if r.peekedAhead() {
+		pos, lineStart = r.peekedPos-1, r.peekedLineStart
+	}
+	if pos < lineStart {
+		return 1
+	}
+	return int(pos-lineStart) + 1
+}
+
+// Offset returns the offset (in bytes, before unfolding) of the next byte to
+// be read.
+func (r *UnfoldingReader) Offset() int64 {
+	if r.peekedAhead() {
+		return r.peekedPos - 1
+	}
+	return r.pos
+}
+
+// peekedAhead returns whether the peeked byte is known to be at a different
+// position in the input than the one given by pos, which happens when it
+// follows a folded line break. The position of a peeked newline is not
+// precisely known, since it may be part of a "\r\n" sequence.
+func (r *UnfoldingReader) peekedAhead() bool {
+	return r.peeked != -1 && r.peeked != '\n' && r.peekedPos-1 != r.pos
+}
+
 // Fold folds a string, ensuring that no line exceeds the given number of bytes.
 // It also converts simple '\n' line endings to "\r\n". The vCard specification
 // recommends that output lines be folded to a width of at most 75 bytes,
@@ -113,3 +113,30 @@ func TestFold(t *testing.T) {
 		}
 	}
 }
+
+func TestPosition(t *testing.T) {
+	r := NewUnfoldingReader(strings.NewReader("ab\r\n c\r\nd"))
+	tests := []struct {
+		b      byte
+		line   int
+		column int
+		offset int64
+	}{
+		{'a', 1, 1, 0},
+		{'b', 1, 2, 1},
+		{'c', 2, 2, 5},
+		{'\n', 2, 3, 6},
+		{'d', 3, 1, 8},
+	}
+
+	for _, test := range tests {
+		if b, err := r.PeekByte(); err != nil || b != test.b {
+			t.Fatalf("peeked %q, %v, want %q", b, err, test.b)
+		}
+		if r.Line() != test.line || r.Column() != test.column || r.Offset() != test.offset {
+			t.Errorf("before %q: got line %v, column %v, offset %v, want %v, %v, %v",
+				test.b, r.Line(), r.Column(), r.Offset(), test.line, test.column, test.offset)
+		}
+		r.ReadByte()
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MarshalJSON returns the card in the jCard format described by RFC 7095.
+// Property and parameter names are written in lowercase, and the group of a
+// property is written as the "group" parameter. The VALUE parameter is not
+// written as a parameter, but is used as the type of the value. Dates, times
+// and UTC offsets are written in the extended format required by jCard, such
+// as "1985-04-12" and "-05:00".
+//
+// To write several cards as a jCard array, marshal a []*Card.
+func (c *Card) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`["vcard",[`)
+	version := c.text("VERSION")
+	first := true
+	c.walk(func(name string, prop Property) error {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		marshalPropertyJSON(buf, version, name, prop)
+		return nil
+	})
+	buf.WriteString("]]")
+	return buf.Bytes(), nil
+}
+
+// marshalPropertyJSON writes a single property of a card of the given version
+// in jCard format.
+func marshalPropertyJSON(buf *bytes.Buffer, version, name string, prop Property) {
+	buf.WriteByte('[')
+	writeJSONString(buf, strings.ToLower(name))
+
+	buf.WriteString(",{")
+	first := true
+	if prop.group != "" {
+		buf.WriteString(`"group":`)
+		writeJSONString(buf, strings.ToLower(prop.group))
+		first = false
+	}
+	for _, key := range prop.paramOrder {
+		if key == "VALUE" {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeJSONString(buf, strings.ToLower(key))
+		buf.WriteByte(':')
+		writeJSONStrings(buf, prop.params[key])
+	}
+	buf.WriteString("},")
+
+	typ := ValueType(version, name, prop)
+	writeJSONString(buf, typ)
+	switch {
+	case typ == "unknown":
+		// Values of unknown type are written exactly as they would
+		// appear in vCard syntax.
+		sb := new(strings.Builder)
+		writeComponents(sb, prop.components)
+		buf.WriteByte(',')
+		writeJSONString(buf, sb.String())
+	case typ != "text":
+		buf.WriteByte(',')
+		writeJSONValue(buf, typ, formatDateValues(typ, prop.joined(), true))
+	case len(prop.components) > 1:
+		// Structured values are written as a single array, containing
+		// an array for each component with several values.
+		buf.WriteString(",[")
+		for i, values := range prop.components {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONStrings(buf, values)
+		}
+		buf.WriteByte(']')
+	case len(prop.components) == 1 && len(prop.components[0]) > 0:
+		for _, value := range prop.components[0] {
+			buf.WriteByte(',')
+			writeJSONString(buf, value)
+		}
+	default:
+		buf.WriteString(`,""`)
+	}
+	buf.WriteByte(']')
+}
+
+// writeJSONValue writes a value of the given type, using a JSON number or
+// boolean if appropriate.
+func writeJSONValue(buf *bytes.Buffer, typ, value string) {
+	switch typ {
+	case "integer", "float":
+		if _, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+			buf.WriteString(value)
+			return
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			buf.WriteString(strconv.FormatBool(b))
+			return
+		}
+	}
+	writeJSONString(buf, value)
+}
+
+// formatDateValues converts the comma-separated values of a property of the
+// given type between the basic format used by vCard and the extended format
+// required by jCard (RFC 7095, section 3.5), such as "1985-04-12",
+// "T10:22:00" and "-05:00". Values of other types, and values which cannot
+// be parsed, are returned unchanged.
+func formatDateValues(typ, value string, extended bool) string {
+	switch typ {
+	case "date", "time", "date-time", "date-and-or-time", "timestamp", "utc-offset":
+	default:
+		return value
+	}
+	values := strings.Split(value, ",")
+	for i, v := range values {
+		if typ == "utc-offset" {
+			if offset, ok := parseUTCOffset(v); ok {
+				values[i] = formatUTCOffset(offset, extended)
+			}
+			continue
+		}
+		if typ == "time" {
+			v = "T" + v
+		}
+		d, err := ParseDate(v)
+		if err != nil {
+			continue
+		}
+		values[i] = d.format(extended)
+		if typ == "time" {
+			values[i] = strings.TrimPrefix(values[i], "T")
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// writeJSONStrings writes a single string as a JSON string, or several
+// strings as a JSON array. No strings are written as an empty string.
+func writeJSONStrings(buf *bytes.Buffer, values []string) {
+	switch len(values) {
+	case 0:
+		buf.WriteString(`""`)
+		return
+	case 1:
+		writeJSONString(buf, values[0])
+		return
+	}
+	buf.WriteByte('[')
+	for i, value := range values {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, value)
+	}
+	buf.WriteByte(']')
+}
+
+// writeJSONString writes a JSON string.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	// Marshalling a string can never fail.
+	bs, _ := json.Marshal(s)
+	buf.Write(bs)
+}
+
+// UnmarshalJSON parses a card in the jCard format described by RFC 7095,
+// replacing any existing properties in the card. It is the inverse of
+// MarshalJSON: the "group" parameter sets the group of a property, and value
+// types other than the default for a property are stored in the VALUE
+// parameter. Dates, times and UTC offsets are converted to the basic format
+// used by vCard 4.0.
+func (c *Card) UnmarshalJSON(data []byte) error {
+	var card []json.RawMessage
+	if err := json.Unmarshal(data, &card); err != nil {
+		return err
+	}
+	var tag string
+	if len(card) != 2 || json.Unmarshal(card[0], &tag) != nil || tag != "vcard" {
+		return errors.New(`vcard: jCard must be an array of "vcard" and an array of properties`)
+	}
+	var props []json.RawMessage
+	if err := json.Unmarshal(card[1], &props); err != nil {
+		return fmt.Errorf("vcard: invalid jCard properties: %v", err)
+	}
+
+	*c = Card{}
+	for _, raw := range props {
+		name, prop, err := unmarshalPropertyJSON(c.text("VERSION"), raw)
+		if err != nil {
+			return err
+		}
+		c.Add(name, prop)
+	}
+	return nil
+}
+
+// unmarshalPropertyJSON parses a single property of a card of the given
+// version in jCard format.
+func unmarshalPropertyJSON(version string, data []byte) (name string, prop Property, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var parts []json.RawMessage
+	if err := dec.Decode(&parts); err != nil {
+		return "", Property{}, fmt.Errorf("vcard: invalid jCard property: %v", err)
+	}
+	var typ string
+	if len(parts) < 4 || json.Unmarshal(parts[0], &name) != nil || json.Unmarshal(parts[2], &typ) != nil {
+		return "", Property{}, fmt.Errorf("vcard: invalid jCard property %s", data)
+	}
+	name = strings.ToUpper(name)
+	if err := unmarshalParamsJSON(parts[1], &prop); err != nil {
+		return "", Property{}, err
+	}
+
+	typ = strings.ToLower(typ)
+	if _, ok := prop.params["VALUE"]; !ok && typ != "unknown" && typ != ValueType(version, name, prop) {
+		prop.SetParam("VALUE", typ)
+	}
+
+	var components [][]string
+	for _, raw := range parts[3:] {
+		var structured []json.RawMessage
+		if json.Unmarshal(raw, &structured) == nil {
+			for _, component := range structured {
+				values, err := unmarshalStringsJSON(component)
+				if err != nil {
+					return "", Property{}, err
+				}
+				components = append(components, values)
+			}
+			continue
+		}
+		value, err := unmarshalValueJSON(raw)
+		if err != nil {
+			return "", Property{}, err
+		}
+		if len(components) == 0 {
+			components = append(components, nil)
+		}
+		components[0] = append(components[0], value)
+	}
+
+	switch typ {
+	case "text":
+		prop.SetComponents(components...)
+	case "unknown":
+		var raw []string
+		for _, values := range components {
+			raw = append(raw, strings.Join(values, ","))
+		}
+		if prop.components, err = parseComponents(strings.Join(raw, ";")); err != nil {
+			return "", Property{}, err
+		}
+	default:
+		// Values of other types are not escaped, so they must be written
+		// exactly as they appear.
+		prop.components = components
+		prop.setJoined(formatDateValues(typ, prop.joined(), false))
+	}
+	return name, prop, nil
+}
+
+// parseComponents parses a string containing a property value in vCard
+// syntax into its components.
+func parseComponents(s string) ([][]string, error) {
+	p := NewParser(strings.NewReader(s))
+	components, err := p.parsePropertyComponents()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("vcard: invalid property value %q", s)
+	}
+	return components, nil
+}
+
+// unmarshalParamsJSON parses the parameters of a jCard property, adding them
+// to the property in the order they appear.
+func unmarshalParamsJSON(data []byte, prop *Property) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return fmt.Errorf("vcard: invalid jCard parameters %s", data)
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("vcard: invalid jCard parameters: %v", err)
+		}
+		key := strings.ToUpper(t.(string))
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("vcard: invalid jCard parameters: %v", err)
+		}
+		values, err := unmarshalStringsJSON(raw)
+		if err != nil {
+			return err
+		}
+		if key == "GROUP" {
+			prop.SetGroup(strings.Join(values, ","))
+		} else {
+			prop.addParam(key, values...)
+		}
+	}
+	return nil
+}
+
+// unmarshalStringsJSON parses either a single value or an array of values.
+func unmarshalStringsJSON(data []byte) ([]string, error) {
+	var raws []json.RawMessage
+	if json.Unmarshal(data, &raws) != nil {
+		value, err := unmarshalValueJSON(data)
+		return []string{value}, err
+	}
+	values := make([]string, len(raws))
+	for i, raw := range raws {
+		var err error
+		if values[i], err = unmarshalValueJSON(raw); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// unmarshalValueJSON parses a single value, which may be a string, number or
+// boolean, converting it to its textual representation.
+func unmarshalValueJSON(data []byte) (string, error) {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return s, nil
+	}
+	var b bool
+	if json.Unmarshal(data, &b) == nil {
+		return strings.ToUpper(strconv.FormatBool(b)), nil
+	}
+	var n json.Number
+	if json.Unmarshal(data, &n) == nil {
+		return n.String(), nil
+	}
+	return "", fmt.Errorf("vcard: invalid jCard value %s", data)
+}
+
+// ParseAllJSON parses all the cards in the given jCard input, which may be
+// either a single jCard or an array of jCards.
+func ParseAllJSON(r io.Reader) ([]*Card, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var tag string
+	if len(raw) > 0 && json.Unmarshal(raw[0], &tag) == nil && tag == "vcard" {
+		card := new(Card)
+		data, _ := json.Marshal(raw)
+		if err := card.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		return []*Card{card}, nil
+	}
+
+	cards := make([]*Card, 0, len(raw))
+	for _, data := range raw {
+		card := new(Card)
+		if err := card.UnmarshalJSON(data); err != nil {
+			return cards, err
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
@@ -0,0 +1,172 @@
+package vcard
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleVCard4 = `BEGIN:VCARD
+VERSION:4.0
+FN:Simon Perreault
+N:Perreault;Simon;;;ing. jr,M.Sc.
+BDAY:--0203
+GENDER:M
+EMAIL;TYPE=work:simon.perreault@viagenie.ca
+HOME.TEL;TYPE="work,voice";PREF=1;VALUE=uri:tel:+1-418-656-9254;ext=102
+GEO;TYPE=work:geo:46.772673,-71.282945
+CATEGORIES:computers,cameras
+X-FOO:a\,b;c
+X-NUM;VALUE=integer:42
+NOTE:line\nbreak
+END:VCARD
+`
+
+const sampleJCard = `["vcard",[` +
+	`["version",{},"text","4.0"],` +
+	`["fn",{},"text","Simon Perreault"],` +
+	`["n",{},"text",["Perreault","Simon","","",["ing. jr","M.Sc."]]],` +
+	`["bday",{},"date-and-or-time","--02-03"],` +
+	`["gender",{},"text","M"],` +
+	`["email",{"type":"work"},"text","simon.perreault@viagenie.ca"],` +
+	`["tel",{"group":"home","type":"work,voice","pref":"1"},"uri","tel:+1-418-656-9254;ext=102"],` +
+	`["geo",{"type":"work"},"uri","geo:46.772673,-71.282945"],` +
+	`["categories",{},"text","computers","cameras"],` +
+	`["x-foo",{},"unknown","a\\,b;c"],` +
+	`["x-num",{},"integer",42],` +
+	`["note",{},"text","line\nbreak"]` +
+	`]]`
+
+func TestMarshalJSON(t *testing.T) {
+	cards, err := ParseAll(strings.NewReader(sampleVCard4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := json.Marshal(cards[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != sampleJCard {
+		t.Fatalf("got %s, want %s", data, sampleJCard)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	card := new(Card)
+	if err := json.Unmarshal([]byte(sampleJCard), card); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out := card.UnfoldedString(); out != sampleVCard4 {
+		t.Fatalf("got %q, want %q", out, sampleVCard4)
+	}
+	if tel := card.Get("TEL")[0].Param("TYPE"); len(tel) != 1 || tel[0] != "work,voice" {
+		t.Fatalf("got TEL TYPE %q, want %q", tel, []string{"work,voice"})
+	}
+}
+
+func TestParseAllJSON(t *testing.T) {
+	tests := []struct {
+		in string
+		n  int
+	}{
+		{sampleJCard, 1},
+		{"[" + sampleJCard + "," + sampleJCard + "]", 2},
+		{"[]", 0},
+	}
+
+	for _, test := range tests {
+		cards, err := ParseAllJSON(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("ParseAllJSON(%q): unexpected error: %v", test.in, err)
+		} else if len(cards) != test.n {
+			t.Errorf("ParseAllJSON(%q): got %v cards, want %v", test.in, len(cards), test.n)
+		}
+		for _, card := range cards {
+			if fn := card.FormattedName(); fn != "Simon Perreault" {
+				t.Errorf("ParseAllJSON(%q): got FN %q", test.in, fn)
+			}
+		}
+	}
+}
+
+func TestUnmarshalJSONFailure(t *testing.T) {
+	tests := []string{
+		`{}`,
+		`["vcard"]`,
+		`["vcalendar",[]]`,
+		`["vcard",[["fn",{},"text"]]]`,
+		`["vcard",[["fn",[],"text","x"]]]`,
+		`["vcard",[["fn",{},"text",{}]]]`,
+		`["vcard",[["x-foo",{},"unknown","bad\\escape"]]]`,
+	}
+
+	for _, test := range tests {
+		card := new(Card)
+		if err := json.Unmarshal([]byte(test), card); err == nil {
+			t.Errorf("successfully unmarshalled %q as %q", test, card)
+		}
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+	tests := []struct {
+		prop  string
+		jcard string
+	}{
+		{"BDAY:19850412", `["bday",{},"date-and-or-time","1985-04-12"]`},
+		{"BDAY:--0203", `["bday",{},"date-and-or-time","--02-03"]`},
+		{"BDAY:---03", `["bday",{},"date-and-or-time","---03"]`},
+		{"BDAY:T1022", `["bday",{},"date-and-or-time","T10:22"]`},
+		{"BDAY;VALUE=date:1985-04", `["bday",{},"date","1985-04"]`},
+		{"BDAY;VALUE=date-time:19961022T140000-0500", `["bday",{},"date-time","1996-10-22T14:00:00-05:00"]`},
+		{"REV:19951031T222710Z", `["rev",{},"timestamp","1995-10-31T22:27:10Z"]`},
+		{"X-T;VALUE=time:-2200", `["x-t",{},"time","-22:00"]`},
+		{"TZ;VALUE=utc-offset:-0500", `["tz",{},"utc-offset","-05:00"]`},
+		{"BDAY;VALUE=text:circa 1800", `["bday",{},"text","circa 1800"]`},
+		{"NOTE:", `["note",{},"text",""]`},
+	}
+
+	for _, test := range tests {
+		in := "BEGIN:VCARD\r\nVERSION:4.0\r\n" + test.prop + "\r\nEND:VCARD\r\n"
+		card, err := NewParser(strings.NewReader(in)).Next()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.prop, err)
+			continue
+		}
+		want := `["vcard",[["version",{},"text","4.0"],` + test.jcard + `]]`
+		data, err := json.Marshal(card)
+		if err != nil || string(data) != want {
+			t.Errorf("%q: got %s, %v, want %s", test.prop, data, err, want)
+		}
+
+		card = new(Card)
+		if err := json.Unmarshal([]byte(want), card); err != nil {
+			t.Errorf("%s: unexpected error: %v", want, err)
+		} else if out, want := card.UnfoldedString(), strings.Replace(in, "\r", "", -1); out != want {
+			t.Errorf("%s: got %q, want %q", test.jcard, out, want)
+		}
+	}
+}
+
+func TestMarshalJSONEmptyValue(t *testing.T) {
+	card := new(Card)
+	var note Property
+	note.SetValues()
+	card.Add("NOTE", note)
+	data, err := json.Marshal(card)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const want = `["vcard",[["note",{},"text",""]]]`
+	if string(data) != want {
+		t.Fatalf("got %s, want %s", data, want)
+	}
+	card = new(Card)
+	if err := json.Unmarshal(data, card); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note := card.Get("NOTE"); len(note) != 1 || !reflect.DeepEqual(note[0].Components(), [][]string{{""}}) {
+		t.Fatalf("got NOTE %q, want a single empty value", note)
+	}
+}
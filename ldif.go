@@ -0,0 +1,554 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// LDIFEntry is an entry of an LDAP directory, as represented in LDIF (RFC
+// 2849).
+type LDIFEntry struct {
+	DN         string // the distinguished name of the entry
+	Attributes []LDIFAttribute
+}
+
+// LDIFAttribute is a single value of an attribute of an LDIFEntry. An
+// attribute with several values is represented by several LDIFAttributes
+// with the same name.
+type LDIFAttribute struct {
+	Name  string
+	Value string // the value, which may be binary data
+}
+
+// Get returns the values of the attribute with the given name (which is
+// matched case-insensitively), in the order they appear in the entry.
+func (e *LDIFEntry) Get(name string) []string {
+	var values []string
+	for _, attr := range e.Attributes {
+		if strings.EqualFold(attr.Name, name) {
+			values = append(values, attr.Value)
+		}
+	}
+	return values
+}
+
+// Add adds a value of an attribute to the end of the entry.
+func (e *LDIFEntry) Add(name, value string) {
+	e.Attributes = append(e.Attributes, LDIFAttribute{name, value})
+}
+
+// LDIFParser reads entries from LDIF input. Only content records are
+// supported: change records (with a "changetype" attribute) and values given
+// by URLs (with "name:<") result in an error.
+type LDIFParser struct {
+	r       *bufio.Reader
+	line    int    // the number of physical lines read
+	next    string // the next physical line, if peeked is set
+	peeked  bool
+	eof     bool
+	started bool
+}
+
+// NewLDIFParser returns a new parser reading from the given reader.
+func NewLDIFParser(r io.Reader) *LDIFParser {
+	return &LDIFParser{r: bufio.NewReader(r)}
+}
+
+// ParseAllLDIF parses all the entries in the given LDIF input.
+func ParseAllLDIF(r io.Reader) ([]*LDIFEntry, error) {
+	p := NewLDIFParser(r)
+	var entries []*LDIFEntry
+	for {
+		entry, err := p.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Next returns the next entry of the input. If there are no more entries,
+// the error will be io.EOF.
+func (p *LDIFParser) Next() (*LDIFEntry, error) {
+	var entry *LDIFEntry
+	for {
+		line, ok, err := p.logicalLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || line == "" {
+			if entry != nil {
+				return entry, nil
+			}
+			if !ok {
+				return nil, io.EOF
+			}
+			continue
+		}
+		if line[0] == '#' {
+			continue
+		}
+
+		name, value, err := p.parseAttribute(line)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry == nil && !p.started && strings.EqualFold(name, "version"):
+			if value != "1" {
+				return nil, p.errorf("unsupported version %q", value)
+			}
+		case entry == nil && strings.EqualFold(name, "dn"):
+			entry = &LDIFEntry{DN: value}
+		case entry == nil:
+			return nil, p.errorf("expected dn, got %q", name)
+		case strings.EqualFold(name, "changetype"):
+			return nil, p.errorf("change records are not supported")
+		default:
+			entry.Add(name, value)
+		}
+		p.started = true
+	}
+}
+
+// parseAttribute parses a line of the form "name: value", "name:: base64"
+// or "name:< url".
+func (p *LDIFParser) parseAttribute(line string) (name, value string, err error) {
+	colon := strings.IndexByte(line, ':')
+	if colon <= 0 {
+		return "", "", p.errorf("expected attribute name followed by ':'")
+	}
+	name, value = line[:colon], line[colon+1:]
+	switch {
+	case strings.HasPrefix(value, ":"):
+		data, err := base64.StdEncoding.DecodeString(strings.TrimLeft(value[1:], " "))
+		if err != nil {
+			return "", "", p.errorf("invalid base64 value of %v: %v", name, err)
+		}
+		return name, string(data), nil
+	case strings.HasPrefix(value, "<"):
+		return "", "", p.errorf("values given by URLs are not supported")
+	}
+	return name, strings.TrimLeft(value, " "), nil
+}
+
+// logicalLine returns the next line of input, after unfolding. The result ok
+// is false at the end of the input.
+func (p *LDIFParser) logicalLine() (line string, ok bool, err error) {
+	line, ok, err = p.physicalLine()
+	if !ok || err != nil {
+		return "", ok, err
+	}
+	for {
+		next, ok, err := p.physicalLine()
+		if err != nil {
+			return "", false, err
+		}
+		if !ok || !strings.HasPrefix(next, " ") {
+			p.next, p.peeked = next, ok
+			return line, true, nil
+		}
+		line += next[1:]
+	}
+}
+
+// physicalLine returns the next line of input, without its line ending.
+func (p *LDIFParser) physicalLine() (string, bool, error) {
+	if p.peeked {
+		p.peeked = false
+		return p.next, true, nil
+	}
+	if p.eof {
+		return "", false, nil
+	}
+	line, err := p.r.ReadString('\n')
+	if err == io.EOF {
+		p.eof = true
+		if line == "" {
+			return "", false, nil
+		}
+	} else if err != nil {
+		return "", false, err
+	}
+	p.line++
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), true, nil
+}
+
+// errorf returns an error describing a problem at the current line.
+func (p *LDIFParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("vcard: invalid LDIF on line %v: %v", p.line, fmt.Sprintf(format, args...))
+}
+
+// ldifWidth is the maximum length of a line written by an LDIFEncoder.
+const ldifWidth = 76
+
+// LDIFEncoder writes entries in LDIF to an underlying writer. The output
+// begins with a version line, and values which cannot be written as they are
+// (such as those containing newlines or non-ASCII characters) are encoded
+// using base64.
+type LDIFEncoder struct {
+	w       io.Writer
+	started bool
+	buf     bytes.Buffer
+}
+
+// NewLDIFEncoder returns a new encoder that writes to the given writer.
+func NewLDIFEncoder(w io.Writer) *LDIFEncoder {
+	return &LDIFEncoder{w: w}
+}
+
+// Encode writes a single entry to the underlying writer.
+func (e *LDIFEncoder) Encode(entry *LDIFEntry) error {
+	e.buf.Reset()
+	if !e.started {
+		e.buf.WriteString("version: 1\n")
+		e.started = true
+	}
+	e.buf.WriteString("\n")
+	e.writeLine("dn", entry.DN)
+	for _, attr := range entry.Attributes {
+		e.writeLine(attr.Name, attr.Value)
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// writeLine writes an attribute line to the buffer, folding it if necessary.
+func (e *LDIFEncoder) writeLine(name, value string) {
+	line := name + ": " + value
+	if !isSafeLDIF(value) {
+		line = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	for width := ldifWidth; len(line) > width; width = ldifWidth - 1 {
+		e.buf.WriteString(line[:width])
+		e.buf.WriteString("\n ")
+		line = line[width:]
+	}
+	e.buf.WriteString(line)
+	e.buf.WriteString("\n")
+}
+
+// isSafeLDIF returns whether a value may be written in LDIF without base64
+// encoding. Values ending with a space are also encoded, as recommended by
+// RFC 2849, since the space could easily be lost.
+func isSafeLDIF(value string) bool {
+	if value == "" {
+		return true
+	}
+	if c := value[0]; c == ' ' || c == ':' || c == '<' || value[len(value)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// AttributeMapping describes how an LDAP attribute corresponds to part of a
+// property of a card.
+//
+// Mappings with the same Property and Types refer to the same occurrences of
+// the property, so that (for example) the components of a name can be given
+// by separate attributes.
+type AttributeMapping struct {
+	Attribute string   // the name of the attribute, such as "mail"
+	Property  string   // the name of the property, such as "EMAIL"
+	Types     []string // the values of the TYPE parameter to match or set
+	// Component is the index of the component of the value given by the
+	// attribute, or -1 for the whole value. The whole value of an ADR
+	// property is given as a postal address, with lines separated by "$".
+	Component int
+	// MediaType, if not empty, is the media type of the binary data given
+	// by the attribute, such as "image/jpeg" for jpegPhoto.
+	MediaType string
+}
+
+// AttributeMap describes how LDAP entries correspond to cards.
+type AttributeMap struct {
+	// ObjectClasses are the values of the objectClass attribute of the
+	// entries created from cards.
+	ObjectClasses []string
+	// RDN is the attribute whose value (with the base DN) forms the
+	// distinguished name of the entries created from cards.
+	RDN        string
+	Attributes []AttributeMapping
+}
+
+// InetOrgPerson maps cards to entries using the inetOrgPerson object class
+// (RFC 2798).
+var InetOrgPerson = &AttributeMap{
+	ObjectClasses: []string{"top", "person", "organizationalPerson", "inetOrgPerson"},
+	RDN:           "cn",
+	Attributes: []AttributeMapping{
+		{Attribute: "cn", Property: "FN", Component: -1},
+		{Attribute: "sn", Property: "N", Component: 0},
+		{Attribute: "givenName", Property: "N", Component: 1},
+		{Attribute: "title", Property: "TITLE", Component: -1},
+		{Attribute: "o", Property: "ORG", Component: 0},
+		{Attribute: "ou", Property: "ORG", Component: 1},
+		{Attribute: "mail", Property: "EMAIL", Component: -1},
+		{Attribute: "telephoneNumber", Property: "TEL", Component: -1},
+		{Attribute: "facsimileTelephoneNumber", Property: "TEL", Types: []string{"fax"}, Component: -1},
+		{Attribute: "pager", Property: "TEL", Types: []string{"pager"}, Component: -1},
+		{Attribute: "homePhone", Property: "TEL", Types: []string{"home"}, Component: -1},
+		{Attribute: "mobile", Property: "TEL", Types: []string{"cell"}, Component: -1},
+		{Attribute: "postalAddress", Property: "ADR", Component: -1},
+		{Attribute: "homePostalAddress", Property: "ADR", Types: []string{"home"}, Component: -1},
+		{Attribute: "description", Property: "NOTE", Component: -1},
+		{Attribute: "jpegPhoto", Property: "PHOTO", Component: -1, MediaType: "image/jpeg"},
+	},
+}
+
+// group returns the slot identifying the occurrences to which the mapping
+// refers. The index of the slot is always 0.
+func (am *AttributeMapping) group() slot {
+	col := Column{Property: am.Property, Types: am.Types}
+	return col.slot()
+}
+
+// Entry returns an LDAP entry containing the information in a card. The
+// distinguished name of the entry is formed from the first value of the RDN
+// attribute and the base DN (which may be empty); it is empty if the entry
+// has no value for the RDN attribute.
+//
+// Each occurrence of a property is given by the attributes of at most one
+// group of mappings. Mappings with more Types are used first (and, of those
+// with the same number, the earliest), so that (for example) a telephone
+// number with the type "cell" is given by the mobile attribute rather than
+// telephoneNumber. Binary data is only given if it is
+// inline and has the expected media type (or no media type).
+func (m *AttributeMap) Entry(card *Card, base string) *LDIFEntry {
+	entry := new(LDIFEntry)
+	for _, class := range m.ObjectClasses {
+		entry.Add("objectClass", class)
+	}
+
+	var groups []slot
+	seen := make(map[slot]bool)
+	for i := range m.Attributes {
+		if g := m.Attributes[i].group(); !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return typeCount(groups[i]) > typeCount(groups[j])
+	})
+	props := make(map[slot][]Property)
+	used := make(map[string][]bool)
+	for _, g := range groups {
+		all := card.Get(g.name)
+		if used[g.name] == nil {
+			used[g.name] = make([]bool, len(all))
+		}
+		for i, prop := range all {
+			if !used[g.name][i] && hasTypes(prop, g.types) {
+				props[g] = append(props[g], prop)
+				used[g.name][i] = true
+			}
+		}
+	}
+
+	for i := range m.Attributes {
+		am := &m.Attributes[i]
+		for _, prop := range props[am.group()] {
+			if value, ok := am.value(prop); ok && value != "" {
+				entry.Add(am.Attribute, value)
+			}
+		}
+	}
+
+	if values := entry.Get(m.RDN); len(values) > 0 {
+		entry.DN = m.RDN + "=" + escapeDN(values[0])
+		if base != "" {
+			entry.DN += "," + base
+		}
+	}
+	return entry
+}
+
+// value returns the value of the attribute for a property. The result ok is
+// false if the property cannot be given by the attribute.
+func (am *AttributeMapping) value(prop Property) (string, bool) {
+	switch {
+	case am.MediaType != "":
+		data, mediaType, err := prop.Data()
+		if err != nil || mediaType != "" && !strings.EqualFold(mediaType, am.MediaType) {
+			return "", false
+		}
+		return string(data), true
+	case am.Component >= 0:
+		return prop.component(am.Component), true
+	case strings.EqualFold(am.Property, "ADR"):
+		return formatPostalAddress(prop), true
+	}
+	value := prop.joined()
+	if lower := strings.ToLower(value); strings.HasPrefix(lower, "mailto:") || strings.HasPrefix(lower, "tel:") {
+		value = value[strings.IndexByte(value, ':')+1:]
+	}
+	return value, true
+}
+
+// Card returns a card containing the information in an LDAP entry. The card
+// has a VERSION of "4.0", and binary data is given as "data:" URIs. If the
+// entry has no attribute giving the FN property, it is formed from the
+// components of N (or, failing that, the organization name) so that the card
+// is valid.
+func (m *AttributeMap) Card(entry *LDIFEntry) *Card {
+	// Values of attributes giving whole values are separate occurrences,
+	// but the values of attributes giving components are combined with
+	// those of other components in the same position.
+	var groups []slot
+	occurrences := make(map[slot][]*Property)
+	components := make(map[slot][]*Property)
+	for i := range m.Attributes {
+		am := &m.Attributes[i]
+		g := am.group()
+		for j, value := range entry.Get(am.Attribute) {
+			if value == "" {
+				continue
+			}
+			if len(occurrences[g]) == 0 {
+				groups = append(groups, g)
+			}
+			prop := new(Property)
+			if am.Component < 0 {
+				occurrences[g] = append(occurrences[g], prop)
+			} else if j < len(components[g]) {
+				prop = components[g][j]
+			} else {
+				components[g] = append(components[g], prop)
+				occurrences[g] = append(occurrences[g], prop)
+			}
+			am.setValue(prop, value)
+		}
+	}
+
+	card := new(Card)
+	card.Add("VERSION", Property{components: [][]string{{"4.0"}}})
+	for _, g := range groups {
+		for _, prop := range occurrences[g] {
+			if n := len(componentNames[g.name]); len(prop.components) < n {
+				setComponent(prop, n-1, "")
+			}
+			for i := range prop.components {
+				if prop.components[i] == nil {
+					prop.components[i] = []string{""}
+				}
+			}
+			if g.types != "" {
+				prop.addParam("TYPE", strings.Split(g.types, ",")...)
+			}
+			card.Add(g.name, *prop)
+		}
+	}
+	if len(card.Get("FN")) == 0 {
+		card.setText("FN", formattedName(card))
+	}
+	return card
+}
+
+// setValue sets the part of a property given by the attribute.
+func (am *AttributeMapping) setValue(prop *Property, value string) {
+	switch {
+	case am.MediaType != "":
+		prop.SetData([]byte(value), am.MediaType, EncodingDataURI)
+	case am.Component >= 0:
+		setComponent(prop, am.Component, value)
+	case strings.EqualFold(am.Property, "ADR"):
+		parsePostalAddress(prop, value)
+	default:
+		prop.SetValues(value)
+	}
+}
+
+// formatPostalAddress returns the value of an ADR property as a postal
+// address (RFC 4517), in which lines are separated by "$". The LABEL
+// parameter is used if present.
+func formatPostalAddress(prop Property) string {
+	var lines []string
+	if label := prop.Param("LABEL"); len(label) > 0 {
+		lines = strings.Split(strings.Join(label, ","), "\n")
+	} else {
+		city := prop.component(3)
+		if rest := strings.TrimSpace(prop.component(4) + " " + prop.component(5)); city != "" && rest != "" {
+			city += ", " + rest
+		} else if rest != "" {
+			city = rest
+		}
+		for _, line := range []string{prop.component(1), prop.component(2), prop.component(0), city, prop.component(6)} {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.NewReplacer(`\`, `\5C`, "$", `\24`).Replace(line)
+	}
+	return strings.Join(lines, "$")
+}
+
+// parsePostalAddress sets an ADR property from a postal address. Since postal
+// addresses are unstructured, the components are only a guess: the last line
+// is taken to be the country (if there are at least three lines), and the
+// line before it the locality, region and postal code (in the form
+// "Springfield, IL 62701"). The full address is kept in the LABEL parameter.
+func parsePostalAddress(prop *Property, value string) {
+	lines := strings.Split(value, "$")
+	for i, line := range lines {
+		lines[i] = strings.NewReplacer(`\24`, "$", `\5C`, `\`, `\5c`, `\`).Replace(strings.TrimSpace(line))
+	}
+	label := strings.Join(lines, "\n")
+	var street, locality, region, code, country string
+	switch n := len(lines); {
+	case n == 1:
+		street = lines[0]
+	default:
+		if n >= 3 {
+			country = lines[n-1]
+			lines = lines[:n-1]
+		}
+		locality = lines[len(lines)-1]
+		street = strings.Join(lines[:len(lines)-1], ", ")
+		if comma := strings.LastIndex(locality, ", "); comma != -1 {
+			locality, region = locality[:comma], locality[comma+2:]
+			if space := strings.LastIndexByte(region, ' '); space != -1 && strings.IndexFunc(region[space+1:], func(r rune) bool { return '0' <= r && r <= '9' }) != -1 {
+				region, code = region[:space], region[space+1:]
+			}
+		}
+	}
+	prop.SetComponents([]string{""}, []string{""}, []string{street}, []string{locality}, []string{region}, []string{code}, []string{country})
+	prop.SetParam("LABEL", label)
+}
+
+// escapeDN escapes a value for use in a distinguished name (RFC 4514).
+func escapeDN(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) != -1,
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(value)-1 && c == ' ':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
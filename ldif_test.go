@@ -0,0 +1,166 @@
+package vcard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleLDIF = `version: 1
+
+# A comment,
+  folded
+dn: cn=Barbara Jensen,ou=Product Development,dc=example,dc=com
+objectClass: top
+objectClass: inetOrgPerson
+cn: Barbara Jensen
+sn: Jensen
+givenName: Barbara
+mail: bjensen@example.com
+mail: babs@example.org
+telephoneNumber: +1 408 555 1212
+mobile: +1 408 555 1213
+description: A long description which is folded over several lines, as is
+  permitted by LDIF.
+postalAddress: 1 Main St$Springfield, IL 62701$USA
+jpegPhoto:: /9j/4AAQ
+
+dn:: Y249R8O8bnRlcg==
+cn:: R8O8bnRlcg==
+`
+
+func TestParseLDIF(t *testing.T) {
+	entries, err := ParseAllLDIF(strings.NewReader(sampleLDIF))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %v entries, want 2", len(entries))
+	}
+	if dn := entries[0].DN; dn != "cn=Barbara Jensen,ou=Product Development,dc=example,dc=com" {
+		t.Errorf("got DN %q", dn)
+	}
+	if mail := entries[0].Get("MAIL"); !reflect.DeepEqual(mail, []string{"bjensen@example.com", "babs@example.org"}) {
+		t.Errorf("got mail %q", mail)
+	}
+	if desc := entries[0].Get("description"); len(desc) != 1 || desc[0] != "A long description which is folded over several lines, as is permitted by LDIF." {
+		t.Errorf("got description %q", desc)
+	}
+	if photo := entries[0].Get("jpegPhoto"); len(photo) != 1 || photo[0] != "\xff\xd8\xff\xe0\x00\x10" {
+		t.Errorf("got jpegPhoto %q", photo)
+	}
+	if entries[1].DN != "cn=Günter" || !reflect.DeepEqual(entries[1].Get("cn"), []string{"Günter"}) {
+		t.Errorf("got entry %+v", entries[1])
+	}
+}
+
+func TestParseLDIFFailure(t *testing.T) {
+	tests := []string{
+		"version: 2\n\ndn: cn=a\n",
+		"cn: a\n",
+		"dn: cn=a\nno colon\n",
+		"dn: cn=a\ncn:: !!!\n",
+		"dn: cn=a\njpegPhoto:< file:///photo.jpg\n",
+		"dn: cn=a\nchangetype: delete\n",
+	}
+
+	for _, test := range tests {
+		if entries, err := ParseAllLDIF(strings.NewReader(test)); err == nil {
+			t.Errorf("successfully parsed %q as %+v", test, entries)
+		}
+	}
+}
+
+func TestLDIFRoundTrip(t *testing.T) {
+	entries := []*LDIFEntry{
+		{DN: "cn=a,dc=example,dc=com", Attributes: []LDIFAttribute{
+			{"cn", "a"},
+			{"description", strings.Repeat("long ", 40)},
+			{"description", "two\nlines"},
+			{"description", ":colon"},
+			{"description", ""},
+		}},
+		{DN: "cn=Günter", Attributes: []LDIFAttribute{{"jpegPhoto", "\xff\xd8\xff\xe0"}}},
+	}
+	buf := new(bytes.Buffer)
+	enc := NewLDIFEncoder(buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) > ldifWidth {
+			t.Errorf("line too long: %q", line)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "version: 1\n\ndn: cn=a,dc=example,dc=com\ncn: a\n") {
+		t.Errorf("unexpected output %q", buf)
+	}
+
+	parsed, err := ParseAllLDIF(buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("got %+v, want %+v", parsed, entries)
+	}
+}
+
+func TestCardFromLDIF(t *testing.T) {
+	entries, err := ParseAllLDIF(strings.NewReader(sampleLDIF))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	card := InetOrgPerson.Card(entries[0])
+	want := "BEGIN:VCARD\nVERSION:4.0\nFN:Barbara Jensen\nN:Jensen;Barbara;;;\n" +
+		"EMAIL:bjensen@example.com\nEMAIL:babs@example.org\nTEL:+1 408 555 1212\nTEL;TYPE=cell:+1 408 555 1213\n" +
+		"ADR;LABEL=\"1 Main St^nSpringfield, IL 62701^nUSA\":;;1 Main St;Springfield;IL;62701;USA\n" +
+		"NOTE:A long description which is folded over several lines\\, as is permitted by LDIF.\n" +
+		"PHOTO:data:image/jpeg;base64," + base64.StdEncoding.EncodeToString([]byte("\xff\xd8\xff\xe0\x00\x10")) + "\nEND:VCARD\n"
+	if got := card.UnfoldedString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if fn := InetOrgPerson.Card(&LDIFEntry{Attributes: []LDIFAttribute{{"sn", "Doe"}, {"givenName", "John"}}}).FormattedName(); fn != "John Doe" {
+		t.Errorf("got FN %q, want %q", fn, "John Doe")
+	}
+}
+
+func TestLDIFFromCard(t *testing.T) {
+	card := parseCard(t, "BEGIN:VCARD\nVERSION:3.0\nFN:Doe\\, John\nN:Doe;John;;;\nORG:ABC;Sales\n"+
+		"EMAIL;TYPE=internet:mailto:john@example.com\nTEL;TYPE=work,voice:+1-555-0100\nTEL;TYPE=cell:+1-555-0101\n"+
+		"TEL;TYPE=home,fax:+1-555-0102\nADR;TYPE=home:;;2 Elm St;Shelbyville;;;\n"+
+		"PHOTO;ENCODING=b;TYPE=JPEG:/9j/4AAQ\nLOGO;ENCODING=b;TYPE=PNG:iVBORw0K\nEND:VCARD")
+	entry := InetOrgPerson.Entry(card, "ou=people,dc=example,dc=com")
+	want := &LDIFEntry{
+		DN: `cn=Doe\, John,ou=people,dc=example,dc=com`,
+		Attributes: []LDIFAttribute{
+			{"objectClass", "top"},
+			{"objectClass", "person"},
+			{"objectClass", "organizationalPerson"},
+			{"objectClass", "inetOrgPerson"},
+			{"cn", "Doe, John"},
+			{"sn", "Doe"},
+			{"givenName", "John"},
+			{"o", "ABC"},
+			{"ou", "Sales"},
+			{"mail", "john@example.com"},
+			{"telephoneNumber", "+1-555-0100"},
+			{"facsimileTelephoneNumber", "+1-555-0102"},
+			{"mobile", "+1-555-0101"},
+			{"homePostalAddress", "2 Elm St$Shelbyville"},
+			{"jpegPhoto", "\xff\xd8\xff\xe0\x00\x10"},
+		},
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Errorf("got %+v, want %+v", entry, want)
+	}
+
+	png := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nFN:x\nPHOTO:data:image/png;base64,iVBORw0K\nEND:VCARD")
+	if photo := InetOrgPerson.Entry(png, "").Get("jpegPhoto"); len(photo) != 0 {
+		t.Errorf("got jpegPhoto %q for PNG photo", photo)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import "io"
+
+// SetLenient sets whether the parser should try to recover from malformed
+// input rather than failing. In this mode, the parser:
+//
+//   - skips blank lines and any other text between cards;
+//   - skips properties which cannot be parsed;
+//   - keeps invalid escape sequences (such as "\t") as they are;
+//   - accepts a malformed end tag (such as "END:VCALENDAR") as the end of a
+//     card;
+//   - treats the beginning of a card or the end of the input before the end
+//     of the current card as if the current card had ended.
+//
+// Each problem that is recovered from is recorded, and can be retrieved
+// using Diagnostics. Errors from the underlying reader are still returned
+// from Next.
+func (p *Parser) SetLenient(lenient bool) {
+	p.lenient = lenient
+}
+
+// Diagnostics returns the problems which a lenient parser has recovered from
+// so far, in the order they were encountered.
+func (p *Parser) Diagnostics() []ParseError {
+	return p.diagnostics
+}
+
+// warn records a problem which was recovered from.
+func (p *Parser) warn(err ParseError) {
+	p.diagnostics = append(p.diagnostics, err)
+}
+
+// skipInvalid attempts to recover from an error which occurred while parsing
+// a line beginning at the given unfolded offset, by recording it and skipping
+// the rest of the line. If the parser is not lenient or the error cannot be
+// recovered from, the error is returned.
+func (p *Parser) skipInvalid(err error, start int) error {
+	perr, ok := err.(ParseError)
+	if !ok || !p.lenient {
+		return err
+	}
+	p.warn(perr)
+
+	// If the error occurred on the newline at the end of the line, we don't
+	// want to skip the following line as well.
+	if p.r.unfoldedOffset != start && p.r.last == '\n' {
+		return nil
+	}
+	b, err := p.r.ReadByte()
+	for err == nil && b != '\n' {
+		b, err = p.r.ReadByte()
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package vcard
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLenient(t *testing.T) {
+	const in = "Some stray text\r\n" +
+		"\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"FN:First\r\n" +
+		"\r\n" +
+		"NOTE:tab\\there\r\n" +
+		"BAD LINE\r\n" +
+		"X-PARAM;P=\"unterminated\r\n" +
+		"EMAIL:first@example.com\\\r\n" +
+		"end:vcard\r\n" +
+		"STRAY:text\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"FN:Second\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"FN:Third\r\n" +
+		"END:VCALENDAR\r\n" +
+		"BEGIN:VCARD\r\n" +
+		"FN:Fourth\r\n"
+
+	expected := []string{
+		"BEGIN:VCARD\nFN:First\nNOTE:tab\\\\there\nEMAIL:first@example.com\\\\\nEND:VCARD\n",
+		"BEGIN:VCARD\nFN:Second\nEND:VCARD\n",
+		"BEGIN:VCARD\nFN:Third\nEND:VCARD\n",
+		"BEGIN:VCARD\nFN:Fourth\nEND:VCARD\n",
+	}
+	diagnostics := []struct {
+		line int
+		msg  string
+	}{
+		{1, "expected ':'"},
+		{6, "'t' cannot be escaped"},
+		{7, "expected ':'"},
+		{8, "unexpected byte '\\n' in quoted parameter value"},
+		{9, "expected escaped character"},
+		{11, "expected beginning of card"},
+		{14, "unexpected beginning of card"},
+		{16, "malformed end tag"},
+		{19, "unexpected end of input"},
+	}
+
+	p := NewParser(strings.NewReader(in))
+	p.SetLenient(true)
+	for i, exp := range expected {
+		card, err := p.Next()
+		if err != nil {
+			t.Fatalf("card %v: unexpected error: %v", i, err)
+		}
+		if out := card.UnfoldedString(); out != exp {
+			t.Errorf("card %v: got %q, want %q", i, out, exp)
+		}
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("got error %v at end of input, want EOF", err)
+	}
+
+	diags := p.Diagnostics()
+	if len(diags) != len(diagnostics) {
+		t.Fatalf("got diagnostics %q, want %v", diags, len(diagnostics))
+	}
+	for i, diag := range diagnostics {
+		if diags[i].Line != diag.line || !strings.Contains(diags[i].Message(), diag.msg) {
+			t.Errorf("diagnostic %v is %q, want %q on line %v", i, diags[i], diag.msg, diag.line)
+		}
+	}
+}
+
+func TestLenientStrictUnchanged(t *testing.T) {
+	for _, test := range failureTests {
+		p := NewParser(strings.NewReader(test.in))
+		p.SetLenient(false)
+		if _, err := p.Next(); err == nil {
+			t.Errorf("successfully parsed %q with lenient parsing disabled", test.in)
+		}
+	}
+}
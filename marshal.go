@@ -0,0 +1,357 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// componentNames maps the names of structured properties to the names of
+// their components, which may be used in struct tags instead of indexes.
+var componentNames = map[string][]string{
+	"N":      {"family", "given", "additional", "prefix", "suffix"},
+	"ADR":    {"pobox", "extended", "street", "locality", "region", "code", "country"},
+	"GENDER": {"sex", "identity"},
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	dateType       = reflect.TypeOf(Date{})
+	propertyType   = reflect.TypeOf(Property{})
+	propertiesType = reflect.TypeOf([]Property(nil))
+)
+
+// field describes how a struct field is mapped to a property, according to
+// its struct tag.
+type field struct {
+	index     int      // the index of the field in the struct
+	name      string   // the name of the property
+	component int      // the index of the component, or -1 for the whole value
+	types     []string // the values of the TYPE parameter to match or set
+}
+
+// parseFields parses the vcard struct tags of the fields of a struct type.
+// Fields without a tag (or with the tag "-") are ignored.
+func parseFields(t reflect.Type) ([]field, error) {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("vcard")
+		if !ok || tag == "-" || t.Field(i).PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := field{index: i, component: -1}
+		f.name = strings.ToUpper(parts[0])
+		if dot := strings.IndexByte(f.name, '.'); dot != -1 {
+			component := strings.ToLower(f.name[dot+1:])
+			f.name = f.name[:dot]
+			f.component = -1
+			for j, name := range componentNames[f.name] {
+				if name == component {
+					f.component = j
+				}
+			}
+			if n, err := strconv.Atoi(component); err == nil && n >= 0 {
+				f.component = n
+			}
+			if f.component == -1 {
+				return nil, fmt.Errorf("vcard: unknown component %q of %v in tag of field %v", component, f.name, t.Field(i).Name)
+			}
+		}
+		if f.name == "" {
+			return nil, fmt.Errorf("vcard: missing property name in tag of field %v", t.Field(i).Name)
+		}
+		for _, option := range parts[1:] {
+			if strings.HasPrefix(option, "type=") {
+				f.types = append(f.types, option[len("type="):])
+			} else {
+				return nil, fmt.Errorf("vcard: unknown option %q in tag of field %v", option, t.Field(i).Name)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// matches returns whether a property has all the types required by the field.
+func (f field) matches(prop Property) bool {
+	types := prop.types()
+	if prop.pref() == 1 && len(prop.Param("PREF")) == 0 {
+		types = append(types, "pref")
+	}
+	for _, t := range f.types {
+		found := false
+		for _, u := range types {
+			found = found || strings.EqualFold(t, u)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Unmarshal stores the properties of a card in the struct pointed to by v,
+// according to the vcard struct tags of its fields, in a similar way to
+// json.Unmarshal. Only exported fields with a tag are used. The tag gives the
+// name of the property, optionally followed by a dot and the name or index of
+// a component (such as "N.family", "ADR.street" or "ORG.1"), and then by
+// options separated by commas. The only option is "type=t", which restricts
+// the field to occurrences of the property whose TYPE parameter includes t.
+// For example:
+//
+//	type Contact struct {
+//		Name      string   `vcard:"FN"`
+//		Family    string   `vcard:"N.family"`
+//		WorkEmail string   `vcard:"EMAIL,type=work"`
+//		Phones    []string `vcard:"TEL"`
+//		Birthday  Date     `vcard:"BDAY"`
+//	}
+//
+// Fields may have the types string, bool, any integer or floating-point type,
+// time.Time, Date or Property, in which case they are set from the first
+// matching occurrence of the property, or slices of any of these types, in
+// which case they are set from all the matching occurrences. A string is set
+// to the values of the first component (or the given component) joined by
+// commas, while the other types are parsed from the value using the
+// corresponding method of Property (such as Integer or PartialDate). Fields
+// for properties which are not present in the card are left unchanged.
+//
+// Since Marshal writes a string as a single value, a string field does not
+// preserve a property with several values: "CATEGORIES:a,b" is unmarshalled
+// as "a,b", which is marshalled as "CATEGORIES:a\,b". A Property field
+// preserves the value exactly.
+func Unmarshal(card *Card, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("vcard: Unmarshal requires a non-nil pointer to a struct")
+	}
+	rv = rv.Elem()
+	fields, err := parseFields(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		var props []Property
+		for _, prop := range card.Get(f.name) {
+			if f.matches(prop) {
+				props = append(props, prop)
+			}
+		}
+		if len(props) == 0 {
+			continue
+		}
+
+		fv := rv.Field(f.index)
+		if fv.Kind() == reflect.Slice && fv.Type() != propertiesType {
+			slice := reflect.MakeSlice(fv.Type(), len(props), len(props))
+			for i, prop := range props {
+				if err := f.unmarshal(prop, slice.Index(i)); err != nil {
+					return fmt.Errorf("vcard: field %v: %w", rv.Type().Field(f.index).Name, err)
+				}
+			}
+			fv.Set(slice)
+		} else if fv.Type() == propertiesType {
+			fv.Set(reflect.ValueOf(append([]Property(nil), props...)))
+		} else if err := f.unmarshal(props[0], fv); err != nil {
+			return fmt.Errorf("vcard: field %v: %w", rv.Type().Field(f.index).Name, err)
+		}
+	}
+	return nil
+}
+
+// unmarshal stores the value of a property in a (non-slice) field value.
+func (f field) unmarshal(prop Property, v reflect.Value) error {
+	if v.Type() == propertyType {
+		v.Set(reflect.ValueOf(prop.clone()))
+		return nil
+	}
+	if f.component != -1 {
+		// The typed getters only look at the first component.
+		var values []string
+		if f.component < len(prop.components) {
+			values = prop.components[f.component]
+		}
+		prop.components = [][]string{values}
+	}
+
+	switch {
+	case v.Type() == timeType:
+		t, err := prop.Time()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.Type() == dateType:
+		d, err := prop.PartialDate()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(d))
+	case v.Kind() == reflect.String:
+		v.SetString(prop.text())
+	case v.Kind() == reflect.Bool:
+		b, err := prop.Boolean()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		i, err := prop.Integer()
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return ValueError{"integer", prop.text()}
+		}
+		v.SetInt(i)
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		i, err := prop.Integer()
+		if err != nil {
+			return err
+		}
+		if i < 0 || v.OverflowUint(uint64(i)) {
+			return ValueError{"integer", prop.text()}
+		}
+		v.SetUint(uint64(i))
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		x, err := prop.Float()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// Marshal returns a new card containing the fields of v, which must be a
+// struct or a pointer to a struct, according to their vcard struct tags (as
+// described for Unmarshal). Each field with a value other than the zero value
+// of its type is added as a property, or an occurrence of a property for each
+// element of a slice, in the order of the fields. Fields which refer to
+// different components of the same property (such as "N.family" and
+// "N.given") are combined into a single property, with any components which
+// are not given left empty. Properties with a "type=" option in their tag have
+// the TYPE parameter set accordingly. If there is no VERSION field, the
+// VERSION of the card is 4.0. A string is written as a single value, so any
+// commas in it are escaped, as described for Unmarshal.
+func Marshal(v interface{}) (*Card, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("vcard: Marshal requires a struct or a pointer to a struct")
+	}
+	fields, err := parseFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	card := new(Card)
+	card.setText("VERSION", "4.0")
+	// built maps each property name and TYPE combination to the
+	// occurrences added for it, so that fields for different components
+	// can be combined.
+	built := make(map[string][]int)
+	for _, f := range fields {
+		fv := rv.Field(f.index)
+		if fv.IsZero() {
+			continue
+		}
+		var values []reflect.Value
+		if fv.Kind() == reflect.Slice {
+			for i := 0; i < fv.Len(); i++ {
+				values = append(values, fv.Index(i))
+			}
+		} else {
+			values = []reflect.Value{fv}
+		}
+
+		key := f.name + ";" + strings.ToLower(strings.Join(f.types, ","))
+		for i, value := range values {
+			prop, err := f.marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("vcard: field %v: %w", rv.Type().Field(f.index).Name, err)
+			}
+			if f.name == "VERSION" {
+				card.replace("VERSION", []Property{prop})
+				continue
+			}
+			if f.component != -1 && i < len(built[key]) {
+				// Add the component to the existing property.
+				existing := &card.m[f.name][built[key][i]]
+				for len(existing.components) <= f.component {
+					existing.components = append(existing.components, []string{""})
+				}
+				existing.components[f.component] = prop.components[f.component]
+				continue
+			}
+			if len(f.types) > 0 {
+				prop.SetParam("TYPE", f.types...)
+			}
+			card.Add(f.name, prop)
+			built[key] = append(built[key], len(card.m[f.name])-1)
+		}
+	}
+	return card, nil
+}
+
+// marshal returns a property with the given (non-slice) field value. If the
+// field is for a particular component, the property has that component, and
+// the other components (up to the number of named components of the
+// property, if known) are empty.
+func (f field) marshal(v reflect.Value) (Property, error) {
+	var prop Property
+	switch {
+	case v.Type() == propertyType:
+		return v.Interface().(Property).clone(), nil
+	case v.Type() == timeType:
+		t := v.Interface().(time.Time)
+		if t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())) {
+			prop.SetDate(t)
+		} else {
+			prop.SetTime(t)
+		}
+	case v.Type() == dateType:
+		prop.SetPartialDate(v.Interface().(Date))
+	case v.Kind() == reflect.String:
+		prop.SetValues(v.String())
+	case v.Kind() == reflect.Bool:
+		prop.SetBoolean(v.Bool())
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		prop.SetInteger(v.Int())
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uintptr:
+		prop.SetValues(strconv.FormatUint(v.Uint(), 10))
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		prop.SetFloat(v.Float())
+	default:
+		return Property{}, fmt.Errorf("unsupported type %v", v.Type())
+	}
+	if f.component != -1 {
+		n := f.component + 1
+		if len(componentNames[f.name]) > n {
+			n = len(componentNames[f.name])
+		}
+		components := make([][]string, n)
+		for i := range components {
+			components[i] = []string{""}
+		}
+		components[f.component] = prop.components[0]
+		prop.components = components
+	}
+	return prop, nil
+}
@@ -0,0 +1,154 @@
+package vcard
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type contact struct {
+	Name       string    `vcard:"FN"`
+	Family     string    `vcard:"N.family"`
+	Given      string    `vcard:"N.given"`
+	WorkEmail  string    `vcard:"EMAIL,type=work"`
+	Emails     []string  `vcard:"EMAIL"`
+	Cell       string    `vcard:"TEL,type=cell"`
+	Street     string    `vcard:"ADR.street"`
+	Unit       string    `vcard:"ORG.1"`
+	Birthday   Date      `vcard:"BDAY"`
+	Revision   time.Time `vcard:"REV"`
+	Age        int       `vcard:"X-AGE"`
+	Score      float64   `vcard:"X-SCORE"`
+	VIP        bool      `vcard:"X-VIP"`
+	Photo      Property  `vcard:"PHOTO"`
+	Ignored    string
+	unexported string `vcard:"NOTE"`
+}
+
+const contactVCard = "BEGIN:VCARD\n" +
+	"VERSION:4.0\n" +
+	"FN:John Doe\n" +
+	"N:Doe;John;;;\n" +
+	"EMAIL;TYPE=work:john@example.com\n" +
+	"EMAIL:jd@example.org\n" +
+	"TEL;TYPE=cell:+1-555-555-0100\n" +
+	"ADR:;;1 Main St;;;;\n" +
+	"ORG:Example;Sales\n" +
+	"BDAY:--0415\n" +
+	"REV:19961022T140000Z\n" +
+	"X-AGE:42\n" +
+	"X-SCORE:1.5\n" +
+	"X-VIP:TRUE\n" +
+	"PHOTO:http://example.com/photo.jpg\n" +
+	"NOTE:not used\n" +
+	"END:VCARD\n"
+
+func TestUnmarshal(t *testing.T) {
+	card := parseCard(t, contactVCard)
+	var c contact
+	if err := Unmarshal(card, &c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var photo Property
+	photo.SetValues("http://example.com/photo.jpg")
+	want := contact{
+		Name:      "John Doe",
+		Family:    "Doe",
+		Given:     "John",
+		WorkEmail: "john@example.com",
+		Emails:    []string{"john@example.com", "jd@example.org"},
+		Cell:      "+1-555-555-0100",
+		Street:    "1 Main St",
+		Unit:      "Sales",
+		Birthday:  Date{Month: 4, Day: 15},
+		Revision:  time.Date(1996, 10, 22, 14, 0, 0, 0, time.UTC),
+		Age:       42,
+		Score:     1.5,
+		VIP:       true,
+		Photo:     photo,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	var c contact
+	if err := Unmarshal(parseCard(t, contactVCard), &c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Unit = ""
+	c.Emails = c.Emails[1:]
+	card, err := Marshal(&c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "BEGIN:VCARD\n" +
+		"VERSION:4.0\n" +
+		"FN:John Doe\n" +
+		"N:Doe;John;;;\n" +
+		"EMAIL;TYPE=work:john@example.com\n" +
+		"EMAIL:jd@example.org\n" +
+		"TEL;TYPE=cell:+1-555-555-0100\n" +
+		"ADR:;;1 Main St;;;;\n" +
+		"BDAY:--0415\n" +
+		"REV:19961022T140000Z\n" +
+		"X-AGE:42\n" +
+		"X-SCORE:1.5\n" +
+		"X-VIP:TRUE\n" +
+		"PHOTO:http://example.com/photo.jpg\n" +
+		"END:VCARD\n"
+	if got := card.UnfoldedString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMarshalMultipleValues(t *testing.T) {
+	// A string holds the values joined by commas, but is written back as
+	// a single value; a Property is written back unchanged.
+	var v struct {
+		Categories string   `vcard:"CATEGORIES"`
+		Nickname   Property `vcard:"NICKNAME"`
+	}
+	in := parseCard(t, "BEGIN:VCARD\nVERSION:4.0\nCATEGORIES:a,b\nNICKNAME:c,d\nEND:VCARD\n")
+	if err := Unmarshal(in, &v); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Categories != "a,b" {
+		t.Errorf("got CATEGORIES %q, want %q", v.Categories, "a,b")
+	}
+	card, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const want = "BEGIN:VCARD\nVERSION:4.0\nCATEGORIES:a\\,b\nNICKNAME:c,d\nEND:VCARD\n"
+	if out := card.UnfoldedString(); out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestUnmarshalFailure(t *testing.T) {
+	card := parseCard(t, "BEGIN:VCARD\nX-AGE:old\nEND:VCARD")
+	var c contact
+	if err := Unmarshal(card, &c); err == nil {
+		t.Error("expected error for invalid integer")
+	}
+	if err := Unmarshal(card, c); err == nil {
+		t.Error("expected error for non-pointer")
+	}
+	var bad struct {
+		Name string `vcard:"N.middle"`
+	}
+	if err := Unmarshal(card, &bad); err == nil {
+		t.Error("expected error for unknown component")
+	}
+	var unsupported struct {
+		Age map[string]int `vcard:"X-AGE"`
+	}
+	if err := Unmarshal(card, &unsupported); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+	if _, err := Marshal(42); err == nil {
+		t.Error("expected error marshalling non-struct")
+	}
+}
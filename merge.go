@@ -0,0 +1,388 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// singular contains the names of the properties which may appear at most
+// once in some version of the vCard specification. When merging cards, these
+// are taken from a single card rather than combined.
+var singular = make(map[string]bool)
+
+func init() {
+	for _, rules := range cardinalities {
+		for _, name := range rules.atMostOnce {
+			singular[name] = true
+		}
+	}
+}
+
+// normalizers maps property names to functions which normalize their values
+// for comparison, so that duplicates written in different ways can be
+// detected.
+var normalizers = map[string]func(string) string{
+	"EMAIL": normalizeEmail,
+	"TEL":   normalizePhone,
+}
+
+// Merge merges several cards representing the same object into a single new
+// card, leaving the original cards unchanged. The cards are considered from
+// newest to oldest, according to their REV properties (cards without a valid
+// REV are considered oldest, in the order given).
+//
+// Properties which may only appear once (such as FN, N, BDAY, UID and REV)
+// are taken from the newest card which has them, along with the VERSION. All
+// other properties are combined, except that duplicate values are only kept
+// once, with the union of their TYPE parameters. Values are compared exactly,
+// except for EMAIL, where case and any "mailto:" prefix are ignored, and TEL,
+// where only the digits of the number are compared.
+//
+// The cards should all use the same version of the vCard specification; use
+// Convert first if they do not.
+func Merge(cards ...*Card) *Card {
+	cards = sortByRev(cards)
+	merged := new(Card)
+	from := make(map[string]int) // the card each singular property was taken from
+	for i, card := range cards {
+		card.walk(func(name string, prop Property) error {
+			if singular[name] {
+				if j, ok := from[name]; !ok || j == i {
+					from[name] = i
+					merged.Add(name, prop.clone())
+				}
+				return nil
+			}
+			if j := merged.duplicate(name, prop); j != -1 {
+				dup := &merged.m[name][j]
+				if types := unionTypes(dup.Param("TYPE"), prop.Param("TYPE")); len(types) > 0 {
+					dup.SetParam("TYPE", types...)
+				}
+				return nil
+			}
+			merged.Add(name, prop.clone())
+			return nil
+		})
+	}
+	return merged
+}
+
+// sortByRev returns the given cards sorted from newest to oldest by their REV
+// properties. Cards without a valid REV come last, in their original order.
+func sortByRev(cards []*Card) []*Card {
+	revs := make(map[*Card]time.Time, len(cards))
+	for _, card := range cards {
+		if props := card.Get("REV"); len(props) > 0 {
+			if rev, err := props[0].Time(); err == nil {
+				revs[card] = rev
+			}
+		}
+	}
+	sorted := append([]*Card(nil), cards...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, oki := revs[sorted[i]]
+		rj, okj := revs[sorted[j]]
+		return oki && (!okj || ri.After(rj))
+	})
+	return sorted
+}
+
+// duplicate returns the index of an occurrence of the given property in the
+// card whose value duplicates that of prop, or -1 if there is none.
+func (c *Card) duplicate(name string, prop Property) int {
+	normalize := normalizers[name]
+	for i, other := range c.Get(name) {
+		if normalize != nil {
+			if normalize(other.joined()) == normalize(prop.joined()) {
+				return i
+			}
+			continue
+		}
+		if len(other.components) != len(prop.components) {
+			continue
+		}
+		same := true
+		for j := range other.components {
+			same = same && equalStrings(other.components[j], prop.components[j])
+		}
+		if same {
+			return i
+		}
+	}
+	return -1
+}
+
+// unionTypes returns the union of two lists of TYPE parameter values,
+// compared case-insensitively, in the order they first appear.
+func unionTypes(a, b []string) []string {
+	var types []string
+	seen := make(map[string]bool)
+	for _, value := range append(a[:len(a):len(a)], b...) {
+		for _, t := range strings.Split(value, ",") {
+			if key := strings.ToLower(t); t != "" && !seen[key] {
+				seen[key] = true
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// normalizeEmail normalizes an email address by removing any "mailto:" prefix
+// and converting it to lowercase.
+func normalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	return strings.TrimPrefix(email, "mailto:")
+}
+
+// normalizePhone normalizes a telephone number (which may be a "tel:" URI) by
+// removing everything except the digits.
+func normalizePhone(tel string) string {
+	return strings.Map(func(r rune) rune {
+		if '0' <= r && r <= '9' {
+			return r
+		}
+		return -1
+	}, tel)
+}
+
+// FindDuplicates groups cards which probably represent the same object. Two
+// cards are considered duplicates if they have the same UID, share an email
+// address or telephone number (normalized as described for Merge, where a
+// number of at least seven digits also matches a longer number ending with
+// it, to allow for country codes), or have formatted names (FN) which differ
+// only in case, punctuation, the order of words or (for names of at least
+// five bytes) a single typing error.
+// Duplicates of duplicates are in the same group.
+//
+// Each group contains at least two cards, in their original order, and the
+// groups are ordered by their first cards. Cards without duplicates are not
+// included.
+func FindDuplicates(cards []*Card) [][]*Card {
+	parent := make([]int, len(cards))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(i, j int) {
+		if i, j = find(i), find(j); i != j {
+			if j < i {
+				i, j = j, i
+			}
+			parent[j] = i
+		}
+	}
+
+	// Cards with the same key of some kind are duplicates.
+	keys := make(map[string]int)
+	link := func(i int, key string) {
+		if j, ok := keys[key]; ok {
+			union(i, j)
+		} else {
+			keys[key] = i
+		}
+	}
+	names := make([]string, len(cards))
+	var phones []phoneOf
+	for i, card := range cards {
+		if uid := card.UID(); uid != "" {
+			link(i, "UID:"+uid)
+		}
+		for _, prop := range card.Get("EMAIL") {
+			if email := normalizeEmail(prop.joined()); email != "" {
+				link(i, "EMAIL:"+email)
+			}
+		}
+		for _, prop := range card.Get("TEL") {
+			if tel := normalizePhone(prop.joined()); len(tel) >= minPhoneDigits {
+				phones = append(phones, phoneOf{tel: tel, card: i})
+			}
+		}
+		if names[i] = normalizeName(card.FormattedName()); names[i] != "" {
+			link(i, "FN:"+names[i])
+		}
+	}
+
+	// Numbers are sorted by their reversed digits, so that the numbers
+	// ending with a number come immediately after it.
+	for k := range phones {
+		phones[k].reversed = reverse(phones[k].tel)
+	}
+	sort.Slice(phones, func(i, j int) bool {
+		return phones[i].reversed < phones[j].reversed
+	})
+	for k := range phones {
+		for l := k + 1; l < len(phones) && strings.HasPrefix(phones[l].reversed, phones[k].reversed); l++ {
+			union(phones[k].card, phones[l].card)
+		}
+	}
+
+	// Comparing every pair of names is expensive, so only names which
+	// share a key are compared. Two names within one typing error of each
+	// other share a key made by deleting a rune from either or both of
+	// them (see typoKeys).
+	byKey := make(map[string][]int)
+	for i, name := range names {
+		if len(name) >= minFuzzyName {
+			for _, key := range typoKeys(name) {
+				byKey[key] = append(byKey[key], i)
+			}
+		}
+	}
+	for _, indexes := range byKey {
+		for a := range indexes {
+			for b := a + 1; b < len(indexes); b++ {
+				i, j := indexes[a], indexes[b]
+				if find(i) != find(j) && namesWithinOneEdit(names[i], names[j]) {
+					union(i, j)
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]*Card)
+	var roots []int
+	for i, card := range cards {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], card)
+	}
+	var result [][]*Card
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			result = append(result, groups[root])
+		}
+	}
+	return result
+}
+
+// minPhoneDigits is the minimum number of digits in a telephone number for it
+// to be used to find duplicates.
+const minPhoneDigits = 7
+
+// minFuzzyName is the minimum length of a normalized name for it to be
+// matched with names which differ by a single typing error.
+const minFuzzyName = 5
+
+// phoneOf is a normalized telephone number belonging to a card.
+type phoneOf struct {
+	tel      string
+	reversed string // tel with its digits reversed
+	card     int    // the index of the card
+}
+
+// reverse returns a string with its bytes in reverse order.
+func reverse(s string) string {
+	bs := []byte(s)
+	for i, j := 0, len(bs)-1; i < j; i, j = i+1, j-1 {
+		bs[i], bs[j] = bs[j], bs[i]
+	}
+	return string(bs)
+}
+
+// normalizeName normalizes a formatted name for comparison by converting it to
+// lowercase, removing punctuation and sorting its words.
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// typoKeys returns the keys used to find names (normalized by normalizeName)
+// which may differ by a single typing error: the name itself, and the name
+// with each of its runes deleted in turn (with the words sorted again, since
+// deleting the first rune of a word may change its position).
+func typoKeys(name string) []string {
+	words := strings.Fields(name)
+	keys := []string{name}
+	variant := make([]string, len(words))
+	for w, word := range words {
+		for i := range word {
+			_, size := utf8.DecodeRuneInString(word[i:])
+			copy(variant, words)
+			variant[w] = word[:i] + word[i+size:]
+			sorted := variant[:0:0]
+			for _, v := range variant {
+				if v != "" {
+					sorted = append(sorted, v)
+				}
+			}
+			sort.Strings(sorted)
+			keys = append(keys, strings.Join(sorted, " "))
+		}
+	}
+	return keys
+}
+
+// namesWithinOneEdit returns whether two names (normalized by normalizeName)
+// differ by at most one typing error, regardless of the order of their words.
+func namesWithinOneEdit(a, b string) bool {
+	// Remove the words which the names have in common.
+	counts := make(map[string]int)
+	for _, word := range strings.Fields(a) {
+		counts[word]++
+	}
+	var onlyB []string
+	for _, word := range strings.Fields(b) {
+		if counts[word] > 0 {
+			counts[word]--
+		} else {
+			onlyB = append(onlyB, word)
+		}
+	}
+	var onlyA []string
+	for word, n := range counts {
+		for ; n > 0; n-- {
+			onlyA = append(onlyA, word)
+		}
+	}
+	switch {
+	case len(onlyA) == 0 && len(onlyB) == 0:
+		return true
+	case len(onlyA) == 1 && len(onlyB) == 1:
+		return withinOneEdit(onlyA[0], onlyB[0])
+	}
+	return false
+}
+
+// withinOneEdit returns whether two strings differ by at most one inserted,
+// deleted or substituted rune.
+func withinOneEdit(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) > len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(rb)-len(ra) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(ra) && ra[i] == rb[i] {
+		i++
+	}
+	if len(ra) == len(rb) {
+		// Substitution of the rune at i.
+		return i >= len(ra)-1 || string(ra[i+1:]) == string(rb[i+1:])
+	}
+	// Insertion of the rune at i in the longer string.
+	return string(ra[i:]) == string(rb[i+1:])
+}
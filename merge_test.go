@@ -0,0 +1,92 @@
+package vcard
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	google := parseCard(t, "BEGIN:VCARD\nVERSION:3.0\nFN:John Doe\nN:Doe;John;;;\nEMAIL;TYPE=work:John.Doe@Example.com\nTEL;TYPE=cell:+1 (555) 555-0100\nURL:http://example.com\nREV:2018-01-01T00:00:00Z\nEND:VCARD")
+	icloud := parseCard(t, "BEGIN:VCARD\nVERSION:3.0\nFN:John Q. Doe\nN:Doe;John;Q.;;\nEMAIL;TYPE=home:mailto:john.doe@example.com\nEMAIL:jd@example.org\nTEL;TYPE=voice:+1-555-555-0100\nURL:http://example.com\nNOTE:from iCloud\nREV:2018-06-01T00:00:00Z\nEND:VCARD")
+	phone := parseCard(t, "BEGIN:VCARD\nVERSION:3.0\nFN:Johnny\nTEL:555-0199\nEND:VCARD")
+
+	merged := Merge(google, phone, icloud)
+	want := "BEGIN:VCARD\nVERSION:3.0\nFN:John Q. Doe\nN:Doe;John;Q.;;\nEMAIL;TYPE=home,work:mailto:john.doe@example.com\nEMAIL:jd@example.org\nTEL;TYPE=voice,cell:+1-555-555-0100\nURL:http://example.com\nNOTE:from iCloud\nREV:2018-06-01T00:00:00Z\nTEL:555-0199\nEND:VCARD\n"
+	if got := merged.UnfoldedString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := google.Get("EMAIL")[0].Param("TYPE"); len(got) != 1 {
+		t.Errorf("original card modified: got TYPE %q", got)
+	}
+}
+
+func TestMergeWithoutRev(t *testing.T) {
+	a := parseCard(t, "BEGIN:VCARD\nFN:A\nNOTE:a\nEND:VCARD")
+	b := parseCard(t, "BEGIN:VCARD\nFN:B\nNOTE:b\nEND:VCARD")
+	want := "BEGIN:VCARD\nFN:A\nNOTE:a\nNOTE:b\nEND:VCARD\n"
+	if got := Merge(a, b).UnfoldedString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	cards := []*Card{
+		parseCard(t, "BEGIN:VCARD\nFN:John Doe\nEMAIL:john@example.com\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Jane Roe\nTEL:+1 555 555 0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:J. Doe\nEMAIL:mailto:JOHN@example.com\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Someone Else\nUID:urn:uuid:1\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Roe, Jane\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Another Person\nUID:urn:uuid:1\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:J. Smith\nTEL;VALUE=uri:tel:555-555-0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Jon Doe\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Ann Lee\nTEL:0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Ben Lee\nTEL:0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Bo\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Bob\nEND:VCARD"),
+	}
+	checkDuplicates(t, cards, [][]int{{0, 2, 7}, {1, 4, 6}, {3, 5}})
+}
+
+func TestFindDuplicatesPhoneSuffix(t *testing.T) {
+	cards := []*Card{
+		parseCard(t, "BEGIN:VCARD\nFN:A\nTEL:555-0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:B\nTEL:1-555-0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:C\nTEL:9-555-0100\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:D\nTEL:2-555-0199\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:E\nTEL:+44 20 555 0199\nEND:VCARD"),
+	}
+	checkDuplicates(t, cards, [][]int{{0, 1, 2}})
+}
+
+func TestFindDuplicatesTypo(t *testing.T) {
+	cards := []*Card{
+		parseCard(t, "BEGIN:VCARD\nFN:Jane Doe\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Mary Smith\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Xoe, Jane\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Mary Smyth\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Jane Doe-Roe\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Kary Smyte\nEND:VCARD"),
+		parseCard(t, "BEGIN:VCARD\nFN:Mary Q Smith\nEND:VCARD"),
+	}
+	checkDuplicates(t, cards, [][]int{{0, 2}, {1, 3}})
+}
+
+// checkDuplicates checks that FindDuplicates groups the cards with the given
+// indexes.
+func checkDuplicates(t *testing.T, cards []*Card, want [][]int) {
+	t.Helper()
+	groups := FindDuplicates(cards)
+	if len(groups) != len(want) {
+		t.Fatalf("got %v groups, want %v", len(groups), len(want))
+	}
+	for i, group := range groups {
+		if len(group) != len(want[i]) {
+			t.Errorf("group %v has %v cards, want %v", i, len(group), len(want[i]))
+			continue
+		}
+		for j, card := range group {
+			if card != cards[want[i][j]] {
+				t.Errorf("card %v of group %v is %q, want %q", j, i, card.FormattedName(), cards[want[i][j]].FormattedName())
+			}
+		}
+	}
+}
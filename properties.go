@@ -0,0 +1,453 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Name is the structured name of the object a card represents, as stored in
+// the N property. Each field holds the values of a component, which may have
+// more than one (such as several additional names), and is nil if the
+// component is empty.
+type Name struct {
+	Family     []string
+	Given      []string
+	Additional []string
+	Prefix     []string
+	Suffix     []string
+}
+
+// Email is an email address, as stored in the EMAIL property.
+type Email struct {
+	Address string
+	Types   []string // the values of the TYPE parameter, such as "work"
+	Pref    int      // the preference (1 is most preferred), or 0 if unspecified
+}
+
+// Telephone is a telephone number, as stored in the TEL property.
+type Telephone struct {
+	Number string   // the number, which may be a "tel:" URI in vCard 4.0
+	Types  []string // the values of the TYPE parameter, such as "cell"
+	Pref   int      // the preference (1 is most preferred), or 0 if unspecified
+}
+
+// Address is a postal address, as stored in the ADR property. As in Name, each
+// component is given by its values, and is nil if it is empty.
+type Address struct {
+	POBox      []string
+	Extended   []string // the extended address, such as an apartment number
+	Street     []string
+	Locality   []string // the city or town
+	Region     []string // the state or province
+	PostalCode []string
+	Country    []string
+	Label      string   // the formatted label, from the LABEL parameter
+	Types      []string // the values of the TYPE parameter, such as "home"
+	Pref       int      // the preference (1 is most preferred), or 0 if unspecified
+}
+
+// FormattedName returns the value of the FN property, or the empty string if
+// there is none.
+func (c *Card) FormattedName() string {
+	return c.text("FN")
+}
+
+// SetFormattedName sets the FN property, replacing any existing value.
+func (c *Card) SetFormattedName(name string) {
+	c.setText("FN", name)
+}
+
+// Name returns the structured name stored in the N property. If there is no N
+// property, all the fields of the result are empty.
+func (c *Card) Name() Name {
+	props := c.Get("N")
+	if len(props) == 0 {
+		return Name{}
+	}
+	prop := props[0]
+	return Name{
+		Family:     prop.values(0),
+		Given:      prop.values(1),
+		Additional: prop.values(2),
+		Prefix:     prop.values(3),
+		Suffix:     prop.values(4),
+	}
+}
+
+// SetName sets the N property, replacing any existing value.
+func (c *Card) SetName(name Name) {
+	var prop Property
+	prop.SetComponents(
+		componentValues(name.Family),
+		componentValues(name.Given),
+		componentValues(name.Additional),
+		componentValues(name.Prefix),
+		componentValues(name.Suffix),
+	)
+	c.replace("N", []Property{prop})
+}
+
+// Emails returns the email addresses stored in the EMAIL properties, in the
+// order they appear in the card.
+func (c *Card) Emails() []Email {
+	var emails []Email
+	for _, prop := range c.Get("EMAIL") {
+		emails = append(emails, Email{
+			Address: prop.text(),
+			Types:   prop.types(),
+			Pref:    prop.pref(),
+		})
+	}
+	return emails
+}
+
+// SetEmails sets the EMAIL properties, replacing any existing ones.
+func (c *Card) SetEmails(emails ...Email) {
+	props := make([]Property, len(emails))
+	for i, email := range emails {
+		props[i].SetValues(email.Address)
+		c.setTypes(&props[i], email.Types, email.Pref)
+	}
+	c.replace("EMAIL", props)
+}
+
+// Telephones returns the telephone numbers stored in the TEL properties, in
+// the order they appear in the card.
+func (c *Card) Telephones() []Telephone {
+	var tels []Telephone
+	for _, prop := range c.Get("TEL") {
+		tels = append(tels, Telephone{
+			Number: prop.text(),
+			Types:  prop.types(),
+			Pref:   prop.pref(),
+		})
+	}
+	return tels
+}
+
+// SetTelephones sets the TEL properties, replacing any existing ones.
+func (c *Card) SetTelephones(tels ...Telephone) {
+	props := make([]Property, len(tels))
+	for i, tel := range tels {
+		props[i].SetValues(tel.Number)
+		c.setTypes(&props[i], tel.Types, tel.Pref)
+	}
+	c.replace("TEL", props)
+}
+
+// Addresses returns the postal addresses stored in the ADR properties, in the
+// order they appear in the card.
+func (c *Card) Addresses() []Address {
+	var addrs []Address
+	for _, prop := range c.Get("ADR") {
+		var label string
+		if values := prop.Param("LABEL"); len(values) > 0 {
+			label = strings.Join(values, ",")
+		}
+		addrs = append(addrs, Address{
+			POBox:      prop.values(0),
+			Extended:   prop.values(1),
+			Street:     prop.values(2),
+			Locality:   prop.values(3),
+			Region:     prop.values(4),
+			PostalCode: prop.values(5),
+			Country:    prop.values(6),
+			Label:      label,
+			Types:      prop.types(),
+			Pref:       prop.pref(),
+		})
+	}
+	return addrs
+}
+
+// SetAddresses sets the ADR properties, replacing any existing ones.
+func (c *Card) SetAddresses(addrs ...Address) {
+	props := make([]Property, len(addrs))
+	for i, addr := range addrs {
+		props[i].SetComponents(
+			componentValues(addr.POBox),
+			componentValues(addr.Extended),
+			componentValues(addr.Street),
+			componentValues(addr.Locality),
+			componentValues(addr.Region),
+			componentValues(addr.PostalCode),
+			componentValues(addr.Country),
+		)
+		if addr.Label != "" {
+			props[i].SetParam("LABEL", addr.Label)
+		}
+		c.setTypes(&props[i], addr.Types, addr.Pref)
+	}
+	c.replace("ADR", props)
+}
+
+// Organization returns the components of the ORG property: the name of the
+// organization, followed by the names of any organizational units. If there
+// is no ORG property, the result is nil.
+func (c *Card) Organization() []string {
+	props := c.Get("ORG")
+	if len(props) == 0 {
+		return nil
+	}
+	org := make([]string, len(props[0].components))
+	for i := range org {
+		org[i] = props[0].component(i)
+	}
+	return org
+}
+
+// SetOrganization sets the ORG property to the given organization name and
+// organizational units, replacing any existing value.
+func (c *Card) SetOrganization(name string, units ...string) {
+	components := [][]string{{name}}
+	for _, unit := range units {
+		components = append(components, []string{unit})
+	}
+	var prop Property
+	prop.SetComponents(components...)
+	c.replace("ORG", []Property{prop})
+}
+
+// Birthday returns the value of the BDAY property as a Date, or the zero Date
+// if there is none. If the value is not a date (for example, if it is given
+// as text), the error is as for Property.PartialDate.
+func (c *Card) Birthday() (Date, error) {
+	props := c.Get("BDAY")
+	if len(props) == 0 {
+		return Date{}, nil
+	}
+	return props[0].PartialDate()
+}
+
+// SetBirthday sets the BDAY property, replacing any existing value.
+func (c *Card) SetBirthday(bday Date) {
+	var prop Property
+	prop.SetPartialDate(bday)
+	c.replace("BDAY", []Property{prop})
+}
+
+// UID returns the value of the UID property, or the empty string if there is
+// none.
+func (c *Card) UID() string {
+	return c.text("UID")
+}
+
+// SetUID sets the UID property, replacing any existing value.
+func (c *Card) SetUID(uid string) {
+	c.setText("UID", uid)
+}
+
+// text returns the value of the first occurrence of the given property, or
+// the empty string if there is none.
+func (c *Card) text(name string) string {
+	props := c.Get(name)
+	if len(props) == 0 {
+		return ""
+	}
+	return props[0].text()
+}
+
+// setText replaces all occurrences of the given property with a single one
+// with the given value.
+func (c *Card) setText(name, value string) {
+	var prop Property
+	prop.SetValues(value)
+	c.replace(name, []Property{prop})
+}
+
+// replace replaces all occurrences of the given property with the given
+// properties. The replacements take the positions of the existing occurrences
+// (in order), and any extra replacements are added at the end of the card.
+func (c *Card) replace(name string, props []Property) {
+	name = strings.ToUpper(name)
+	old := len(c.m[name])
+	if len(props) < old {
+		// Remove the order entries of the extra existing occurrences.
+		order := c.order[:0]
+		seen := 0
+		for _, n := range c.order {
+			if n == name {
+				seen++
+				if seen > len(props) {
+					continue
+				}
+			}
+			order = append(order, n)
+		}
+		c.order = order
+	}
+	for i := old; i < len(props); i++ {
+		c.order = append(c.order, name)
+	}
+
+	if len(props) == 0 {
+		delete(c.m, name)
+		return
+	}
+	if c.m == nil {
+		c.m = make(map[string][]Property)
+	}
+	c.m[name] = props
+}
+
+// setTypes sets the TYPE and PREF parameters of a property. Since vCard 3.0
+// has no PREF parameter, the preferred property is instead indicated by
+// including "pref" as a type unless the card is known to use vCard 4.0.
+func (c *Card) setTypes(prop *Property, types []string, pref int) {
+	if pref > 0 && c.text("VERSION") != "4.0" {
+		if pref == 1 {
+			types = append(types[:len(types):len(types)], "pref")
+		}
+		pref = 0
+	}
+	if len(types) > 0 {
+		prop.SetParam("TYPE", types...)
+	}
+	if pref > 0 {
+		prop.SetParam("PREF", strconv.Itoa(pref))
+	}
+}
+
+// joined returns the full value of the property as a single string, with
+// components joined by semicolons and values joined by commas. No escaping is
+// performed, so this is only appropriate for values (such as URIs) in which
+// these characters are not special.
+func (p *Property) joined() string {
+	components := make([]string, len(p.components))
+	for i := range components {
+		components[i] = p.component(i)
+	}
+	return strings.Join(components, ";")
+}
+
+// setJoined sets the value of the property to a string which is split into
+// components and values at each semicolon and comma, the inverse of joined.
+// This ensures that these characters will be written without escaping.
+func (p *Property) setJoined(value string) {
+	var components [][]string
+	for _, component := range strings.Split(value, ";") {
+		components = append(components, strings.Split(component, ","))
+	}
+	p.SetComponents(components...)
+}
+
+// text returns the full value of the first component of the property, with
+// multiple values joined by commas.
+func (p *Property) text() string {
+	return p.component(0)
+}
+
+// component returns the values of the component with the given index joined
+// by commas, or the empty string if there is no such component.
+func (p *Property) component(i int) string {
+	if i >= len(p.components) {
+		return ""
+	}
+	return strings.Join(p.components[i], ",")
+}
+
+// values returns a copy of the values of the component with the given index,
+// or nil if there is no such component or its only value is empty.
+func (p *Property) values(i int) []string {
+	if i >= len(p.components) || len(p.components[i]) == 0 ||
+		len(p.components[i]) == 1 && p.components[i][0] == "" {
+		return nil
+	}
+	return append([]string(nil), p.components[i]...)
+}
+
+// componentValues returns the values of a component as given by values, the
+// inverse of values.
+func componentValues(values []string) []string {
+	if len(values) == 0 {
+		return []string{""}
+	}
+	return values
+}
+
+// types returns the values of the TYPE parameter of the property, excluding
+// "pref" (which is handled by pref). Values containing commas (which can
+// occur if the parameter value was quoted) are split into several types.
+func (p *Property) types() []string {
+	var types []string
+	for _, value := range p.Param("TYPE") {
+		for _, t := range strings.Split(value, ",") {
+			if t != "" && !strings.EqualFold(t, "pref") {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// pref returns the preference of the property, according to the PREF
+// parameter (vCard 4.0) or the presence of "pref" as a type (vCard 3.0). A
+// result of 0 means that no preference is specified.
+func (p *Property) pref() int {
+	if values := p.Param("PREF"); len(values) > 0 {
+		if pref, err := strconv.Atoi(values[0]); err == nil && pref > 0 {
+			return pref
+		}
+	}
+	for _, value := range p.Param("TYPE") {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(t, "pref") {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// clone returns a deep copy of the property.
+func (p Property) clone() Property {
+	clone := Property{group: p.group}
+	for _, key := range p.paramOrder {
+		clone.SetParam(key, append([]string(nil), p.params[key]...)...)
+	}
+	for _, values := range p.components {
+		clone.components = append(clone.components, append([]string(nil), values...))
+	}
+	return clone
+}
+
+// removeType removes a value (case-insensitively) from the TYPE parameter of
+// the property, removing the parameter entirely if no values are left.
+func (p *Property) removeType(t string) {
+	var types []string
+	for _, value := range p.Param("TYPE") {
+		for _, v := range strings.Split(value, ",") {
+			if v != "" && !strings.EqualFold(v, t) {
+				types = append(types, v)
+			}
+		}
+	}
+	if len(types) > 0 {
+		p.SetParam("TYPE", types...)
+	} else {
+		p.removeParam("TYPE")
+	}
+}
+
+// clone returns a deep copy of the card.
+func (c *Card) clone() *Card {
+	clone := &Card{
+		m:     make(map[string][]Property, len(c.m)),
+		order: append([]string(nil), c.order...),
+	}
+	for name, props := range c.m {
+		clones := make([]Property, len(props))
+		for i, prop := range props {
+			clones[i] = prop.clone()
+		}
+		clone.m[name] = clones
+	}
+	return clone
+}
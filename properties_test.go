@@ -0,0 +1,156 @@
+package vcard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAccessors(t *testing.T) {
+	card := sampleVCardParsed
+	if fn := card.FormattedName(); fn != "Forrest Gump" {
+		t.Errorf("FormattedName() = %q, want %q", fn, "Forrest Gump")
+	}
+	if n, want := card.Name(), (Name{Family: []string{"Gump"}, Given: []string{"Forrest"}, Prefix: []string{"Mr."}}); !reflect.DeepEqual(n, want) {
+		t.Errorf("Name() = %+v, want %+v", n, want)
+	}
+	if emails, want := card.Emails(), []Email{{Address: "forrestgump@example.com"}}; !reflect.DeepEqual(emails, want) {
+		t.Errorf("Emails() = %+v, want %+v", emails, want)
+	}
+	tels := []Telephone{
+		{Number: "(111) 555-1212", Types: []string{"WORK", "VOICE"}},
+		{Number: "(404) 555-1212", Types: []string{"HOME", "VOICE"}},
+	}
+	if actual := card.Telephones(); !reflect.DeepEqual(actual, tels) {
+		t.Errorf("Telephones() = %+v, want %+v", actual, tels)
+	}
+	addrs := []Address{{
+		Street:     []string{"100 Waters Edge"},
+		Locality:   []string{"Baytown"},
+		Region:     []string{"LA"},
+		PostalCode: []string{"30314"},
+		Country:    []string{"United States of America"},
+		Types:      []string{"WORK"},
+		Pref:       1,
+	}, {
+		Street:     []string{"42 Plantation St."},
+		Locality:   []string{"Baytown"},
+		Region:     []string{"LA"},
+		PostalCode: []string{"30314"},
+		Country:    []string{"United States of America"},
+		Types:      []string{"HOME"},
+	}}
+	if actual := card.Addresses(); !reflect.DeepEqual(actual, addrs) {
+		t.Errorf("Addresses() = %+v, want %+v", actual, addrs)
+	}
+	if org, want := card.Organization(), []string{"Bubba Gump Shrimp Co."}; !reflect.DeepEqual(org, want) {
+		t.Errorf("Organization() = %q, want %q", org, want)
+	}
+	if bday, err := card.Birthday(); bday != (Date{}) || err != nil {
+		t.Errorf("Birthday() = %v, %v, want the zero Date", bday, err)
+	}
+	if uid := card.UID(); uid != "" {
+		t.Errorf("UID() = %q, want empty", uid)
+	}
+}
+
+func TestSetters(t *testing.T) {
+	tests := []struct {
+		version string
+		out     string
+	}{
+		{"3.0", `BEGIN:VCARD
+VERSION:3.0
+FN:Jane Doe
+EMAIL;TYPE=work,pref:jane@example.com
+EMAIL:jdoe@example.org
+N:Doe;Jane;;Dr.;
+TEL;TYPE=cell:+1 555 0100
+ADR;LABEL=1 Main St.;TYPE=home:;;1 Main St.;Springfield;;;
+ORG:Acme;Research
+BDAY:19850412
+UID:urn:uuid:1234
+END:VCARD
+`},
+		{"4.0", `BEGIN:VCARD
+VERSION:4.0
+FN:Jane Doe
+EMAIL;TYPE=work;PREF=1:jane@example.com
+EMAIL:jdoe@example.org
+N:Doe;Jane;;Dr.;
+TEL;TYPE=cell:+1 555 0100
+ADR;LABEL=1 Main St.;TYPE=home:;;1 Main St.;Springfield;;;
+ORG:Acme;Research
+BDAY:19850412
+UID:urn:uuid:1234
+END:VCARD
+`},
+	}
+
+	for _, test := range tests {
+		card := new(Card)
+		card.Add("VERSION", Property{components: [][]string{{test.version}}})
+		card.SetFormattedName("Someone")
+		card.SetEmails(Email{Address: "old@example.com"})
+		card.SetFormattedName("Jane Doe")
+		card.SetEmails(
+			Email{Address: "jane@example.com", Types: []string{"work"}, Pref: 1},
+			Email{Address: "jdoe@example.org"},
+		)
+		card.SetName(Name{Family: []string{"Doe"}, Given: []string{"Jane"}, Prefix: []string{"Dr."}})
+		card.SetTelephones(Telephone{Number: "+1 555 0100", Types: []string{"cell"}})
+		card.SetAddresses(Address{
+			Street:   []string{"1 Main St."},
+			Locality: []string{"Springfield"},
+			Label:    "1 Main St.",
+			Types:    []string{"home"},
+		})
+		card.SetOrganization("Acme", "Research")
+		card.SetBirthday(Date{Year: 1985, Month: 4, Day: 12})
+		card.SetUID("urn:uuid:1234")
+
+		if out := card.UnfoldedString(); out != test.out {
+			t.Errorf("version %v: got %q, want %q", test.version, out, test.out)
+		}
+		if bday, err := card.Birthday(); err != nil || bday != (Date{Year: 1985, Month: 4, Day: 12}) {
+			t.Errorf("version %v: Birthday() = %v, %v", test.version, bday, err)
+		}
+		if emails := card.Emails(); len(emails) != 2 || emails[0].Pref != 1 || !reflect.DeepEqual(emails[0].Types, []string{"work"}) {
+			t.Errorf("version %v: Emails() = %+v", test.version, emails)
+		}
+	}
+}
+
+func TestSetRemovesExtra(t *testing.T) {
+	cards, err := ParseAll(strings.NewReader("BEGIN:VCARD\nEMAIL:a\nFN:x\nEMAIL:b\nEMAIL:c\nEND:VCARD\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	card := cards[0]
+	card.SetEmails(Email{Address: "d"})
+	const expected = "BEGIN:VCARD\nEMAIL:d\nFN:x\nEND:VCARD\n"
+	if out := card.UnfoldedString(); out != expected {
+		t.Fatalf("got %q, want %q", out, expected)
+	}
+	card.SetEmails()
+	if emails := card.Emails(); emails != nil {
+		t.Fatalf("got emails %+v after removing all", emails)
+	}
+}
+
+func TestSetRoundTrip(t *testing.T) {
+	const in = "BEGIN:VCARD\nN:O\\,Brien;John;A,B;;\nADR:;;1 Main St.,Suite 2;Springfield\\, IL;;;\nEND:VCARD\n"
+	cards, err := ParseAll(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	card := cards[0]
+	if family := card.Name().Family; !reflect.DeepEqual(family, []string{"O,Brien"}) {
+		t.Errorf("got family name %q, want %q", family, []string{"O,Brien"})
+	}
+	card.SetName(card.Name())
+	card.SetAddresses(card.Addresses()...)
+	if out := card.UnfoldedString(); out != in {
+		t.Errorf("got %q, want %q", out, in)
+	}
+}
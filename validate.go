@@ -0,0 +1,157 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Rule is a rule of the vCard specification which a card may violate.
+type Rule string
+
+const (
+	// RuleRequired is violated when a required property is missing.
+	RuleRequired Rule = "required"
+	// RuleAtMostOnce is violated when a property which may only appear
+	// once appears more than once. In vCard 4.0, occurrences with the
+	// same ALTID parameter are alternative representations of the same
+	// value, so they count only once.
+	RuleAtMostOnce Rule = "at-most-once"
+	// RuleVersionFirst is violated when the VERSION property is not the
+	// first property of the card.
+	RuleVersionFirst Rule = "version-first"
+	// RuleVersionMismatch is violated when the VERSION property does not
+	// match the version being validated against.
+	RuleVersionMismatch Rule = "version-mismatch"
+	// RulePrefRange is violated when the PREF parameter is not an integer
+	// between 1 and 100.
+	RulePrefRange Rule = "pref-range"
+	// RuleUnsupportedVersion is violated when the version being validated
+	// against is not one supported by Validate, in which case no other
+	// rules are checked.
+	RuleUnsupportedVersion Rule = "unsupported-version"
+)
+
+// Violation is a violation of a rule of the vCard specification.
+type Violation struct {
+	Property string // the name of the property concerned
+	Index    int    // the index of the occurrence concerned, or -1 if none
+	Rule     Rule
+}
+
+func (v Violation) String() string {
+	if v.Index < 0 {
+		return fmt.Sprintf("%v: %v", v.Property, v.Rule)
+	}
+	return fmt.Sprintf("%v[%v]: %v", v.Property, v.Index, v.Rule)
+}
+
+// cardinality describes how many times properties may appear in a card of a
+// particular version.
+type cardinality struct {
+	required   []string // properties which must appear at least once
+	atMostOnce []string // properties which may appear at most once
+}
+
+// cardinalities maps each version to the cardinality rules for properties in
+// that version. For vCard 4.0, these are given by RFC 6350 (and RFC 6474 for
+// BIRTHPLACE, DEATHPLACE and DEATHDATE); for vCard 3.0 by RFC 2426; and for
+// vCard 2.1 by the vCard 2.1 specification.
+var cardinalities = map[string]cardinality{
+	"2.1": {
+		required:   []string{"VERSION", "N"},
+		atMostOnce: []string{"VERSION", "N", "FN", "BDAY", "REV", "UID"},
+	},
+	"3.0": {
+		required: []string{"VERSION", "N", "FN"},
+		atMostOnce: []string{
+			"VERSION", "N", "FN", "BDAY", "PRODID", "REV", "UID",
+			"SORT-STRING", "CLASS",
+		},
+	},
+	"4.0": {
+		required: []string{"VERSION", "FN"},
+		atMostOnce: []string{
+			"VERSION", "KIND", "N", "BDAY", "ANNIVERSARY", "GENDER",
+			"PRODID", "REV", "UID", "BIRTHPLACE", "DEATHPLACE",
+			"DEATHDATE",
+		},
+	},
+}
+
+// Validate checks that the card conforms to the rules of the given version
+// of the vCard specification ("2.1", "3.0" or "4.0") regarding which
+// properties must be present, which may appear at most once, the position and
+// value of the VERSION property and the range of the PREF parameter. The
+// violations are returned in the order they were found; if there are none,
+// the result is nil. If the version is not supported, the only violation is
+// of RuleUnsupportedVersion.
+func (c *Card) Validate(version string) []Violation {
+	rules, ok := cardinalities[version]
+	if !ok {
+		index := -1
+		if len(c.Get("VERSION")) > 0 {
+			index = 0
+		}
+		return []Violation{{"VERSION", index, RuleUnsupportedVersion}}
+	}
+	var violations []Violation
+
+	if v := c.Get("VERSION"); len(v) > 0 {
+		if c.order[0] != "VERSION" {
+			violations = append(violations, Violation{"VERSION", 0, RuleVersionFirst})
+		}
+		if v[0].text() != version {
+			violations = append(violations, Violation{"VERSION", 0, RuleVersionMismatch})
+		}
+	}
+
+	for _, name := range rules.required {
+		if len(c.Get(name)) == 0 {
+			violations = append(violations, Violation{name, -1, RuleRequired})
+		}
+	}
+
+	for _, name := range rules.atMostOnce {
+		seen := make(map[string]bool)
+		for i, prop := range c.Get(name) {
+			// Without an ALTID, every occurrence is a separate value.
+			key := strconv.Itoa(i)
+			if values := prop.Param("ALTID"); version == "4.0" && len(values) > 0 {
+				key = "ALTID=" + values[0]
+			}
+			if len(seen) > 0 && !seen[key] {
+				violations = append(violations, Violation{name, i, RuleAtMostOnce})
+			}
+			seen[key] = true
+		}
+	}
+
+	if version == "4.0" {
+		// seen keeps track of how many occurrences of each property we
+		// have already checked, so we know the index of the next one.
+		seen := make(map[string]int)
+		for _, name := range c.order {
+			i := seen[name]
+			seen[name]++
+			if i >= len(c.m[name]) {
+				continue
+			}
+			values := c.m[name][i].Param("PREF")
+			if len(values) == 0 {
+				continue
+			}
+			if pref, err := strconv.Atoi(values[0]); err != nil || pref < 1 || pref > 100 || len(values) > 1 {
+				violations = append(violations, Violation{name, i, RulePrefRange})
+			}
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,69 @@
+package vcard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		in         string
+		version    string
+		violations []Violation
+	}{
+		{sampleVCard, "3.0", nil},
+		{sampleVCard4, "4.0", nil},
+		{sampleVCard, "4.0", []Violation{{"VERSION", 0, RuleVersionMismatch}}},
+		{"BEGIN:VCARD\nEND:VCARD", "4.0", []Violation{
+			{"VERSION", -1, RuleRequired},
+			{"FN", -1, RuleRequired},
+		}},
+		{"BEGIN:VCARD\nFN:a\nVERSION:4.0\nFN:b\nEND:VCARD", "4.0", []Violation{
+			{"VERSION", 0, RuleVersionFirst},
+		}},
+		{"BEGIN:VCARD\nVERSION:3.0\nFN:a\nFN:b\nEND:VCARD", "3.0", []Violation{
+			{"N", -1, RuleRequired},
+			{"FN", 1, RuleAtMostOnce},
+		}},
+		{"BEGIN:VCARD\nVERSION:4.0\nFN:a\nKIND:individual\nBDAY:1985\nKIND:group\nBDAY:1986\nGENDER:M\nEND:VCARD", "4.0", []Violation{
+			{"KIND", 1, RuleAtMostOnce},
+			{"BDAY", 1, RuleAtMostOnce},
+		}},
+		{"BEGIN:VCARD\nVERSION:4.0\nFN:a\nN;ALTID=1;LANGUAGE=en:Doe;John\nN;ALTID=1;LANGUAGE=ja:Doe;Jon\nN;ALTID=2:Smith;John\nEND:VCARD", "4.0", []Violation{
+			{"N", 2, RuleAtMostOnce},
+		}},
+		{"BEGIN:VCARD\nVERSION:4.0\nFN:a\nEMAIL;PREF=1:a\nEMAIL;PREF=101:b\nTEL;PREF=x:c\nEMAIL;PREF=0:d\nEND:VCARD", "4.0", []Violation{
+			{"EMAIL", 1, RulePrefRange},
+			{"TEL", 0, RulePrefRange},
+			{"EMAIL", 2, RulePrefRange},
+		}},
+		{"BEGIN:VCARD\nVERSION:2.1\nN:Doe;John\nEMAIL;PREF=200:a\nEND:VCARD", "2.1", nil},
+		{"BEGIN:VCARD\nVERSION:5.0\nFN:a\nEND:VCARD", "5.0", []Violation{
+			{"VERSION", 0, RuleUnsupportedVersion},
+		}},
+		{"BEGIN:VCARD\nFN:a\nEND:VCARD", "", []Violation{
+			{"VERSION", -1, RuleUnsupportedVersion},
+		}},
+	}
+
+	for _, test := range tests {
+		cards, err := ParseAll(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("parsing %q: unexpected error: %v", test.in, err)
+			continue
+		}
+		if violations := cards[0].Validate(test.version); !reflect.DeepEqual(violations, test.violations) {
+			t.Errorf("Validate(%q) for %q = %v, want %v", test.version, test.in, violations, test.violations)
+		}
+	}
+}
+
+func TestViolationString(t *testing.T) {
+	if s := (Violation{"FN", -1, RuleRequired}).String(); s != "FN: required" {
+		t.Errorf("got %q", s)
+	}
+	if s := (Violation{"BDAY", 1, RuleAtMostOnce}).String(); s != "BDAY[1]: at-most-once" {
+		t.Errorf("got %q", s)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultValueTypes maps property names to the types of their values when no
+// VALUE parameter is given, as specified by RFC 6350 (and RFC 2426 for
+// properties which are only present in vCard 3.0). Properties which are not
+// listed here have values of an unknown type.
+var defaultValueTypes = map[string]string{
+	"SOURCE":        "uri",
+	"KIND":          "text",
+	"XML":           "text",
+	"FN":            "text",
+	"N":             "text",
+	"NICKNAME":      "text",
+	"PHOTO":         "uri",
+	"BDAY":          "date-and-or-time",
+	"ANNIVERSARY":   "date-and-or-time",
+	"GENDER":        "text",
+	"ADR":           "text",
+	"TEL":           "text",
+	"EMAIL":         "text",
+	"IMPP":          "uri",
+	"LANG":          "language-tag",
+	"TZ":            "text",
+	"GEO":           "uri",
+	"TITLE":         "text",
+	"ROLE":          "text",
+	"LOGO":          "uri",
+	"ORG":           "text",
+	"MEMBER":        "uri",
+	"RELATED":       "uri",
+	"CATEGORIES":    "text",
+	"NOTE":          "text",
+	"PRODID":        "text",
+	"REV":           "timestamp",
+	"SOUND":         "uri",
+	"UID":           "uri",
+	"CLIENTPIDMAP":  "text",
+	"URL":           "uri",
+	"VERSION":       "text",
+	"KEY":           "uri",
+	"FBURL":         "uri",
+	"CALADRURI":     "uri",
+	"CALURI":        "uri",
+	"BIRTHPLACE":    "text",
+	"DEATHPLACE":    "text",
+	"DEATHDATE":     "date-and-or-time",
+	"EXPERTISE":     "text",
+	"HOBBY":         "text",
+	"INTEREST":      "text",
+	"ORG-DIRECTORY": "uri",
+	"LABEL":         "text",
+	"MAILER":        "text",
+	"NAME":          "text",
+	"CLASS":         "text",
+	"SORT-STRING":   "text",
+	"AGENT":         "uri",
+}
+
+// defaultValueTypes3 contains the default value types which are different in
+// vCard 2.1 and 3.0 compared to defaultValueTypes.
+var defaultValueTypes3 = map[string]string{
+	"PHOTO": "binary",
+	"LOGO":  "binary",
+	"SOUND": "binary",
+	"KEY":   "binary",
+	"UID":   "text",
+	"BDAY":  "date",
+	"REV":   "date-time",
+	"TZ":    "utc-offset",
+	"GEO":   "float",
+	"AGENT": "vcard",
+}
+
+// ValueType returns the type of the value of the given property in a card of
+// the given version, as given by its VALUE parameter or (if there is none) the
+// default for its name. The result is always in lowercase, and is "unknown" if
+// the type is not known.
+func ValueType(version, name string, prop Property) string {
+	if values := prop.Param("VALUE"); len(values) > 0 {
+		return strings.ToLower(values[0])
+	}
+	name = strings.ToUpper(name)
+	if version == "2.1" || version == "3.0" {
+		if t, ok := defaultValueTypes3[name]; ok {
+			return t
+		}
+	}
+	if t, ok := defaultValueTypes[name]; ok {
+		return t
+	}
+	return "unknown"
+}
+
+// ValueError is the error returned by the typed value getters of Property
+// (such as Date and Integer) when the value of the property does not have the
+// syntax of the requested type.
+type ValueError struct {
+	Type  string // the requested type, such as "date"
+	Value string // the value of the property
+}
+
+func (e ValueError) Error() string {
+	return fmt.Sprintf("vcard: invalid %v value %q", e.Type, e.Value)
+}
+
+// Date returns the value of the property as a date. In addition to complete
+// dates such as "19850412", the reduced forms allowed by RFC 6350 ("1985-04",
+// "1985", "--0412", "--04" and "---12"), the extended format used by vCard 3.0
+// ("1985-04-12") and a date followed by an empty time ("19850412T") are
+// accepted. Missing fields are given the lowest possible value (zero for the
+// year and one for the month and day), and the result is in UTC. Use
+// PartialDate to find out which fields are present.
+func (p *Property) Date() (time.Time, error) {
+	value := p.text()
+	d, err := ParseDate(value)
+	if err != nil || d.HasTime() || !d.HasDate() {
+		return time.Time{}, ValueError{"date", value}
+	}
+	return d.Time(), nil
+}
+
+// SetDate sets the value of the property to the given date, ignoring the
+// time of day and location.
+func (p *Property) SetDate(t time.Time) {
+	p.SetValues(t.Format("20060102"))
+}
+
+// Time returns the value of the property as a time. The value may be a date,
+// a time (preceded by "T", unless the VALUE parameter is "time"), a date and
+// time separated by "T" or a timestamp, in any of the forms accepted by
+// PartialDate. Missing fields are given the lowest possible value, and the
+// result is in UTC unless the value specifies a UTC offset.
+func (p *Property) Time() (time.Time, error) {
+	d, err := p.PartialDate()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.Time(), nil
+}
+
+// SetTime sets the value of the property to the given time as a timestamp,
+// such as "19961022T140000Z" (for times in UTC) or "19961022T140000-0500".
+func (p *Property) SetTime(t time.Time) {
+	if _, offset := t.Zone(); offset == 0 {
+		p.SetValues(t.Format("20060102T150405Z"))
+	} else {
+		p.SetValues(t.Format("20060102T150405-0700"))
+	}
+}
+
+// URI returns the value of the property as an absolute URI.
+func (p *Property) URI() (*url.URL, error) {
+	value := p.joined()
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" {
+		return nil, ValueError{"uri", value}
+	}
+	return u, nil
+}
+
+// SetURI sets the value of the property to the given URI.
+func (p *Property) SetURI(u *url.URL) {
+	p.setJoined(u.String())
+}
+
+// UTCOffset returns the value of the property as an offset from UTC, which
+// may be given in the basic format used by vCard 4.0 (such as "-0500" or
+// "-05") or the extended format used by vCard 3.0 (such as "-05:00").
+func (p *Property) UTCOffset() (time.Duration, error) {
+	value := p.text()
+	offset, ok := parseUTCOffset(value)
+	if !ok {
+		return 0, ValueError{"utc-offset", value}
+	}
+	return time.Duration(offset) * time.Second, nil
+}
+
+// SetUTCOffset sets the value of the property to the given offset from UTC,
+// rounded down to the minute.
+func (p *Property) SetUTCOffset(offset time.Duration) {
+	p.SetValues(formatUTCOffset(int(offset/time.Second), false))
+}
+
+// Boolean returns the value of the property as a boolean, which must be
+// "TRUE" or "FALSE" (in any case).
+func (p *Property) Boolean() (bool, error) {
+	switch value := p.text(); strings.ToUpper(value) {
+	case "TRUE":
+		return true, nil
+	case "FALSE":
+		return false, nil
+	default:
+		return false, ValueError{"boolean", value}
+	}
+}
+
+// SetBoolean sets the value of the property to the given boolean.
+func (p *Property) SetBoolean(b bool) {
+	if b {
+		p.SetValues("TRUE")
+	} else {
+		p.SetValues("FALSE")
+	}
+}
+
+// Integer returns the value of the property as an integer.
+func (p *Property) Integer() (int64, error) {
+	value := p.text()
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, ValueError{"integer", value}
+	}
+	return i, nil
+}
+
+// SetInteger sets the value of the property to the given integer.
+func (p *Property) SetInteger(i int64) {
+	p.SetValues(strconv.FormatInt(i, 10))
+}
+
+// Float returns the value of the property as a floating-point number.
+func (p *Property) Float() (float64, error) {
+	value := p.text()
+	// The value may not be in exponential notation or one of the special
+	// values accepted by ParseFloat, such as "Inf".
+	if strings.ContainsAny(value, "eEnNiIxXpP_") {
+		return 0, ValueError{"float", value}
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, ValueError{"float", value}
+	}
+	return f, nil
+}
+
+// SetFloat sets the value of the property to the given floating-point number.
+func (p *Property) SetFloat(f float64) {
+	p.SetValues(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// parseUTCOffset parses a UTC offset, such as "Z", "-05", "-0500" or
+// "-05:00", returning the offset in seconds.
+func parseUTCOffset(s string) (int, bool) {
+	if s == "Z" {
+		return 0, true
+	}
+	if len(s) == 0 || s[0] != '+' && s[0] != '-' {
+		return 0, false
+	}
+	sign := 1
+	if s[0] == '-' {
+		sign = -1
+	}
+	hour, rest, ok := parseDigits(s[1:], 2, 0, 23)
+	if !ok {
+		return 0, false
+	}
+	minute := 0
+	if rest != "" {
+		if rest[0] == ':' {
+			rest = rest[1:]
+		}
+		if minute, rest, ok = parseDigits(rest, 2, 0, 59); !ok || rest != "" {
+			return 0, false
+		}
+	}
+	return sign * (hour*3600 + minute*60), true
+}
+
+// formatUTCOffset formats a UTC offset given in seconds in the basic format,
+// such as "-0500", or the extended format, such as "-05:00".
+func formatUTCOffset(offset int, extended bool) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	sep := ""
+	if extended {
+		sep = ":"
+	}
+	return fmt.Sprintf("%c%02d%s%02d", sign, offset/3600, sep, offset/60%60)
+}
+
+// parseDigits parses an integer of exactly n digits at the beginning of s,
+// which must be between lo and hi (inclusive), returning the integer and
+// the rest of s.
+func parseDigits(s string, n, lo, hi int) (int, string, bool) {
+	if len(s) < n {
+		return -1, s, false
+	}
+	i := 0
+	for _, b := range []byte(s[:n]) {
+		if !isDigit(b) {
+			return -1, s, false
+		}
+		i = i*10 + int(b-'0')
+	}
+	return i, s[n:], lo <= i && i <= hi
+}
+
+// isDigit returns whether the given byte is an ASCII digit.
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
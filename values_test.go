@@ -0,0 +1,212 @@
+package vcard
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValueType(t *testing.T) {
+	tests := []struct {
+		version, name string
+		prop          Property
+		typ           string
+	}{
+		{"4.0", "BDAY", Property{}, "date-and-or-time"},
+		{"3.0", "BDAY", Property{}, "date"},
+		{"4.0", "bday", Property{}, "date-and-or-time"},
+		{"4.0", "BDAY", Property{params: map[string][]string{"VALUE": {"TEXT"}}}, "text"},
+		{"3.0", "TZ", Property{}, "utc-offset"},
+		{"4.0", "X-FOO", Property{}, "unknown"},
+	}
+
+	for _, test := range tests {
+		if typ := ValueType(test.version, test.name, test.prop); typ != test.typ {
+			t.Errorf("ValueType(%q, %q, %v) = %q, want %q", test.version, test.name, test.prop, typ, test.typ)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	tests := []struct {
+		value string
+		date  time.Time
+	}{
+		{"19850412", time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"1985-04-12", time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"1985-04", time.Date(1985, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"1985", time.Date(1985, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"--0412", time.Date(0, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"--04", time.Date(0, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"---12", time.Date(0, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"19850412T", time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		var prop Property
+		prop.SetValues(test.value)
+		if date, err := prop.Date(); err != nil {
+			t.Errorf("Date() for %q: unexpected error: %v", test.value, err)
+		} else if !date.Equal(test.date) {
+			t.Errorf("Date() for %q = %v, want %v", test.value, date, test.date)
+		}
+	}
+}
+
+func TestDateFailure(t *testing.T) {
+	for _, value := range []string{"", "abc", "198504", "19851312", "1985-04-1", "--13", "19850412T1022", "1985041"} {
+		var prop Property
+		prop.SetValues(value)
+		if _, err := prop.Date(); err != (ValueError{"date", value}) {
+			t.Errorf("Date() for %q: got error %v, want ValueError", value, err)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	est := time.FixedZone("", -5*3600)
+	tests := []struct {
+		value     string
+		valueType string
+		time      time.Time
+	}{
+		{"19961022T140000Z", "", time.Date(1996, 10, 22, 14, 0, 0, 0, time.UTC)},
+		{"19961022T140000-0500", "", time.Date(1996, 10, 22, 14, 0, 0, 0, est)},
+		{"1996-10-22T14:00:00-05:00", "", time.Date(1996, 10, 22, 14, 0, 0, 0, est)},
+		{"19961022T14", "", time.Date(1996, 10, 22, 14, 0, 0, 0, time.UTC)},
+		{"--1022T1400", "", time.Date(0, 10, 22, 14, 0, 0, 0, time.UTC)},
+		{"---22T14", "", time.Date(0, 1, 22, 14, 0, 0, 0, time.UTC)},
+		{"19850412", "", time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"19850412T", "", time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC)},
+		{"T102200", "", time.Date(0, 1, 1, 10, 22, 0, 0, time.UTC)},
+		{"T-2200", "", time.Date(0, 1, 1, 0, 22, 0, 0, time.UTC)},
+		{"T--00", "", time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"102200-0500", "time", time.Date(0, 1, 1, 10, 22, 0, 0, est)},
+	}
+
+	for _, test := range tests {
+		var prop Property
+		prop.SetValues(test.value)
+		if test.valueType != "" {
+			prop.SetParam("VALUE", test.valueType)
+		}
+		if tm, err := prop.Time(); err != nil {
+			t.Errorf("Time() for %q: unexpected error: %v", test.value, err)
+		} else if !tm.Equal(test.time) {
+			t.Errorf("Time() for %q = %v, want %v", test.value, tm, test.time)
+		}
+	}
+}
+
+func TestTimeFailure(t *testing.T) {
+	for _, value := range []string{"", "T", "102200", "19961022T250000", "19961022T1400+", "19961022T14000", "19961022T140000X"} {
+		var prop Property
+		prop.SetValues(value)
+		if _, err := prop.Time(); err != (ValueError{"date-and-or-time", value}) {
+			t.Errorf("Time() for %q: got error %v, want ValueError", value, err)
+		}
+	}
+}
+
+func TestSetDateTime(t *testing.T) {
+	var prop Property
+	prop.SetDate(time.Date(1985, 4, 12, 10, 22, 0, 0, time.UTC))
+	if value := prop.text(); value != "19850412" {
+		t.Errorf("SetDate: got %q", value)
+	}
+	prop.SetTime(time.Date(1996, 10, 22, 14, 0, 0, 0, time.UTC))
+	if value := prop.text(); value != "19961022T140000Z" {
+		t.Errorf("SetTime: got %q", value)
+	}
+	prop.SetTime(time.Date(1996, 10, 22, 14, 0, 0, 0, time.FixedZone("", -5*3600)))
+	if value := prop.text(); value != "19961022T140000-0500" {
+		t.Errorf("SetTime: got %q", value)
+	}
+}
+
+func TestURI(t *testing.T) {
+	var prop Property
+	u, _ := url.Parse("tel:+1-418-656-9254;ext=102")
+	prop.SetURI(u)
+	sb := new(strings.Builder)
+	writeProperty(sb, "TEL", prop)
+	if sb.String() != "TEL:tel:+1-418-656-9254;ext=102" {
+		t.Errorf("SetURI: got %q", sb.String())
+	}
+	if got, err := prop.URI(); err != nil || got.String() != u.String() {
+		t.Errorf("URI() = %v, %v, want %v", got, err, u)
+	}
+
+	prop.SetValues("not a uri")
+	if _, err := prop.URI(); err != (ValueError{"uri", "not a uri"}) {
+		t.Errorf("URI() for relative reference: got error %v, want ValueError", err)
+	}
+}
+
+func TestUTCOffset(t *testing.T) {
+	tests := []struct {
+		value  string
+		offset time.Duration
+	}{
+		{"-0500", -5 * time.Hour},
+		{"-05", -5 * time.Hour},
+		{"-05:00", -5 * time.Hour},
+		{"+0530", 5*time.Hour + 30*time.Minute},
+	}
+
+	for _, test := range tests {
+		var prop Property
+		prop.SetValues(test.value)
+		if offset, err := prop.UTCOffset(); err != nil || offset != test.offset {
+			t.Errorf("UTCOffset() for %q = %v, %v, want %v", test.value, offset, err, test.offset)
+		}
+	}
+
+	var prop Property
+	prop.SetUTCOffset(5*time.Hour + 30*time.Minute)
+	if value := prop.text(); value != "+0530" {
+		t.Errorf("SetUTCOffset: got %q", value)
+	}
+	prop.SetValues("0500")
+	if _, err := prop.UTCOffset(); err == nil {
+		t.Errorf("UTCOffset() for %q: expected error", "0500")
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	var prop Property
+	prop.SetBoolean(true)
+	if b, err := prop.Boolean(); err != nil || !b || prop.text() != "TRUE" {
+		t.Errorf("Boolean() = %v, %v for %q", b, err, prop.text())
+	}
+	prop.SetValues("false")
+	if b, err := prop.Boolean(); err != nil || b {
+		t.Errorf("Boolean() = %v, %v for %q", b, err, prop.text())
+	}
+
+	prop.SetInteger(-42)
+	if i, err := prop.Integer(); err != nil || i != -42 || prop.text() != "-42" {
+		t.Errorf("Integer() = %v, %v for %q", i, err, prop.text())
+	}
+
+	prop.SetFloat(46.772673)
+	if f, err := prop.Float(); err != nil || f != 46.772673 || prop.text() != "46.772673" {
+		t.Errorf("Float() = %v, %v for %q", f, err, prop.text())
+	}
+
+	for _, value := range []string{"yes", "1.5", "1e5", "Inf"} {
+		prop.SetValues(value)
+		if _, err := prop.Boolean(); err == nil {
+			t.Errorf("Boolean() for %q: expected error", value)
+		}
+		if _, err := prop.Integer(); err == nil {
+			t.Errorf("Integer() for %q: expected error", value)
+		}
+		if value != "1.5" {
+			if _, err := prop.Float(); err == nil {
+				t.Errorf("Float() for %q: expected error", value)
+			}
+		}
+	}
+}
@@ -9,16 +9,20 @@ package vcard
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"strings"
 )
 
 // Card is a container for vCard data, mapping each property name to a slice
 // containing the details of each occurrence of the property in the order they
-// appeared in the input.
+// appeared in the input. The card also remembers the order in which all of its
+// properties were added, so that it can be written back out in the same order.
 type Card struct {
-	m map[string][]Property
+	m     map[string][]Property
+	order []string // the name of each property, in the order it was added
 }
 
 // Get returns the properties corresponding to the given (case-insensitive)
@@ -28,71 +32,200 @@ func (c *Card) Get(name string) []Property {
 	return c.m[strings.ToUpper(name)]
 }
 
-// Add adds a property to the card.
+// Add adds a property to the card, after all the properties that have already
+// been added.
 func (c *Card) Add(name string, prop Property) {
 	if c.m == nil {
 		c.m = make(map[string][]Property)
 	}
 	name = strings.ToUpper(name)
 	c.m[name] = append(c.m[name], prop)
+	c.order = append(c.order, name)
 }
 
-// String returns the card in vCard syntax, properly folded such that each line
-// fits within 77 bytes. As with UnfoldedString, the order of properties in
-// the result is undefined, except for VERSION, which will always come first if
-// it is present.
-func (c *Card) String() string {
-	return Fold(c.UnfoldedString(), 77)
+// Set replaces all occurrences of the given property with the given one,
+// which takes the position of the first existing occurrence (or is added
+// after all the other properties, if there is none).
+func (c *Card) Set(name string, prop Property) {
+	c.replace(name, []Property{prop})
 }
 
-// UnfoldedString returns the card in vCard syntax, but without folding any
-// lines or using the "\r\n" line ending (it just uses the normal '\n'). The
-// order of the properties in the returned string is undefined, except that
-// the VERSION property (if present) will always be first.
-func (c *Card) UnfoldedString() string {
-	sb := new(strings.Builder)
-	fmt.Fprintln(sb, "BEGIN:VCARD")
-	// If the VERSION property is present, we need to print that first.
-	version, ok := c.m["VERSION"]
-	// This implementation doesn't behave well if the version property
-	// appears more than once, and it ignores any group or parameters, but
-	// since no standard vCard will do any of that it seems fine to ignore
-	// these cases.
-	if ok && len(version) > 0 {
-		sb.WriteString("VERSION:")
-		writeValues(sb, version[0].values)
-		sb.WriteRune('\n')
-	}
-	for name, props := range c.m {
-		// We already wrote the VERSION property above.
-		if name == "VERSION" {
+// SetAt replaces the occurrence of the given property with the given index
+// (as in the slice returned by Get), reporting whether the occurrence exists.
+func (c *Card) SetAt(name string, i int, prop Property) bool {
+	props := c.Get(name)
+	if i < 0 || i >= len(props) {
+		return false
+	}
+	props[i] = prop
+	return true
+}
+
+// Remove removes all occurrences of the given property.
+func (c *Card) Remove(name string) {
+	c.replace(name, nil)
+}
+
+// RemoveAt removes the occurrence of the given property with the given index
+// (as in the slice returned by Get), reporting whether the occurrence
+// existed. The following occurrences keep their positions relative to the
+// other properties of the card.
+func (c *Card) RemoveAt(name string, i int) bool {
+	name = strings.ToUpper(name)
+	props := c.m[name]
+	if i < 0 || i >= len(props) {
+		return false
+	}
+	if len(props) == 1 {
+		delete(c.m, name)
+	} else {
+		c.m[name] = append(props[:i:i], props[i+1:]...)
+	}
+	seen := 0
+	for j, n := range c.order {
+		if n != name {
 			continue
 		}
+		if seen == i {
+			c.order = append(c.order[:j], c.order[j+1:]...)
+			break
+		}
+		seen++
+	}
+	return true
+}
 
-		for _, prop := range props {
-			if len(prop.group) > 1 {
-				fmt.Fprintf(sb, "%v.", prop.group)
+// Len returns the number of properties in the card, counting each
+// occurrence separately.
+func (c *Card) Len() int {
+	n := 0
+	for _, props := range c.m {
+		n += len(props)
+	}
+	return n
+}
+
+// Names returns the names of the properties in the card, without
+// duplicates, in the order in which they were first added (except that
+// VERSION, if present, always comes first).
+func (c *Card) Names() []string {
+	var names []string
+	seen := make(map[string]bool)
+	c.walk(func(name string, _ Property) error {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names
+}
+
+// All returns an iterator over the properties of the card and their names,
+// in the order in which they are written by an Encoder. The iterator visits
+// the properties present when iteration begins, so the card may safely be
+// modified during iteration.
+func (c *Card) All() iter.Seq2[string, Property] {
+	return func(yield func(string, Property) bool) {
+		type entry struct {
+			name string
+			prop Property
+		}
+		var entries []entry
+		c.walk(func(name string, prop Property) error {
+			entries = append(entries, entry{name, prop})
+			return nil
+		})
+		for _, e := range entries {
+			if !yield(e.name, e.prop) {
+				return
 			}
-			sb.WriteString(name)
-			for key, values := range prop.params {
-				sb.WriteRune(';')
-				writeParam(sb, key, values)
+		}
+	}
+}
+
+// Occurrences returns an iterator over the occurrences of the given property
+// and their indexes (as in the slice returned by Get). Like All, it visits
+// the occurrences present when iteration begins.
+func (c *Card) Occurrences(name string) iter.Seq2[int, Property] {
+	props := append([]Property(nil), c.Get(name)...)
+	return func(yield func(int, Property) bool) {
+		for i, prop := range props {
+			if !yield(i, prop) {
+				return
 			}
-			sb.WriteRune(':')
-			writeValues(sb, prop.values)
-			sb.WriteRune('\n')
 		}
 	}
-	fmt.Fprintln(sb, "END:VCARD")
+}
+
+// walk calls f for each property of the card in the order they were added,
+// except that the VERSION property (if present) always comes first. This
+// implementation doesn't behave well if the VERSION property appears more
+// than once (only the first occurrence is used), but since no standard vCard
+// will do that it seems fine to ignore this case. Iteration stops at the first
+// error returned by f.
+func (c *Card) walk(f func(name string, prop Property) error) error {
+	if version := c.m["VERSION"]; len(version) > 0 {
+		if err := f("VERSION", version[0]); err != nil {
+			return err
+		}
+	}
+	// seen keeps track of how many occurrences of each property we have
+	// already visited, so we know which one to visit next.
+	seen := make(map[string]int)
+	for _, name := range c.order {
+		i := seen[name]
+		seen[name]++
+		// We already visited the VERSION property above.
+		if name == "VERSION" || i >= len(c.m[name]) {
+			continue
+		}
+		if err := f(name, c.m[name][i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the card in vCard syntax, properly folded such that each line
+// fits within 77 bytes. As with UnfoldedString, the properties are written in
+// the order they were added to the card, except for VERSION, which will
+// always come first if it is present.
+//
+// To write cards directly to an io.Writer, use an Encoder.
+func (c *Card) String() string {
+	sb := new(strings.Builder)
+	NewEncoder(sb).Encode(c)
+	return sb.String()
+}
+
+// UnfoldedString returns the card in vCard syntax, but without folding any
+// lines or using the "\r\n" line ending (it just uses the normal '\n'). The
+// properties are written in the order they were added to the card (which,
+// for a parsed card, is the order in which they appeared in the input), except
+// that the VERSION property (if present) will always be first. The
+// parameters of each property are likewise written in their original order.
+func (c *Card) UnfoldedString() string {
+	sb := new(strings.Builder)
+	e := NewEncoder(sb)
+	e.SetFold(false)
+	e.SetLineEnding("\n")
+	e.Encode(c)
 	return sb.String()
 }
 
 // Property is a container for the information stored in a vCard property,
 // except for the name.
+//
+// The value of a property is made up of one or more components, separated by
+// semicolons, each of which is made up of one or more values, separated by
+// commas. Most properties have only a single component, but some (such as N
+// and ADR) are structured into several components.
 type Property struct {
-	group  string
-	params map[string][]string
-	values []string
+	group      string
+	params     map[string][]string
+	paramOrder []string   // the name of each parameter, in the order it was set
+	components [][]string // the values of each component
 }
 
 // Group returns the group of the property.
@@ -113,34 +246,99 @@ func (p *Property) Param(param string) []string {
 
 // SetParam sets the values of a property parameter. Further changes to the
 // given slice will be reflected in the property (this method does not make
-// a copy).
+// a copy). A parameter which is set for the first time will be written after
+// all the existing parameters.
 func (p *Property) SetParam(param string, values ...string) {
 	if p.params == nil {
 		p.params = make(map[string][]string)
 	}
-	p.params[strings.ToUpper(param)] = values
+	param = strings.ToUpper(param)
+	if _, ok := p.params[param]; !ok {
+		p.paramOrder = append(p.paramOrder, param)
+	}
+	p.params[param] = values
 }
 
-// Values returns the values of a property. Changes to the returned slice will
-// be reflected in the property.
+// removeParam removes a property parameter.
+func (p *Property) removeParam(param string) {
+	param = strings.ToUpper(param)
+	if _, ok := p.params[param]; !ok {
+		return
+	}
+	delete(p.params, param)
+	for i, key := range p.paramOrder {
+		if key == param {
+			p.paramOrder = append(p.paramOrder[:i], p.paramOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// addParam adds values to a property parameter, keeping any values that are
+// already present.
+func (p *Property) addParam(param string, values ...string) {
+	p.SetParam(param, append(p.Param(param), values...)...)
+}
+
+// Values returns the values of a property. For a property with more than one
+// component, this is only the values of the first component; use Components
+// to get all of them. Changes to the returned slice will be reflected in the
+// property.
 func (p *Property) Values() []string {
-	return p.values
+	if len(p.components) == 0 {
+		return nil
+	}
+	return p.components[0]
 }
 
-// SetValues sets the values of a property. Further changes to the given slice
-// will be reflected in the property (this method does not make a copy).
+// SetValues sets the values of a property, which will have only a single
+// component. Further changes to the given slice will be reflected in the
+// property (this method does not make a copy).
 func (p *Property) SetValues(values ...string) {
-	p.values = values
+	p.components = [][]string{values}
+}
+
+// Components returns the components of a property, each containing one or
+// more values. For example, the value ";;100 Waters Edge;Baytown" has four
+// components, the first two of which are empty. Changes to the returned slice
+// will be reflected in the property.
+func (p *Property) Components() [][]string {
+	return p.components
+}
+
+// SetComponents sets the components of a property. Further changes to the
+// given slice will be reflected in the property (this method does not make
+// a copy).
+func (p *Property) SetComponents(components ...[]string) {
+	p.components = components
 }
 
-// writeParam writes a parameter to the given Writer.
+// writeProperty writes a property (without any line ending) to the given
+// Writer.
+func writeProperty(w io.Writer, name string, prop Property) {
+	if len(prop.group) != 0 {
+		fmt.Fprintf(w, "%v.", prop.group)
+	}
+	io.WriteString(w, name)
+	for _, key := range prop.paramOrder {
+		io.WriteString(w, ";")
+		writeParam(w, key, prop.params[key])
+	}
+	io.WriteString(w, ":")
+	writeComponents(w, prop.components)
+}
+
+// writeParam writes a parameter to the given Writer. Values are caret-encoded
+// (RFC 6868) and quoted if they contain any characters which would otherwise
+// be interpreted as delimiters.
 func writeParam(w io.Writer, key string, values []string) {
 	fmt.Fprintf(w, "%v=", key)
 	for i, value := range values {
 		if i != 0 {
 			fmt.Fprint(w, ",")
 		}
-		if strings.ContainsAny(value, ";:") {
+		value = encodeCaret(value)
+		if strings.ContainsAny(value, ";:,") {
 			fmt.Fprintf(w, `"%v"`, value)
 		} else {
 			fmt.Fprint(w, value)
@@ -148,12 +346,23 @@ func writeParam(w io.Writer, key string, values []string) {
 	}
 }
 
-// writeValue writes a series of property values, separated by commas, to
+// writeComponents writes a series of property components, separated by
+// semicolons, to the given Writer.
+func writeComponents(w io.Writer, components [][]string) {
+	for i, values := range components {
+		if i != 0 {
+			io.WriteString(w, ";")
+		}
+		writeValues(w, values)
+	}
+}
+
+// writeValues writes a series of property values, separated by commas, to
 // the given Writer.
 func writeValues(w io.Writer, values []string) {
 	for i, value := range values {
 		if i != 0 {
-			fmt.Fprint(w, ",")
+			io.WriteString(w, ",")
 		}
 		writeValue(w, value)
 	}
@@ -162,49 +371,91 @@ func writeValues(w io.Writer, values []string) {
 // writeValue writes a property value to the given Writer, taking care of
 // escaping special characters.
 func writeValue(w io.Writer, value string) {
-	last := rune(-1)
-	for _, r := range value {
-		if last != -1 {
-			// We shouldn't escape the backslash before a semicolon.
-			if last == '\\' && r != ';' {
-				fmt.Fprint(w, `\\`)
-			} else if last == ',' {
-				fmt.Fprint(w, `\,`)
-			} else if last == '\n' {
-				fmt.Fprint(w, `\n`)
-			} else {
-				fmt.Fprintf(w, "%c", last)
-			}
+	start := 0
+	for i := 0; i < len(value); i++ {
+		var esc string
+		switch value[i] {
+		case '\\':
+			esc = `\\`
+		case ',':
+			esc = `\,`
+		case ';':
+			esc = `\;`
+		case '\n':
+			esc = `\n`
+		default:
+			continue
 		}
-		last = r
-	}
-	if last == '\\' {
-		fmt.Fprint(w, `\\`)
-	} else if last == ',' {
-		fmt.Fprint(w, `\,`)
-	} else if last == '\n' {
-		fmt.Fprint(w, `\n`)
-	} else {
-		fmt.Fprintf(w, "%c", last)
-	}
-}
+		io.WriteString(w, value[start:i])
+		io.WriteString(w, esc)
+		start = i + 1
+	}
+	io.WriteString(w, value[start:])
+}
+
+// The kinds of ParseError, which may be detected using errors.Is.
+var (
+	// ErrUnexpectedEOF means that the input ended in the middle of a card
+	// or property.
+	ErrUnexpectedEOF = errors.New("vcard: unexpected end of input")
+	// ErrExpectedBegin means that something other than "BEGIN:VCARD"
+	// appeared where a card should have begun.
+	ErrExpectedBegin = errors.New("vcard: expected beginning of card")
+	// ErrUnexpectedBegin means that a card began before the previous one
+	// ended. This is only reported as a diagnostic by a lenient parser.
+	ErrUnexpectedBegin = errors.New("vcard: unexpected beginning of card")
+	// ErrMalformedEnd means that the END property of a card was not exactly
+	// "END:VCARD".
+	ErrMalformedEnd = errors.New("vcard: malformed end of card")
+	// ErrSyntax means that a property was not syntactically valid.
+	ErrSyntax = errors.New("vcard: syntax error")
+	// ErrInvalidEscape means that a property value contained an escape
+	// sequence which is not allowed.
+	ErrInvalidEscape = errors.New("vcard: invalid escape sequence")
+	// ErrEncoding means that a property value could not be decoded
+	// according to its ENCODING or CHARSET parameter.
+	ErrEncoding = errors.New("vcard: invalid encoding")
+	// ErrIO means that the underlying reader returned an error, which is
+	// available using errors.As or errors.Unwrap.
+	ErrIO = errors.New("vcard: error reading input")
+)
 
 // ParseError is the error type returned when an error occurs during parsing.
+// Its kind, given by one of the Err variables above, can be checked using
+// errors.Is.
 type ParseError struct {
-	Line int // the line on which the error occurred
-	msg  string
+	Line     int    // the line on which the error occurred
+	Column   int    // the column (in bytes, starting from 1) within the line
+	Offset   int64  // the offset (in bytes) of the error in the input
+	Property string // the name of the property being parsed, if any
+	Kind     error  // the kind of error
+	Err      error  // the underlying error (for ErrIO), if any
+	msg      string
 }
 
 func (p ParseError) Error() string {
-	return fmt.Sprintf("on line %v: %v", p.Line, p.msg)
+	return fmt.Sprintf("on line %v: %v", p.Line, p.Message())
 }
 
 // Message returns the error message returned by Error without any line
 // information.
 func (p ParseError) Message() string {
+	if p.msg == "" && p.Err != nil {
+		return p.Err.Error()
+	}
 	return p.msg
 }
 
+// Is returns whether the kind of the error is the given error.
+func (p ParseError) Is(target error) bool {
+	return target == p.Kind
+}
+
+// Unwrap returns the underlying error, if any.
+func (p ParseError) Unwrap() error {
+	return p.Err
+}
+
 // ParseAll parses as many vCards from the given input as possible, until EOF
 // is reached or a parsing error occurs. If parsing fails at any point, the
 // returned slice will contain any cards that were successfully parsed
@@ -213,8 +464,8 @@ func (p ParseError) Message() string {
 // This function is equivalent to wrapping the reader in a bufio.Reader (for
 // efficiency), creating a Parser and repeatedly calling the Next method until
 // it fails. Thus, it is sensitive to minor details like empty lines in a file
-// (which will cause a parsing error); for more control over such details, use
-// a Parser directly.
+// (which will cause a parsing error); to recover from such details, use a
+// Parser directly and enable lenient parsing using SetLenient.
 func ParseAll(r io.Reader) ([]*Card, error) {
 	var cards []*Card
 	p := NewParser(bufio.NewReader(r))
@@ -232,7 +483,13 @@ func ParseAll(r io.Reader) ([]*Card, error) {
 // Parser is a parser for vCard data that reads a series of cards from an
 // underlying reader.
 type Parser struct {
-	r *UnfoldingReader
+	r           *UnfoldingReader
+	compat21    bool
+	lenient     bool
+	inCard      bool         // whether the beginning of the next card was already parsed
+	version     string       // the VERSION of the card being parsed, if known
+	property    string       // the name of the property being parsed
+	diagnostics []ParseError // the problems recovered from by a lenient parser
 }
 
 // NewParser returns a new parser that takes data from a reader. The parser
@@ -242,50 +499,111 @@ func NewParser(r io.Reader) *Parser {
 	return &Parser{r: NewUnfoldingReader(r)}
 }
 
-// Next parses and returns the next available card.
+// Next parses and returns the next available card. If there are no more cards
+// in the input, the error is io.EOF; otherwise, any error is a ParseError.
 func (p *Parser) Next() (*Card, error) {
+	card, err := p.next()
+	if _, ok := err.(ParseError); !ok && err != nil && err != io.EOF {
+		perr := p.errorAt(p.position(), ErrIO, "")
+		perr.Err = err
+		err = perr
+	}
+	return card, err
+}
+
+// next implements Next, returning errors from the underlying reader without
+// wrapping them.
+func (p *Parser) next() (*Card, error) {
 	card := &Card{m: make(map[string][]Property)}
+	p.version = ""
 
-	line := p.r.Line()
-	name, prop, err := p.parseProperty()
-	if err != nil {
+	if p.inCard {
+		// We already parsed the beginning of this card while parsing
+		// the previous one.
+		p.inCard = false
+	} else if err := p.parseBegin(); err != nil {
 		return &Card{}, err
-	} else if name != "BEGIN" || len(prop.group) != 0 || len(prop.params) != 0 ||
-		len(prop.values) != 1 || strings.ToUpper(prop.values[0]) != "VCARD" {
-		return &Card{}, ParseError{line, "expected beginning of card"}
 	}
 
-	line = p.r.Line()
-	name, prop, err = p.parseProperty()
-	for err == nil {
+	for {
+		if err := p.skipBlankLines(); err != nil {
+			return &Card{}, err
+		}
+		pos := p.position()
+		start := p.r.unfoldedOffset
+		name, prop, err := p.parseProperty()
+		if err == io.EOF {
+			err := p.errorAt(p.position(), ErrUnexpectedEOF, "unexpected end of input before ending card")
+			if !p.lenient {
+				return &Card{}, err
+			}
+			p.warn(err)
+			return card, nil
+		} else if err != nil {
+			if err := p.skipInvalid(err, start); err != nil {
+				return &Card{}, err
+			}
+			continue
+		}
+
 		if name == "END" {
 			if len(prop.group) != 0 || len(prop.params) != 0 ||
-				len(prop.values) != 1 || strings.ToUpper(prop.values[0]) != "VCARD" {
-				return &Card{}, ParseError{line, "malformed end tag"}
+				!isVCardValue(prop.components) {
+				err := p.errorAt(pos, ErrMalformedEnd, "malformed end tag")
+				if !p.lenient {
+					return &Card{}, err
+				}
+				p.warn(err)
 			}
 			return card, nil
+		} else if name == "BEGIN" && p.lenient && isVCardValue(prop.components) {
+			p.warn(p.errorAt(pos, ErrUnexpectedBegin, "unexpected beginning of card before ending card"))
+			p.inCard = true
+			return card, nil
 		}
-		card.m[name] = append(card.m[name], prop)
-
-		line = p.r.Line()
-		name, prop, err = p.parseProperty()
+		if name == "VERSION" {
+			p.version = prop.text()
+		}
+		card.Add(name, prop)
 	}
+}
 
-	if err == io.EOF {
-		return &Card{}, ParseError{p.r.Line(), "unexpected end of input before ending card"}
+// parseBegin parses the property which begins a card. If the parser is
+// lenient, it will skip over any lines before the beginning of the card.
+func (p *Parser) parseBegin() error {
+	for {
+		if err := p.skipBlankLines(); err != nil {
+			return err
+		}
+		pos := p.position()
+		start := p.r.unfoldedOffset
+		name, prop, err := p.parseProperty()
+		if err == nil {
+			if name == "BEGIN" && len(prop.group) == 0 && len(prop.params) == 0 &&
+				isVCardValue(prop.components) {
+				return nil
+			}
+			err = p.errorAt(pos, ErrExpectedBegin, "expected beginning of card")
+		} else if err == io.EOF {
+			return err
+		}
+		if err := p.skipInvalid(err, start); err != nil {
+			return err
+		}
 	}
-	return &Card{}, err
 }
 
 // parseProperty parses a single property.
 func (p *Parser) parseProperty() (name string, prop Property, err error) {
 	// Parse name (or group).
+	p.property = ""
 	nm, err := p.parseName("expected property name")
 	if err != nil {
 		return "", Property{}, err
 	}
+	p.property = nm
 
-	line := p.r.Line()
+	pos := p.position()
 	b, err := p.demandByte("expected ';' or ':'")
 	if err != nil {
 		return "", Property{}, err
@@ -297,7 +615,8 @@ func (p *Parser) parseProperty() (name string, prop Property, err error) {
 		if err != nil {
 			return "", Property{}, err
 		}
-		line = p.r.Line()
+		p.property = nm
+		pos = p.position()
 		b, err = p.demandByte("expected ';' or ':'")
 	}
 	name = nm
@@ -307,12 +626,10 @@ func (p *Parser) parseProperty() (name string, prop Property, err error) {
 	}
 	if b == ';' {
 		// Parse any parameters.
-		params, err := p.parseParameters()
-		if err != nil {
+		if err := p.parseParameters(&prop); err != nil {
 			return "", Property{}, err
 		}
-		prop.params = params
-		line = p.r.Line()
+		pos = p.position()
 		b, err = p.demandByte("expected ':'")
 	}
 
@@ -320,16 +637,19 @@ func (p *Parser) parseProperty() (name string, prop Property, err error) {
 		return "", Property{}, err
 	}
 	if b != ':' {
-		return "", Property{}, ParseError{line, "expected ':'"}
+		return "", Property{}, p.errorAt(pos, ErrSyntax, "expected ':'")
 	}
 
-	values, err := p.parsePropertyValues()
+	if p.compat21 {
+		prop.components, err = p.parsePropertyComponents21(&prop)
+	} else {
+		prop.components, err = p.parsePropertyComponents()
+	}
 	if err != nil {
 		return "", Property{}, err
 	}
-	prop.values = values
 
-	line = p.r.Line()
+	pos = p.position()
 	b, err = p.r.ReadByte()
 	if err == io.EOF {
 		return name, prop, nil
@@ -337,27 +657,38 @@ func (p *Parser) parseProperty() (name string, prop Property, err error) {
 		return "", Property{}, err
 	}
 	if b != '\n' {
-		return "", Property{}, ParseError{line, fmt.Sprintf("unexpected character %q after property value", b)}
+		return "", Property{}, p.errorAt(pos, ErrSyntax, fmt.Sprintf("unexpected character %q after property value", b))
 	}
 	return name, prop, nil
 }
 
-// parsePropertyValues parses several property values, separated by commas.
-func (p *Parser) parsePropertyValues() ([]string, error) {
+// isVCardValue returns whether the given property components are the single
+// value "VCARD" (case-insensitively), as used by BEGIN and END.
+func isVCardValue(components [][]string) bool {
+	return len(components) == 1 && len(components[0]) == 1 &&
+		strings.ToUpper(components[0][0]) == "VCARD"
+}
+
+// parsePropertyComponents parses several property components, separated by
+// semicolons, each consisting of one or more values separated by commas.
+func (p *Parser) parsePropertyComponents() ([][]string, error) {
+	var components [][]string
 	var values []string
 
 	value, err := p.parsePropertyValue()
 	for err == nil {
 		values = append(values, value)
 		b, err := p.r.PeekByte()
-		if err == io.EOF {
-			return values, nil
-		} else if err != nil {
+		if err != nil && err != io.EOF {
 			return nil, err
-		} else if b != ',' {
-			return values, nil
+		} else if err == io.EOF || (b != ',' && b != ';') {
+			return append(components, values), nil
 		}
 		p.r.ReadByte()
+		if b == ';' {
+			components = append(components, values)
+			values = nil
+		}
 		value, err = p.parsePropertyValue()
 	}
 	return nil, err
@@ -376,20 +707,11 @@ func (p *Parser) parsePropertyValue() (string, error) {
 		}
 		p.r.ReadByte()
 		if b == '\\' {
-			line := p.r.Line()
-			b2, err := p.demandByte("expected escaped character")
+			escaped, err := p.parseEscape()
 			if err != nil {
 				return "", err
 			}
-			if b2 == ',' || b2 == '\\' || b2 == ':' {
-				bs = append(bs, b2)
-			} else if b2 == 'n' {
-				bs = append(bs, '\n')
-			} else if b2 == ';' {
-				bs = append(bs, '\\', ';')
-			} else {
-				return "", ParseError{line, fmt.Sprintf("%q cannot be escaped", b2)}
-			}
+			bs = append(bs, escaped...)
 		} else {
 			bs = append(bs, b)
 		}
@@ -401,33 +723,64 @@ func (p *Parser) parsePropertyValue() (string, error) {
 	return "", err
 }
 
+// parseEscape parses the character following a backslash in a property value,
+// returning the bytes it represents. If the parser is lenient, invalid escapes
+// are kept as they are, including the backslash.
+func (p *Parser) parseEscape() ([]byte, error) {
+	pos := p.position()
+	if p.lenient {
+		b, err := p.r.PeekByte()
+		if err != nil && err != io.EOF {
+			return nil, err
+		} else if err == io.EOF || b == '\n' {
+			p.warn(p.errorAt(pos, ErrInvalidEscape, "expected escaped character"))
+			return []byte{'\\'}, nil
+		}
+	}
+
+	b, err := p.demandByte("expected escaped character")
+	if err != nil {
+		return nil, err
+	}
+	switch b {
+	case ',', ';', '\\', ':':
+		return []byte{b}, nil
+	case 'n', 'N':
+		return []byte{'\n'}, nil
+	}
+	perr := p.errorAt(pos, ErrInvalidEscape, fmt.Sprintf("%q cannot be escaped", b))
+	if !p.lenient {
+		return nil, perr
+	}
+	p.warn(perr)
+	return []byte{'\\', b}, nil
+}
+
 // isValueChar returns whether the given byte may be present in a property
-// value.
+// value (other than as a separator between values or components).
 func isValueChar(b byte) bool {
-	return b == '\t' || (' ' <= b && b != ',')
+	return b == '\t' || (' ' <= b && b != ',' && b != ';')
 }
 
-// parseParameters parses a set of property parameters. Since parameters are
-// optional, both the map and error returned from this method may be nil.
-func (p *Parser) parseParameters() (map[string][]string, error) {
-	params := make(map[string][]string)
-
+// parseParameters parses a set of property parameters, adding them to the
+// given property in the order they appear.
+func (p *Parser) parseParameters(prop *Property) error {
 	key, values, err := p.parseParameter()
 	for err == nil {
-		params[key] = append(params[key], values...)
+		prop.addParam(key, values...)
 
 		b, err := p.r.PeekByte()
 		if err == io.EOF {
-			return params, nil
+			return nil
 		} else if err != nil {
-			return nil, err
+			return err
 		} else if b != ';' {
-			return params, nil
+			return nil
 		}
 		p.r.ReadByte()
 		key, values, err = p.parseParameter()
 	}
-	return nil, err
+	return err
 }
 
 // parseParameter parses a single property parameter. If the returned error
@@ -439,13 +792,21 @@ func (p *Parser) parseParameter() (key string, values []string, err error) {
 	}
 	key = strings.ToUpper(key)
 
+	if p.compat21 {
+		// vCard 2.1 allows parameter values to appear without a name.
+		b, err := p.r.PeekByte()
+		if err == nil && (b == ';' || b == ':') {
+			return paramName21(key), []string{key}, nil
+		}
+	}
+
 	msg := fmt.Sprintf("expected '=' after parameter name %v", key)
-	line := p.r.Line()
+	pos := p.position()
 	b, err := p.demandByte(msg)
 	if err != nil {
 		return "", nil, err
 	} else if b != '=' {
-		return "", nil, ParseError{line, msg}
+		return "", nil, p.errorAt(pos, ErrSyntax, msg)
 	}
 
 	value, err := p.parseParameterValue()
@@ -465,9 +826,10 @@ func (p *Parser) parseParameter() (key string, values []string, err error) {
 	return "", nil, err
 }
 
-// parseParameterValue parses a single property parameter value. The returned
-// string may be empty even if the error is non-nil, since parameter values
-// may be empty.
+// parseParameterValue parses a single property parameter value, decoding any
+// caret escapes (RFC 6868) unless the parser is in vCard 2.1 compatibility
+// mode. The returned string may be empty even if the error is non-nil, since
+// parameter values may be empty.
 func (p *Parser) parseParameterValue() (string, error) {
 	b, err := p.r.PeekByte()
 	if err == io.EOF {
@@ -476,11 +838,17 @@ func (p *Parser) parseParameterValue() (string, error) {
 		return "", err
 	}
 
+	var value string
 	if b == '"' {
 		p.r.ReadByte()
-		return p.parseQuotedParameterValue()
+		value, err = p.parseQuotedParameterValue()
+	} else {
+		value, err = p.parseUnquotedParameterValue()
+	}
+	if !p.compat21 {
+		value = decodeCaret(value)
 	}
-	return p.parseUnquotedParameterValue()
+	return value, err
 }
 
 // parseQuotedParameterValue parses the inner part of a paramter enclosed in
@@ -488,23 +856,23 @@ func (p *Parser) parseParameterValue() (string, error) {
 func (p *Parser) parseQuotedParameterValue() (string, error) {
 	var bs []byte
 
-	line := p.r.Line()
+	pos := p.position()
 	b, err := p.r.ReadByte()
 	for err == nil {
 		if b == '"' {
 			return string(bs), nil
 		} else if !isQuoteSafeChar(b) {
-			return "", ParseError{line, fmt.Sprintf("unexpected byte %q in quoted parameter value", b)}
+			return "", p.errorAt(pos, ErrSyntax, fmt.Sprintf("unexpected byte %q in quoted parameter value", b))
 		}
 		bs = append(bs, b)
-		line = p.r.Line()
+		pos = p.position()
 		b, err = p.r.ReadByte()
 	}
 
 	if err != nil && err != io.EOF {
 		return "", err
 	}
-	return "", ParseError{line, "unexpected end of quoted parameter value"}
+	return "", p.errorAt(pos, ErrUnexpectedEOF, "unexpected end of quoted parameter value")
 }
 
 // isQuoteSafeChar returns whether the given byte may appear within a quoted
@@ -548,7 +916,7 @@ func isSafeChar(b byte) bool {
 func (p *Parser) parseName(missing string) (string, error) {
 	var bs []byte
 
-	line := p.r.Line()
+	pos := p.position()
 	b, err := p.r.PeekByte()
 	for err == nil {
 		if ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9') || b == '-' {
@@ -560,25 +928,41 @@ func (p *Parser) parseName(missing string) (string, error) {
 			break
 		}
 		p.r.ReadByte()
-		line = p.r.Line()
+		pos = p.position()
 		b, err = p.r.PeekByte()
 	}
 
 	if err != nil {
 		return string(bs), err
 	} else if len(bs) == 0 {
-		return "", ParseError{line, missing}
+		return "", p.errorAt(pos, ErrSyntax, missing)
 	}
 	return string(bs), nil
 }
 
 // demandByte reads the next byte according to readByte, but converts an EOF
-// error into a ParseError wrapping the given string.
+// error into a ParseError describing what was missing.
 func (p *Parser) demandByte(missing string) (b byte, err error) {
-	line := p.r.Line()
+	pos := p.position()
 	b, err = p.r.ReadByte()
 	if err == io.EOF {
-		return 0, ParseError{line, err.Error()}
+		return 0, p.errorAt(pos, ErrUnexpectedEOF, "unexpected end of input: "+missing)
 	}
 	return
 }
+
+// position is a position in the input, as reported in a ParseError.
+type position struct {
+	line, column int
+	offset       int64
+}
+
+// position returns the position of the next byte to be read.
+func (p *Parser) position() position {
+	return position{p.r.Line(), p.r.Column(), p.r.Offset()}
+}
+
+// errorAt returns a ParseError of the given kind at the given position.
+func (p *Parser) errorAt(pos position, kind error, msg string) ParseError {
+	return ParseError{pos.line, pos.column, pos.offset, p.property, kind, nil, msg}
+}
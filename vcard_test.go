@@ -1,6 +1,7 @@
 package vcard
 
 import (
+	"errors"
 	"io"
 	"reflect"
 	"strings"
@@ -25,67 +26,79 @@ EMAIL:forrestgump@example.com
 REV:2008-04-24T19:52:43Z
 END:VCARD`
 
-var sampleVCardParsed = &Card{map[string][]Property{
-	"VERSION": {{values: []string{"3.0"}}},
-	"N":       {{values: []string{"Gump;Forrest;;Mr.;"}}},
-	"FN":      {{values: []string{"Forrest Gump"}}},
-	"ORG":     {{values: []string{"Bubba Gump Shrimp Co."}}},
-	"TITLE":   {{values: []string{"Shrimp Man"}}},
-	"PHOTO": {{
-		params: map[string][]string{
-			"VALUE": {"URI"},
-			"TYPE":  {"GIF"},
-		},
-		values: []string{"http://www.example.com/dir_photos/my_photo.gif"},
-	}},
-	"TEL": {{
-		params: map[string][]string{
-			"TYPE": {"WORK", "VOICE"},
-		},
-		values: []string{"(111) 555-1212"},
-	}, {
-		params: map[string][]string{
-			"TYPE": {"HOME", "VOICE"},
-		},
-		values: []string{"(404) 555-1212"},
-	}},
-	"ADR": {{
-		params: map[string][]string{
-			"TYPE": {"WORK", "PREF"},
-		},
-		values: []string{
-			";;100 Waters Edge;Baytown;LA;30314;United States of America",
-		},
-	}, {
-		params: map[string][]string{
-			"TYPE": {"HOME"},
-		},
-		values: []string{
-			";;42 Plantation St.;Baytown;LA;30314;United States of America",
-		},
-	}},
-	"LABEL": {{
-		params: map[string][]string{
-			"TYPE": {"WORK", "PREF"},
-		},
-		values: []string{
-			"100 Waters Edge\nBaytown, LA 30314\nUnited States of America",
-		},
-	}, {
-		params: map[string][]string{
-			"TYPE": {"HOME"},
-		},
-		values: []string{
-			"42 Plantation St.\nBaytown, LA 30314\nUnited States of America",
-		},
-	}},
-	"EMAIL": {{
-		values: []string{"forrestgump@example.com"},
-	}},
-	"REV": {{
-		values: []string{"2008-04-24T19:52:43Z"},
-	}},
-}}
+var sampleVCardParsed = &Card{
+	m: map[string][]Property{
+		"VERSION": {{components: [][]string{{"3.0"}}}},
+		"N":       {{components: [][]string{{"Gump"}, {"Forrest"}, {""}, {"Mr."}, {""}}}},
+		"FN":      {{components: [][]string{{"Forrest Gump"}}}},
+		"ORG":     {{components: [][]string{{"Bubba Gump Shrimp Co."}}}},
+		"TITLE":   {{components: [][]string{{"Shrimp Man"}}}},
+		"PHOTO": {{
+			params: map[string][]string{
+				"VALUE": {"URI"},
+				"TYPE":  {"GIF"},
+			},
+			paramOrder: []string{"VALUE", "TYPE"},
+			components: [][]string{{"http://www.example.com/dir_photos/my_photo.gif"}},
+		}},
+		"TEL": {{
+			params: map[string][]string{
+				"TYPE": {"WORK", "VOICE"},
+			},
+			paramOrder: []string{"TYPE"},
+			components: [][]string{{"(111) 555-1212"}},
+		}, {
+			params: map[string][]string{
+				"TYPE": {"HOME", "VOICE"},
+			},
+			paramOrder: []string{"TYPE"},
+			components: [][]string{{"(404) 555-1212"}},
+		}},
+		"ADR": {{
+			params: map[string][]string{
+				"TYPE": {"WORK", "PREF"},
+			},
+			paramOrder: []string{"TYPE"},
+			components: [][]string{
+				{""}, {""}, {"100 Waters Edge"}, {"Baytown"}, {"LA"}, {"30314"},
+				{"United States of America"},
+			},
+		}, {
+			params: map[string][]string{
+				"TYPE": {"HOME"},
+			},
+			paramOrder: []string{"TYPE"},
+			components: [][]string{
+				{""}, {""}, {"42 Plantation St."}, {"Baytown"}, {"LA"}, {"30314"},
+				{"United States of America"},
+			},
+		}},
+		"LABEL": {{
+			params: map[string][]string{
+				"TYPE": {"WORK", "PREF"},
+			},
+			paramOrder: []string{"TYPE"},
+			components: [][]string{{
+				"100 Waters Edge\nBaytown, LA 30314\nUnited States of America",
+			}},
+		}, {
+			params: map[string][]string{
+				"TYPE": {"HOME"},
+			},
+			paramOrder: []string{"TYPE"},
+			components: [][]string{{
+				"42 Plantation St.\nBaytown, LA 30314\nUnited States of America",
+			}},
+		}},
+		"EMAIL": {{
+			components: [][]string{{"forrestgump@example.com"}},
+		}},
+		"REV": {{
+			components: [][]string{{"2008-04-24T19:52:43Z"}},
+		}},
+	},
+	order: []string{"VERSION", "N", "FN", "ORG", "TITLE", "PHOTO", "TEL", "TEL", "ADR", "LABEL", "ADR", "LABEL", "EMAIL", "REV"},
+}
 
 func BenchmarkUnfoldedString(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -100,37 +113,105 @@ func BenchmarkParseAll(b *testing.B) {
 }
 
 func TestUnfoldedString(t *testing.T) {
-	// We need to trim the final newline (if any) so it doesn't show up as
-	// a property in the list of lines.
-	expectedLines := strings.Split(strings.TrimRight(sampleVCard, "\r\n"), "\n")
-	unfolded := sampleVCardParsed.UnfoldedString()
-	actualLines := strings.Split(strings.TrimRight(unfolded, "\r\n"), "\n")
+	expected := strings.TrimRight(sampleVCard, "\r\n") + "\n"
+	if unfolded := sampleVCardParsed.UnfoldedString(); unfolded != expected {
+		t.Fatalf("got %q, want %q", unfolded, expected)
+	}
+}
+
+func TestUnfoldedStringOrder(t *testing.T) {
+	card := new(Card)
+	card.Add("X-B", Property{components: [][]string{{"1"}}})
+	card.Add("X-A", Property{components: [][]string{{"2"}}})
+	card.Add("VERSION", Property{components: [][]string{{"4.0"}}})
+	prop := Property{components: [][]string{{"3"}}}
+	prop.SetParam("Z", "z")
+	prop.SetParam("Y", "y")
+	prop.SetParam("Z", "z2")
+	card.Add("X-B", prop)
+
+	const expected = "BEGIN:VCARD\nVERSION:4.0\nX-B:1\nX-A:2\nX-B;Z=z2;Y=y:3\nEND:VCARD\n"
+	if unfolded := card.UnfoldedString(); unfolded != expected {
+		t.Fatalf("got %q, want %q", unfolded, expected)
+	}
+}
 
-	if len(actualLines) != len(expectedLines) {
-		t.Fatalf("got %v lines, want %v", len(actualLines), len(expectedLines))
+func TestCardEdit(t *testing.T) {
+	card := parseCard(t, "BEGIN:VCARD\nFN:John Doe\nEMAIL:a@example.com\nVERSION:4.0\nTEL:1\nEMAIL:b@example.com\nNOTE:x\nEMAIL:c@example.com\nEND:VCARD")
+	if got, want := card.Len(), 7; got != want {
+		t.Errorf("Len: got %v, want %v", got, want)
+	}
+	if got, want := card.Names(), []string{"VERSION", "FN", "EMAIL", "TEL", "NOTE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names: got %q, want %q", got, want)
+	}
+
+	if card.RemoveAt("email", 3) || card.RemoveAt("email", -1) || card.RemoveAt("X-NONE", 0) {
+		t.Error("RemoveAt: removed nonexistent occurrence")
+	}
+	if !card.RemoveAt("email", 1) {
+		t.Error("RemoveAt: did not remove existing occurrence")
+	}
+	var prop Property
+	prop.SetValues("d@example.com")
+	if !card.SetAt("EMAIL", 1, prop) || card.SetAt("EMAIL", 2, prop) {
+		t.Error("SetAt: unexpected result")
+	}
+	prop.SetValues("2")
+	card.Set("tel", prop)
+	card.Remove("NOTE")
+	prop.SetValues("work")
+	card.Set("ROLE", prop)
+
+	want := "BEGIN:VCARD\nVERSION:4.0\nFN:John Doe\nEMAIL:a@example.com\nTEL:2\nEMAIL:d@example.com\nROLE:work\nEND:VCARD\n"
+	if got := card.UnfoldedString(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := card.Len(), 6; got != want {
+		t.Errorf("Len: got %v, want %v", got, want)
 	}
+}
 
-	// The BEGIN, VERSION and END properties should be the same.
-	if actualLines[0] != expectedLines[0] {
-		t.Fatalf("got begin %q, want %q", actualLines[0], expectedLines[0])
+func TestCardAll(t *testing.T) {
+	card := parseCard(t, "BEGIN:VCARD\nFN:John Doe\nEMAIL:a@example.com\nVERSION:4.0\nEMAIL:b@example.com\nNOTE:x\nEND:VCARD")
+	var got []string
+	for name, prop := range card.All() {
+		got = append(got, name+":"+prop.Components()[0][0])
+		// Removing properties during iteration must not disturb it.
+		card.Remove(name)
 	}
-	if actualLines[1] != expectedLines[1] {
-		t.Fatalf("got version %q, want %q", actualLines[1], expectedLines[1])
+	want := []string{"VERSION:4.0", "FN:John Doe", "EMAIL:a@example.com", "EMAIL:b@example.com", "NOTE:x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("All: got %q, want %q", got, want)
 	}
-	if actualLines[len(actualLines)-1] != expectedLines[len(expectedLines)-1] {
-		t.Fatalf("got end %q, want %q", actualLines[len(actualLines)-1], expectedLines[len(expectedLines)-1])
+	if card.Len() != 0 {
+		t.Errorf("Len after removing everything: got %v, want 0", card.Len())
 	}
 
-	// For the rest, the order doesn't matter. We checked equal lengths
-	// above, so this is sufficient to check full equality.
-	for _, line := range expectedLines {
-		for _, actualLine := range actualLines {
-			if line == actualLine {
-				goto found
-			}
+	card = parseCard(t, "BEGIN:VCARD\nEMAIL:a@example.com\nFN:John Doe\nEMAIL:b@example.com\nEMAIL:c@example.com\nEND:VCARD")
+	got = nil
+	for i, prop := range card.Occurrences("email") {
+		if i == 2 {
+			break
+		}
+		got = append(got, prop.Components()[0][0])
+		card.RemoveAt("EMAIL", 0)
+	}
+	want = []string{"a@example.com", "b@example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Occurrences: got %q, want %q", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := Fold(strings.TrimRight(sampleVCard, "\r\n")+"\n", 77)
+	cards, err := ParseAll(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if out := cards[0].String(); out != in {
+			t.Fatalf("got %q, want %q", out, in)
 		}
-		t.Fatalf("wanted line %q but not found", line)
-	found:
 	}
 }
 
@@ -140,140 +221,195 @@ var successTests = []struct {
 }{
 	{
 		"BEGIN:VCARD\r\nPROP:value\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEG\r\n IN\r\n :VCARD\r\nPROP:va\r\n lue\r\nEND:\r\n VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP:value\r\nEND:VCARD",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"begin:vCard\r\nprop:value\r\nend:vCard\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"begin:vcard\nprop:value\nend:vcard\n",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"begin:vcard\npr\n op:\n value\nend:vcard\n",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"begin:vcard\nprop:value\nend:vcard",
-		&Card{map[string][]Property{
-			"PROP": {{values: []string{"value"}}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{components: [][]string{{"value"}}}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP:value\r\nPROP:value2\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {
-				{values: []string{"value"}},
-				{values: []string{"value2"}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {
+					{components: [][]string{{"value"}}},
+					{components: [][]string{{"value2"}}},
+				},
 			},
-		}},
+			order: []string{"PROP", "PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP-1;PARAM=test:value\r\nprop-2;param=\"test\":value2\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP-1": {{
-				params: map[string][]string{"PARAM": {"test"}},
-				values: []string{"value"},
-			}},
-			"PROP-2": {{
-				params: map[string][]string{"PARAM": {"test"}},
-				values: []string{"value2"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP-1": {{
+					params:     map[string][]string{"PARAM": {"test"}},
+					paramOrder: []string{"PARAM"},
+					components: [][]string{{"value"}},
+				}},
+				"PROP-2": {{
+					params:     map[string][]string{"PARAM": {"test"}},
+					paramOrder: []string{"PARAM"},
+					components: [][]string{{"value2"}},
+				}},
+			},
+			order: []string{"PROP-1", "PROP-2"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nX-PROP;PARAM=test;PARAM2=test2,\"hello,there\":value\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"X-PROP": {{
-				params: map[string][]string{
-					"PARAM":  {"test"},
-					"PARAM2": {"test2", "hello,there"},
-				},
-				values: []string{"value"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"X-PROP": {{
+					params: map[string][]string{
+						"PARAM":  {"test"},
+						"PARAM2": {"test2", "hello,there"},
+					},
+					paramOrder: []string{"PARAM", "PARAM2"},
+					components: [][]string{{"value"}},
+				}},
+			},
+			order: []string{"X-PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nX-PROP;PARAM=test;PARAM=test2,\"hello,there\":value\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"X-PROP": {{
-				params: map[string][]string{
-					"PARAM": {"test", "test2", "hello,there"},
-				},
-				values: []string{"value"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"X-PROP": {{
+					params: map[string][]string{
+						"PARAM": {"test", "test2", "hello,there"},
+					},
+					paramOrder: []string{"PARAM"},
+					components: [][]string{{"value"}},
+				}},
+			},
+			order: []string{"X-PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP:value1,value2\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{
-				values: []string{"value1", "value2"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{
+					components: [][]string{{"value1", "value2"}},
+				}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP:value1\\,\\:value2\\\\,\\\\,\\;;\\;\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{
-				values: []string{"value1,:value2\\", "\\", "\\;;\\;"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{
+					components: [][]string{{"value1,:value2\\", "\\", ";"}, {";"}},
+				}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP:\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{
-				values: []string{""},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{
+					components: [][]string{{""}},
+				}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nPROP:multiple\\nlines\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{
-				values: []string{"multiple\nlines"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{
+					components: [][]string{{"multiple\nlines"}},
+				}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nGROUP.PROP:value\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{
-				group:  "GROUP",
-				values: []string{"value"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{
+					group:      "GROUP",
+					components: [][]string{{"value"}},
+				}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{
 		"BEGIN:VCARD\r\nGroup.Prop:value\r\nEND:VCARD\r\n",
-		&Card{map[string][]Property{
-			"PROP": {{
-				group:  "GROUP",
-				values: []string{"value"},
-			}},
-		}},
+		&Card{
+			m: map[string][]Property{
+				"PROP": {{
+					group:      "GROUP",
+					components: [][]string{{"value"}},
+				}},
+			},
+			order: []string{"PROP"},
+		},
 	},
 	{sampleVCard, sampleVCardParsed},
 }
@@ -313,17 +449,19 @@ var failureTests = []struct {
 	in   string
 	line int
 	msg  string
+	kind error
 }{
-	{"PROP:VALUE\r\nEND:VCARD", 1, "expected beginning of card"},
-	{"BEGIN:VCARD\r\n", 2, "unexpected end of input"},
-	{"BEGIN:VCARD\r\nEND:SOMETHING\r\n", 2, "malformed end tag"},
-	{" BAD\r\n", 1, "expected property name"},
-	{"BEGIN:VCARD\r\nPROP\r\nEND:VCARD\r\n", 2, "expected ':'"},
-	{"BEGIN:VCARD\r\nPROP=2\r\nEND:VCARD\r\n", 2, "expected ':'"},
-	{"BEGIN:VCARD\r\nPROP;:2\r\nEND:VCARD\r\n", 2, "expected parameter name"},
-	{"BEGIN:VCARD\r\nPROP;PARAM:2\r\nEND:VCARD\r\n", 2, "expected '=' after parameter name"},
-	{"BEGIN:VCARD\r\nPROP;PARAM=\"test\n\":2\r\nEND:VCARD\r\n", 2, "unexpected byte '\\n' in quoted parameter value"},
-	{"BEGIN:VCARD\r\nPROP:escape\\&\r\nEND:VCARD\r\n", 2, "'&' cannot be escaped"},
+	{"PROP:VALUE\r\nEND:VCARD", 1, "expected beginning of card", ErrExpectedBegin},
+	{"BEGIN:VCARD\r\n", 2, "unexpected end of input", ErrUnexpectedEOF},
+	{"BEGIN:VCARD\r\nEND:SOMETHING\r\n", 2, "malformed end tag", ErrMalformedEnd},
+	{" BAD\r\n", 1, "expected property name", ErrSyntax},
+	{"BEGIN:VCARD\r\nPROP\r\nEND:VCARD\r\n", 2, "expected ':'", ErrSyntax},
+	{"BEGIN:VCARD\r\nPROP=2\r\nEND:VCARD\r\n", 2, "expected ':'", ErrSyntax},
+	{"BEGIN:VCARD\r\nPROP;:2\r\nEND:VCARD\r\n", 2, "expected parameter name", ErrSyntax},
+	{"BEGIN:VCARD\r\nPROP;PARAM:2\r\nEND:VCARD\r\n", 2, "expected '=' after parameter name", ErrSyntax},
+	{"BEGIN:VCARD\r\nPROP;PARAM=\"test\n\":2\r\nEND:VCARD\r\n", 2, "unexpected byte '\\n' in quoted parameter value", ErrSyntax},
+	{"BEGIN:VCARD\r\nPROP;PARAM=\"test", 2, "unexpected end of quoted parameter value", ErrUnexpectedEOF},
+	{"BEGIN:VCARD\r\nPROP:escape\\&\r\nEND:VCARD\r\n", 2, "'&' cannot be escaped", ErrInvalidEscape},
 }
 
 func TestParseAllFailure(t *testing.T) {
@@ -340,5 +478,89 @@ func TestParseAllFailure(t *testing.T) {
 		if test.line != perr.Line || !strings.Contains(perr.Message(), test.msg) {
 			t.Errorf("ParseAll(%q) error %q, want %q on line %v", test.in, perr, test.msg, test.line)
 		}
+		if !errors.Is(err, test.kind) {
+			t.Errorf("ParseAll(%q) error %q has kind %v, want %v", test.in, perr, perr.Kind, test.kind)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	in := "BEGIN:VCARD\r\nFN:John\r\nGRP.NOTE;TYPE=work:bad \\x\r\nEND:VCARD\r\n"
+	_, err := ParseAll(strings.NewReader(in))
+	var perr ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("got error %v, want a ParseError", err)
+	}
+	want := ParseError{Line: 3, Column: 25, Offset: 46, Property: "NOTE", Kind: ErrInvalidEscape}
+	if perr.Line != want.Line || perr.Column != want.Column || perr.Offset != want.Offset ||
+		perr.Property != want.Property || perr.Kind != want.Kind {
+		t.Errorf("got error at line %v, column %v, offset %v, property %q, kind %v; want line %v, column %v, offset %v, property %q, kind %v",
+			perr.Line, perr.Column, perr.Offset, perr.Property, perr.Kind,
+			want.Line, want.Column, want.Offset, want.Property, want.Kind)
+	}
+	if in[perr.Offset] != 'x' {
+		t.Errorf("offset %v refers to %q, want 'x'", perr.Offset, in[perr.Offset])
+	}
+}
+
+var errRead = errors.New("read failed")
+
+// failingReader returns the bytes of a string and then fails with errRead.
+type failingReader struct {
+	s string
+}
+
+func (r *failingReader) Read(bs []byte) (int, error) {
+	if r.s == "" {
+		return 0, errRead
+	}
+	n := copy(bs, r.s)
+	r.s = r.s[n:]
+	return n, nil
+}
+
+func TestParseErrorIO(t *testing.T) {
+	p := NewParser(&failingReader{"BEGIN:VCARD\r\nFN:Jo"})
+	_, err := p.Next()
+	if !errors.Is(err, ErrIO) || !errors.Is(err, errRead) {
+		t.Fatalf("got error %v, want ErrIO wrapping %v", err, errRead)
+	}
+	if perr := err.(ParseError); perr.Line != 2 || perr.Property != "FN" {
+		t.Errorf("got error on line %v in property %q, want line 2 in FN", perr.Line, perr.Property)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	const in = "BEGIN:VCARD\nADR:;;100 Waters Edge;Baytown;LA;30314;USA\nORG:ABC\\, Inc.;North American Division;Marketing\nCATEGORIES:a\\;b,c\\\\d;e\nEND:VCARD\n"
+	cards, err := ParseAll(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	card := cards[0]
+
+	tests := []struct {
+		name       string
+		components [][]string
+	}{
+		{"ADR", [][]string{{""}, {""}, {"100 Waters Edge"}, {"Baytown"}, {"LA"}, {"30314"}, {"USA"}}},
+		{"ORG", [][]string{{"ABC, Inc."}, {"North American Division"}, {"Marketing"}}},
+		{"CATEGORIES", [][]string{{"a;b", "c\\d"}, {"e"}}},
+	}
+	for _, test := range tests {
+		if components := card.Get(test.name)[0].Components(); !reflect.DeepEqual(components, test.components) {
+			t.Errorf("%v components = %q, want %q", test.name, components, test.components)
+		}
+	}
+	if out := card.UnfoldedString(); out != in {
+		t.Errorf("got %q, want %q", out, in)
+	}
+
+	var prop Property
+	prop.SetComponents([]string{"Public"}, []string{"John"}, []string{"Quinlan", "Q;"}, nil, []string{"Esq."})
+	card = new(Card)
+	card.Add("N", prop)
+	const expected = "BEGIN:VCARD\nN:Public;John;Quinlan,Q\\;;;Esq.\nEND:VCARD\n"
+	if out := card.UnfoldedString(); out != expected {
+		t.Errorf("got %q, want %q", out, expected)
 	}
 }
@@ -0,0 +1,325 @@
+// Copyright 2018 Ian Johnson
+//
+// This file is part of vcard. Vcard is free software: you are free to use it
+// for any purpose, make modified versions and share it with others, subject
+// to the terms of the Apache license (version 2.0), a copy of which is
+// provided alongside this project.
+
+package vcard
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// XMLNamespace is the XML namespace of xCard elements.
+const XMLNamespace = "urn:ietf:params:xml:ns:vcard-4.0"
+
+// structuredComponents maps the names of structured properties to the names
+// of the elements used for their components in xCard.
+var structuredComponents = map[string][]string{
+	"N":            {"surname", "given", "additional", "prefix", "suffix"},
+	"ADR":          {"pobox", "ext", "street", "locality", "region", "code", "country"},
+	"GENDER":       {"sex", "identity"},
+	"CLIENTPIDMAP": {"sourceid", "uri"},
+}
+
+// paramValueTypes maps parameter names to the types of their values in
+// xCard. Parameters which are not listed here have text values.
+var paramValueTypes = map[string]string{
+	"PREF":     "integer",
+	"LANGUAGE": "language-tag",
+	"GEO":      "uri",
+}
+
+// xmlNode is a generic XML element, used as an intermediate representation
+// when encoding and decoding xCard.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []xmlNode  `xml:",any"`
+}
+
+// child returns the first child element with the given name, or nil if there
+// is none.
+func (n *xmlNode) child(name string) *xmlNode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// newXMLNode returns an xmlNode with the given name and text content.
+func newXMLNode(name, content string) xmlNode {
+	return xmlNode{XMLName: xml.Name{Local: name}, Content: content}
+}
+
+// WriteAllXML writes the given cards to w as an xCard document, as described
+// by RFC 6351.
+func WriteAllXML(w io.Writer, cards []*Card) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	start := xml.StartElement{
+		Name: xml.Name{Local: "vcards"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: XMLNamespace}},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, card := range cards {
+		if err := e.Encode(card); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// ParseAllXML parses all the cards in an xCard document, as described by
+// RFC 6351.
+func ParseAllXML(r io.Reader) ([]*Card, error) {
+	var doc struct {
+		XMLName xml.Name `xml:"vcards"`
+		Cards   []*Card  `xml:"vcard"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc.Cards, nil
+}
+
+// MarshalXML writes the card as an xCard vcard element. Property and
+// parameter names are written in lowercase, and consecutive properties in the
+// same group are written inside a group element. The VALUE parameter is not
+// written as a parameter, but is used as the name of the value element.
+func (c *Card) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	card := xmlNode{
+		XMLName: xml.Name{Local: "vcard"},
+		Attrs:   []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: XMLNamespace}},
+	}
+	version := c.text("VERSION")
+	var group *xmlNode
+	c.walk(func(name string, prop Property) error {
+		node := marshalPropertyXML(version, name, prop)
+		if prop.group == "" {
+			card.Children = append(card.Children, node)
+			group = nil
+			return nil
+		}
+		groupName := strings.ToLower(prop.group)
+		if group == nil || group.Attrs[0].Value != groupName {
+			card.Children = append(card.Children, xmlNode{
+				XMLName: xml.Name{Local: "group"},
+				Attrs:   []xml.Attr{{Name: xml.Name{Local: "name"}, Value: groupName}},
+			})
+			group = &card.Children[len(card.Children)-1]
+		}
+		group.Children = append(group.Children, node)
+		return nil
+	})
+	return e.Encode(card)
+}
+
+// marshalPropertyXML converts a single property of a card of the given
+// version to an XML element.
+func marshalPropertyXML(version, name string, prop Property) xmlNode {
+	node := xmlNode{XMLName: xml.Name{Local: strings.ToLower(name)}}
+
+	var params []xmlNode
+	for _, key := range prop.paramOrder {
+		if key == "VALUE" {
+			continue
+		}
+		typ := paramValueTypes[key]
+		if typ == "" {
+			typ = "text"
+		}
+		param := xmlNode{XMLName: xml.Name{Local: strings.ToLower(key)}}
+		for _, value := range prop.params[key] {
+			param.Children = append(param.Children, newXMLNode(typ, value))
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		node.Children = append(node.Children, xmlNode{
+			XMLName:  xml.Name{Local: "parameters"},
+			Children: params,
+		})
+	}
+
+	typ := ValueType(version, name, prop)
+	names := structuredComponents[strings.ToUpper(name)]
+	switch {
+	case typ == "unknown":
+		// Values of unknown type are written exactly as they would
+		// appear in vCard syntax.
+		sb := new(strings.Builder)
+		writeComponents(sb, prop.components)
+		node.Children = append(node.Children, newXMLNode(typ, sb.String()))
+	case typ != "text":
+		node.Children = append(node.Children, newXMLNode(typ, prop.joined()))
+	case names != nil && len(prop.components) <= len(names):
+		for i, values := range prop.components {
+			for _, value := range values {
+				node.Children = append(node.Children, newXMLNode(names[i], value))
+			}
+		}
+	case strings.ToUpper(name) == "ORG":
+		// Each component of ORG is written as a separate text element.
+		for i := range prop.components {
+			node.Children = append(node.Children, newXMLNode(typ, prop.component(i)))
+		}
+	case len(prop.components) > 1:
+		// Other properties have no way of representing several
+		// components in xCard, so we have to join them.
+		node.Children = append(node.Children, newXMLNode(typ, prop.joined()))
+	case len(prop.components) == 1:
+		for _, value := range prop.components[0] {
+			node.Children = append(node.Children, newXMLNode(typ, value))
+		}
+	default:
+		node.Children = append(node.Children, newXMLNode(typ, ""))
+	}
+	return node
+}
+
+// UnmarshalXML parses an xCard vcard element, replacing any existing
+// properties in the card. It is the inverse of MarshalXML: properties inside
+// a group element are given the corresponding group, and value types other
+// than the default for a property are stored in the VALUE parameter.
+func (c *Card) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var card xmlNode
+	if err := d.DecodeElement(&card, &start); err != nil {
+		return err
+	}
+
+	*c = Card{}
+	for _, node := range card.Children {
+		if node.XMLName.Local != "group" {
+			name, prop, err := unmarshalPropertyXML(c.text("VERSION"), node)
+			if err != nil {
+				return err
+			}
+			c.Add(name, prop)
+			continue
+		}
+
+		var group string
+		for _, attr := range node.Attrs {
+			if attr.Name.Local == "name" {
+				group = attr.Value
+			}
+		}
+		if group == "" {
+			return errors.New("vcard: xCard group without name")
+		}
+		for _, child := range node.Children {
+			name, prop, err := unmarshalPropertyXML(c.text("VERSION"), child)
+			if err != nil {
+				return err
+			}
+			prop.SetGroup(group)
+			c.Add(name, prop)
+		}
+	}
+	return nil
+}
+
+// unmarshalPropertyXML converts an XML element to a property of a card of the
+// given version.
+func unmarshalPropertyXML(version string, node xmlNode) (name string, prop Property, err error) {
+	name = strings.ToUpper(node.XMLName.Local)
+	if params := node.child("parameters"); params != nil {
+		for _, param := range params.Children {
+			var values []string
+			for _, value := range param.Children {
+				values = append(values, value.Content)
+			}
+			prop.addParam(param.XMLName.Local, values...)
+		}
+	}
+
+	var values []xmlNode
+	for _, child := range node.Children {
+		if child.XMLName.Local != "parameters" {
+			values = append(values, child)
+		}
+	}
+	if len(values) == 0 {
+		return "", Property{}, fmt.Errorf("vcard: xCard property %v has no value", node.XMLName.Local)
+	}
+
+	names := structuredComponents[name]
+	typ := values[0].XMLName.Local
+	if names != nil && indexOf(names, typ) != -1 {
+		// This is a structured value with named components. Any
+		// components after the last one present (such as the identity
+		// component of GENDER) are omitted.
+		typ = "text"
+		for _, value := range values {
+			i := indexOf(names, value.XMLName.Local)
+			if i == -1 {
+				return "", Property{}, fmt.Errorf("vcard: unexpected %v element in xCard property %v", value.XMLName.Local, node.XMLName.Local)
+			}
+			for len(prop.components) <= i {
+				prop.components = append(prop.components, nil)
+			}
+			prop.components[i] = append(prop.components[i], value.Content)
+		}
+		for i := range prop.components {
+			if prop.components[i] == nil {
+				prop.components[i] = []string{""}
+			}
+		}
+	}
+	if _, ok := prop.params["VALUE"]; !ok && typ != "unknown" && typ != ValueType(version, name, prop) {
+		prop.SetParam("VALUE", typ)
+	}
+	if prop.components != nil {
+		return name, prop, nil
+	}
+
+	var texts []string
+	for _, value := range values {
+		if value.XMLName.Local != typ {
+			return "", Property{}, fmt.Errorf("vcard: mixed value types in xCard property %v", node.XMLName.Local)
+		}
+		texts = append(texts, value.Content)
+	}
+	switch {
+	case typ == "unknown":
+		if prop.components, err = parseComponents(strings.Join(texts, ",")); err != nil {
+			return "", Property{}, err
+		}
+	case typ != "text":
+		prop.setJoined(strings.Join(texts, ","))
+	case name == "ORG":
+		// Each text element is a separate component.
+		for _, text := range texts {
+			prop.components = append(prop.components, []string{text})
+		}
+	default:
+		prop.SetValues(texts...)
+	}
+	return name, prop, nil
+}
+
+// indexOf returns the index of s in ss, or -1 if it is not present.
+func indexOf(ss []string, s string) int {
+	for i := range ss {
+		if ss[i] == s {
+			return i
+		}
+	}
+	return -1
+}
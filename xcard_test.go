@@ -0,0 +1,128 @@
+package vcard
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleXCard = `<?xml version="1.0" encoding="UTF-8"?>
+<vcards xmlns="urn:ietf:params:xml:ns:vcard-4.0"><vcard xmlns="urn:ietf:params:xml:ns:vcard-4.0">` +
+	`<version><text>4.0</text></version>` +
+	`<fn><text>Simon Perreault</text></fn>` +
+	`<n><surname>Perreault</surname><given>Simon</given><additional></additional><prefix></prefix><suffix>ing. jr</suffix><suffix>M.Sc.</suffix></n>` +
+	`<bday><date-and-or-time>--0203</date-and-or-time></bday>` +
+	`<gender><sex>M</sex></gender>` +
+	`<email><parameters><type><text>work</text></type></parameters><text>simon.perreault@viagenie.ca</text></email>` +
+	`<group name="home"><tel><parameters><type><text>work,voice</text></type><pref><integer>1</integer></pref></parameters><uri>tel:+1-418-656-9254;ext=102</uri></tel></group>` +
+	`<geo><parameters><type><text>work</text></type></parameters><uri>geo:46.772673,-71.282945</uri></geo>` +
+	`<categories><text>computers</text><text>cameras</text></categories>` +
+	`<x-foo><unknown>a\,b;c</unknown></x-foo>` +
+	`<x-num><integer>42</integer></x-num>` +
+	`<note><text>line&#xA;break</text></note>` +
+	`</vcard></vcards>`
+
+func TestWriteAllXML(t *testing.T) {
+	cards, err := ParseAll(strings.NewReader(sampleVCard4))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteAllXML(buf, cards); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != sampleXCard {
+		t.Fatalf("got %s, want %s", buf, sampleXCard)
+	}
+}
+
+func TestParseAllXML(t *testing.T) {
+	cards, err := ParseAllXML(strings.NewReader(sampleXCard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cards) != 1 {
+		t.Fatalf("got %v cards, want 1", len(cards))
+	}
+	if out := cards[0].UnfoldedString(); out != sampleVCard4 {
+		t.Fatalf("got %q, want %q", out, sampleVCard4)
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	cards, err := ParseAll(strings.NewReader(sampleVCard))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteAllXML(buf, append(cards, cards[0])); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := ParseAllXML(buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("got %v cards, want 2", len(parsed))
+	}
+
+	// The VALUE parameter of PHOTO is represented by the name of the value
+	// element, so its case and position are not preserved.
+	expected := strings.TrimRight(sampleVCard, "\r\n") + "\n"
+	expected = strings.Replace(expected, "PHOTO;VALUE=URI;TYPE=GIF:", "PHOTO;TYPE=GIF;VALUE=uri:", 1)
+	for _, card := range parsed {
+		if out := card.UnfoldedString(); out != expected {
+			t.Errorf("got %q, want %q", out, expected)
+		}
+	}
+}
+
+func TestUnmarshalXML(t *testing.T) {
+	const in = `<vcard xmlns="urn:ietf:params:xml:ns:vcard-4.0">
+  <fn><text>Mr. John Q. Public, Esq.</text></fn>
+  <org><text>ABC, Inc.</text><text>North American Division</text></org>
+  <adr>
+    <parameters><type><text>work</text></type><label><text>Mr. John Q. Public</text></label></parameters>
+    <street>123 Main Street</street>
+    <locality>Any Town</locality>
+    <code>91921-1234</code>
+  </adr>
+</vcard>`
+
+	card := new(Card)
+	if err := xml.Unmarshal([]byte(in), card); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if org := card.Organization(); !reflect.DeepEqual(org, []string{"ABC, Inc.", "North American Division"}) {
+		t.Errorf("got ORG %q", org)
+	}
+	addr := Address{
+		Street:     []string{"123 Main Street"},
+		Locality:   []string{"Any Town"},
+		PostalCode: []string{"91921-1234"},
+		Label:      "Mr. John Q. Public",
+		Types:      []string{"work"},
+	}
+	if addrs := card.Addresses(); len(addrs) != 1 || !reflect.DeepEqual(addrs[0], addr) {
+		t.Errorf("got ADR %+v, want %+v", addrs, addr)
+	}
+}
+
+func TestUnmarshalXMLFailure(t *testing.T) {
+	tests := []string{
+		`<vcard><fn></fn></vcard>`,
+		`<vcard><group><fn><text>x</text></fn></group></vcard>`,
+		`<vcard><n><surname>a</surname><text>b</text></n></vcard>`,
+		`<vcard><note><text>a</text><uri>b</uri></note></vcard>`,
+		`<vcard><x-foo><unknown>bad\escape</unknown></x-foo></vcard>`,
+	}
+
+	for _, test := range tests {
+		card := new(Card)
+		if err := xml.Unmarshal([]byte(test), card); err == nil {
+			t.Errorf("successfully unmarshalled %q as %q", test, card)
+		}
+	}
+}